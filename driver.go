@@ -0,0 +1,41 @@
+package sql2http
+
+// Driver describes a database/sql driver known to this package.
+type Driver struct {
+	Name    string   // the database/sql driver name, e.g. "postgres"
+	Aliases []string // other usual names of the database, e.g. "postgresql"
+
+	placeholder placeholderType // how query parameters are written
+}
+
+// drivers are the known drivers. Other drivers are given "?" query
+// parameters.
+var drivers = []Driver{
+	{Name: "sqlite3", Aliases: []string{"sqlite"}, placeholder: placeholderNAMED | ':'},
+	{Name: "oci8", Aliases: []string{"oracle"}, placeholder: placeholderNAMED | ':'},
+	{Name: "postgres", Aliases: []string{"postgresql"}, placeholder: placeholderNUMBER | '$'},
+	{Name: "ql", placeholder: placeholderNUMBER | '$'},
+	{Name: "mysql", placeholder: placeholderSIMPLE | '?'},
+	{Name: "sqlserver", Aliases: []string{"mssql"}, placeholder: placeholderNAMED | '@'},
+}
+
+// Drivers returns the known database/sql drivers.
+func Drivers() []Driver {
+	return append([]Driver(nil), drivers...)
+}
+
+// LookupDriver returns the known driver of name, a database/sql driver
+// name or one of its aliases. It returns false if name is unknown.
+func LookupDriver(name string) (Driver, bool) {
+	for _, d := range drivers {
+		if d.Name == name {
+			return d, true
+		}
+		for _, alias := range d.Aliases {
+			if alias == name {
+				return d, true
+			}
+		}
+	}
+	return Driver{}, false
+}
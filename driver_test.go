@@ -0,0 +1,25 @@
+package sql2http
+
+import "testing"
+
+func TestLookupDriver(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"sqlite3", "sqlite3"},
+		{"sqlite", "sqlite3"},
+		{"postgresql", "postgres"},
+		{"mssql", "sqlserver"},
+		{"oracle", "oci8"},
+		{"db2", ""},
+	}
+	for _, tt := range tests {
+		d, ok := LookupDriver(tt.name)
+		if d.Name != tt.want || ok != (tt.want != "") {
+			t.Errorf("LookupDriver(%q) = %q, %v; want %q", tt.name, d.Name, ok, tt.want)
+		}
+	}
+	if got := namedArgTranslator("db2"); got != placeholderSIMPLE|'?' {
+		t.Errorf("namedArgTranslator(db2) = %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package sql2http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Form describes the form to submit the parameters of a page, see
+// Result.Form.
+type Form struct {
+	Action string // the path of the page, with the URL parameters of the request
+	Method string // the HTTP method of the page
+	Inputs []Input
+}
+
+// Input is a parameter of the queries of a page.
+type Input struct {
+	Name  string
+	Type  string      // the declared SQL type, e.g. "integer", or ""
+	Value interface{} // the current value, from Result.Params, or nil
+}
+
+// Form returns the form to submit the page parameters: the parameters of
+// the queries which are not part of the URL pattern, in order of first
+// appearance. The types of the inputs are the ones declared in the
+// queries, with either "CAST(:name AS type)" or ":name::type".
+//
+// It returns nil for a GET page without such parameters.
+func (r *Result) Form() *Form {
+	inPattern := make(map[string]bool)
+	for _, seg := range strings.Split(r.Pattern, "/") {
+		if seg != "" && (seg[0] == ':' || seg[0] == '*') {
+			inPattern[seg[1:]] = true
+		}
+	}
+	f := &Form{Method: r.method}
+	if f.Method == "" {
+		f.Method = http.MethodGet
+	}
+	seen := make(map[string]int) // index in f.Inputs
+	for _, q := range r.Queries {
+		for i, name := range q.Params {
+			if inPattern[name] {
+				continue
+			}
+			var typ string
+			if i < len(q.Types) {
+				typ = q.Types[i]
+			}
+			if j, ok := seen[name]; ok {
+				if f.Inputs[j].Type == "" {
+					f.Inputs[j].Type = typ
+				}
+				continue
+			}
+			seen[name] = len(f.Inputs)
+			f.Inputs = append(f.Inputs, Input{Name: name, Type: typ, Value: r.Params[name]})
+		}
+	}
+	if len(f.Inputs) == 0 && f.Method == http.MethodGet {
+		return nil
+	}
+	action, err := urlPath(r.Pattern, r.Params)
+	if err != nil && r.Request.URL != nil {
+		action = r.Request.URL.Path
+	}
+	f.Action = action
+	return f
+}
@@ -0,0 +1,36 @@
+package sql2http
+
+import "testing"
+
+func TestResultForm(t *testing.T) {
+	res := &Result{
+		Pattern: "/add/:id",
+		Params:  map[string]interface{}{"id": "a b", "name": "x"},
+		Queries: []Query{
+			{Params: []string{"id", "name", "n"}, Types: []string{"", "", ""}},
+			{Params: []string{"n", "name"}, Types: []string{"integer", ""}},
+		},
+		method: "POST",
+	}
+	f := res.Form()
+	if f == nil {
+		t.Fatal("no form")
+	}
+	if f.Action != "/add/a%20b" || f.Method != "POST" {
+		t.Errorf("form %s %s", f.Method, f.Action)
+	}
+	want := []Input{{"name", "", "x"}, {"n", "integer", nil}}
+	if len(f.Inputs) != len(want) {
+		t.Fatalf("inputs %v; want %v", f.Inputs, want)
+	}
+	for i := range want {
+		if f.Inputs[i] != want[i] {
+			t.Errorf("input %d: %v; want %v", i, f.Inputs[i], want[i])
+		}
+	}
+
+	res = &Result{Pattern: "/name/:id", Queries: []Query{{Params: []string{"id"}}}, method: "GET"}
+	if f := res.Form(); f != nil {
+		t.Errorf("form for a GET page without inputs: %v", f)
+	}
+}
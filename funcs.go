@@ -0,0 +1,511 @@
+package sql2http
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TemplateFuncs are the functions available in the templates of the
+// template/xxx packages. Besides add, mod, join, split and tex:
+//
+//     sub, mul, div   arithmetic, like add and mod, on any mix of integers,
+//                     floats and numeric strings: the result is an integer
+//                     if both operands are, a float otherwise
+//     now             the current time
+//     date            formats a time: {{date "2006-01-02" .At}}; the layout
+//                     may also be one of "date", "datetime", "time",
+//                     "rfc3339" or "rfc1123", and the time a time.Time,
+//                     a string such as "2006-01-02 15:04:05", or Unix
+//                     seconds
+//     parsetime       parses a time: {{parsetime "date" "2020-03-01"}}
+//     number          formats a number with thousands separators and
+//                     fixed decimals: {{number 2 1234.5}} is "1,234.50"
+//     fixed           formats a number with fixed decimals, without
+//                     separators: {{fixed 2 1234.5}} is "1234.50"
+//     default         returns its second argument, or the first one if
+//                     the second is NULL or empty: {{.Name | default "-"}}
+//     coalesce        returns its first argument not NULL nor empty
+//     dict            builds a map from key, value pairs: {{dict "a" 1 "b" 2}}
+//     list            builds a list from its arguments
+//     json            encodes a value as JSON
+//     query           builds a URL query from key, value pairs:
+//                     {{query "page" 2 "q" "a b"}} is "page=2&q=a+b"
+//     urlpath         builds a path from a pattern and parameters, given
+//                     as key, value pairs or maps such as .Params:
+//                     {{urlpath .Pattern "id" 3}} is "/name/3" for
+//                     pattern "/name/:id"; a path starting with "//"
+//                     (a protocol-relative URL) is an error
+//     truncate        shortens a string to n runes, ending with "…":
+//                     {{truncate 20 .Description}}
+//     seconds         converts a number of seconds to a time.Duration
+//     humanize        formats a size in bytes ("1.5 KiB"), a
+//                     time.Duration ("2h 5m"), or a time.Time relative to
+//                     now ("3d 4h ago")
+//
+// The standard template function urlquery is still available to escape
+// a single value.
+var TemplateFuncs = map[string]interface{}{
+	"add":       add,
+	"sub":       sub,
+	"mul":       mul,
+	"div":       div,
+	"mod":       mod,
+	"join":      strings.Join,
+	"split":     strings.Split,
+	"tex":       TeXEscaper,
+	"now":       time.Now,
+	"date":      formatTime,
+	"parsetime": parseTime,
+	"number":    formatNumber,
+	"fixed":     formatFixed,
+	"default":   defaultValue,
+	"coalesce":  coalesce,
+	"dict":      dict,
+	"list":      list,
+	"json":      toJSON,
+	"query":     query,
+	"urlpath":   urlPath,
+	"truncate":  truncate,
+	"seconds":   seconds,
+	"humanize":  humanize,
+}
+
+// toNumber converts v to an int64 if it is an integer, or to a float64,
+// as are the unsigned integers beyond math.MaxInt64.
+func toNumber(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("not a number: NULL")
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return float64(u), nil
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("not a number: %v", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if i, ok := n.(int64); ok {
+		return float64(i), nil
+	}
+	return n.(float64), nil
+}
+
+// arith applies operator op to x and y.
+func arith(op byte, x, y interface{}) (interface{}, error) {
+	a, err := toNumber(x)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toNumber(y)
+	if err != nil {
+		return nil, err
+	}
+	ia, aInt := a.(int64)
+	ib, bInt := b.(int64)
+	if aInt && bInt {
+		switch op {
+		case '+':
+			return ia + ib, nil
+		case '-':
+			return ia - ib, nil
+		case '*':
+			return ia * ib, nil
+		}
+		if ib == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == '/' {
+			return ia / ib, nil
+		}
+		return ia % ib, nil
+	}
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+	switch op {
+	case '+':
+		return fa + fb, nil
+	case '-':
+		return fa - fb, nil
+	case '*':
+		return fa * fb, nil
+	}
+	if fb == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	if op == '/' {
+		return fa / fb, nil
+	}
+	return math.Mod(fa, fb), nil
+}
+
+func add(x, y interface{}) (interface{}, error) { return arith('+', x, y) }
+func sub(x, y interface{}) (interface{}, error) { return arith('-', x, y) }
+func mul(x, y interface{}) (interface{}, error) { return arith('*', x, y) }
+func div(x, y interface{}) (interface{}, error) { return arith('/', x, y) }
+func mod(x, y interface{}) (interface{}, error) { return arith('%', x, y) }
+
+// timeLayouts are the layouts names accepted by date and parsetime.
+var timeLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+	"time":     "15:04:05",
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+}
+
+func layout(name string) string {
+	if l, ok := timeLayouts[strings.ToLower(name)]; ok {
+		return l
+	}
+	return name
+}
+
+// stringLayouts are the layouts tried by toTime to parse strings, as
+// returned by the database drivers.
+var stringLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, l := range stringLayouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t, nil
+			}
+		}
+	default:
+		if n, err := toNumber(v); err == nil {
+			if i, ok := n.(int64); ok {
+				return time.Unix(i, 0), nil
+			}
+			f := n.(float64)
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("not a time: %v", v)
+}
+
+// formatTime formats v with the given layout. NULL is formatted as "".
+func formatTime(name string, v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout(name)), nil
+}
+
+func parseTime(name, s string) (time.Time, error) {
+	return time.Parse(layout(name), s)
+}
+
+// formatFixed formats v with the given number of decimals. NULL is
+// formatted as "".
+func formatFixed(decimals int, v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	n, err := toNumber(v)
+	if err != nil {
+		return "", err
+	}
+	if i, ok := n.(int64); ok && decimals <= 0 {
+		return strconv.FormatInt(i, 10), nil
+	}
+	f, _ := toFloat(n)
+	if decimals < 0 {
+		decimals = 0
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64), nil
+}
+
+// formatNumber is like formatFixed, separating the thousands with ",".
+func formatNumber(decimals int, v interface{}) (string, error) {
+	s, err := formatFixed(decimals, v)
+	if err != nil || s == "" {
+		return s, err
+	}
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	frac := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], s[i:]
+	}
+	if len(s) <= 3 || strings.ContainsAny(s, "IN") { // Inf, NaN
+		return sign + s + frac, nil
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	head := len(s) % 3
+	if head == 0 {
+		head = 3
+	}
+	b.WriteString(s[:head])
+	for i := head; i < len(s); i += 3 {
+		b.WriteByte(',')
+		b.WriteString(s[i : i+3])
+	}
+	b.WriteString(frac)
+	return b.String(), nil
+}
+
+// empty reports whether v is NULL or an empty string.
+func empty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	}
+	return false
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func dict(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		k, ok := kv[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", kv[i])
+		}
+		m[k] = kv[i+1]
+	}
+	return m, nil
+}
+
+func list(values ...interface{}) []interface{} { return values }
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// params collects the key, value pairs and maps of args.
+func params(fn string, args []interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for i := 0; i < len(args); i++ {
+		switch a := args[i].(type) {
+		case map[string]interface{}:
+			for k, v := range a {
+				m[k] = v
+			}
+		case map[string]string:
+			for k, v := range a {
+				m[k] = v
+			}
+		case string:
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s: missing value for key %q", fn, a)
+			}
+			i++
+			m[a] = args[i]
+		default:
+			return nil, fmt.Errorf("%s: key %v is not a string", fn, a)
+		}
+	}
+	return m, nil
+}
+
+// query returns the URL encoded query of the given parameters. NULL
+// values are left out.
+func query(args ...interface{}) (string, error) {
+	m, err := params("query", args)
+	if err != nil {
+		return "", err
+	}
+	q := make(url.Values)
+	for k, v := range m {
+		if v != nil {
+			q.Set(k, fmt.Sprint(v))
+		}
+	}
+	return q.Encode(), nil
+}
+
+// urlPath replaces the named parameters (":name") and catch-all
+// parameters ("*name") of pattern with the given values.
+func urlPath(pattern string, args ...interface{}) (string, error) {
+	m, err := params("urlpath", args)
+	if err != nil {
+		return "", err
+	}
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if seg == "" || seg[0] != ':' && seg[0] != '*' {
+			continue
+		}
+		v, ok := m[seg[1:]]
+		if !ok {
+			return "", fmt.Errorf("urlpath: missing parameter %q", seg[1:])
+		}
+		s := fmt.Sprint(v)
+		if seg[0] == ':' {
+			segs[i] = url.PathEscape(s)
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(s, "/"), "/")
+		for j := range parts {
+			parts[j] = url.PathEscape(parts[j])
+		}
+		segs[i] = strings.Join(parts, "/")
+	}
+	p := strings.Join(segs, "/")
+	if strings.HasPrefix(p, "//") {
+		return "", fmt.Errorf("urlpath: %q is not a path", p)
+	}
+	return p, nil
+}
+
+// truncate shortens the text of v to n runes, replacing the end with
+// "…". NULL is truncated to "".
+func truncate(n int, v interface{}) string {
+	if v == nil || n <= 0 {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+func seconds(v interface{}) (time.Duration, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// humanize formats sizes, durations and times for humans. NULL is
+// formatted as "".
+func humanize(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case time.Duration:
+		return humanDuration(v), nil
+	case time.Time:
+		d := time.Since(v)
+		if d < 0 {
+			return "in " + humanDuration(-d), nil
+		}
+		return humanDuration(d) + " ago", nil
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return humanSize(f), nil
+}
+
+var sizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+func humanSize(f float64) string {
+	if math.Abs(f) < 1024 {
+		return strconv.FormatFloat(f, 'f', -1, 64) + " B"
+	}
+	unit := ""
+	for _, unit = range sizeUnits {
+		f /= 1024
+		if math.Abs(f) < 1024 {
+			break
+		}
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + " " + unit
+}
+
+var durationUnits = []struct {
+	d    time.Duration
+	name string
+}{
+	{24 * time.Hour, "d"},
+	{time.Hour, "h"},
+	{time.Minute, "m"},
+	{time.Second, "s"},
+}
+
+// humanDuration formats d with its two largest units, e.g. "2h 5m".
+func humanDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	i := 0
+	for d < durationUnits[i].d {
+		i++
+	}
+	u := durationUnits[i]
+	s := strconv.FormatInt(int64(d/u.d), 10) + u.name
+	if i+1 < len(durationUnits) {
+		next := durationUnits[i+1]
+		if n := d % u.d / next.d; n > 0 {
+			s += " " + strconv.FormatInt(int64(n), 10) + next.name
+		}
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package sql2http
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"Pattern": "/files/:id/*path",
+		"Params":  map[string]interface{}{"id": "a b", "path": "/x/y.txt"},
+		"At":      time.Date(2020, 3, 1, 14, 5, 0, 0, time.UTC),
+		"Null":    nil,
+		"Big":     uint64(math.MaxUint64),
+	}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{`{{add 1 2}} {{add 1 "2.5"}} {{sub 1 3}} {{mul 2 1.5}}`, "3 3.5 -2 3"},
+		{`{{add .Big 0}} {{sub .Big 1}}`, "1.8446744073709552e+19 1.8446744073709552e+19"},
+		{`{{div 7 2}} {{div 7 2.0}} {{mod 7 3}} {{mod 7.5 2}}`, "3 3.5 1 1.5"},
+		{`{{date "date" .At}} {{date "15:04" "2020-03-01 09:30:00"}}{{date "date" .Null}}`, "2020-03-01 09:30"},
+		{`{{(parsetime "date" "2020-03-01").Month}}`, "March"},
+		{`{{number 2 1234567.891}} {{number 0 -1234}} {{number 1 12}} {{fixed 2 "3"}}`, "1,234,567.89 -1,234 12.0 3.00"},
+		{`{{.Null | default "-"}} {{"" | default "-"}} {{0 | default "-"}} {{coalesce .Null "" "x"}}`, "- - 0 x"},
+		{`{{with dict "a" 1 "b" (list 2 3)}}{{json .}}{{end}}`, `{"a":1,"b":[2,3]}`},
+		{`{{query "q" "a b" "page" 2 "none" .Null}}`, "page=2&q=a+b"},
+		{`{{urlpath .Pattern .Params}} {{urlpath "/name/:id" "id" 3}}`, "/files/a%20b/x/y.txt /name/3"},
+		{`{{truncate 5 "abcdefgh"}} {{truncate 5 "abc"}} {{truncate 3 "éèêë"}}`, "abcd… abc éè…"},
+		{`{{humanize 512}} {{humanize 1536}} {{humanize 3221225472}}`, "512 B 1.5 KiB 3.0 GiB"},
+		{`{{humanize (seconds 7500)}} {{humanize (seconds 90000)}} {{humanize (seconds 0.25)}}`, "2h 5m 1d 1h 250ms"},
+	}
+	for _, test := range tests {
+		tmpl, err := template.New("").Funcs(TemplateFuncs).Parse(test.tmpl)
+		if err != nil {
+			t.Errorf("%s: %v", test.tmpl, err)
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			t.Errorf("%s: %v", test.tmpl, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s: got %q; want %q", test.tmpl, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{`{{div 1 0}}`, `{{add 1 "x"}}`, `{{dict "a"}}`, `{{urlpath "/:id"}}`, `{{urlpath "/:a/b" "a" ""}}`, `{{urlpath "/*p" "p" "//b"}}`} {
+		tmpl := template.Must(template.New("").Funcs(TemplateFuncs).Parse(bad))
+		if err := tmpl.Execute(&strings.Builder{}, data); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
@@ -12,7 +12,6 @@ require (
 	github.com/mattn/go-oci8 v0.0.0-20190930131957-1a85c30c0e48
 	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/remyoudompheng/bigfft v0.0.0-20190728182440-6a916e37a237 // indirect
-	github.com/tealeg/xlsx v1.0.3
 	google.golang.org/appengine v1.6.4 // indirect
 	gopkg.in/yaml.v2 v2.2.2
 	modernc.org/b v1.0.0 // indirect
@@ -16,7 +16,61 @@ type Router struct {
 	*httprouter.Router
 	*sql.DB
 
-	dbdriver string
+	// Format is the strategy used to select the template of a request.
+	Format FormatSelection
+
+	dbdriver  string
+	templates []*TemplateSet // the template sets of the registered pages
+	forms     *httprouter.Router // GET handlers of the POST pages forms
+}
+
+// FormatSelection is the strategy used by a Router to select the template
+// used to format the response of a request.
+//
+// Whatever the strategy, if it does not select a template, the template is
+// negotiated with the request Accept header.
+type FormatSelection int
+
+const (
+	// FormatExtension selects the template by the request path file
+	// extension, if it is the extension of a registered template. The
+	// extension is then removed from the path before routing the
+	// request. Other paths are routed as is, so that path parameters
+	// may contain dots (e.g. /file/report.v2).
+	FormatExtension FormatSelection = iota
+
+	// FormatQuery selects the template by the "format" query parameter,
+	// e.g. /name/2?format=json. The path is routed as is.
+	FormatQuery
+
+	// FormatAccept selects the template by the Accept header only. The
+	// path is routed as is.
+	FormatAccept
+)
+
+var formatNames = []string{
+	FormatExtension: "extension",
+	FormatQuery:     "query",
+	FormatAccept:    "accept",
+}
+
+func (f FormatSelection) String() string {
+	if f >= 0 && int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return "FormatSelection(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Set parses the name of a FormatSelection: one of "extension", "query"
+// or "accept". It implements interface flag.Value.
+func (f *FormatSelection) Set(s string) error {
+	for i, name := range formatNames {
+		if s == name {
+			*f = FormatSelection(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid format selection %q", s)
 }
 
 func NewRouter(driver, dataSource string) (*Router, error) {
@@ -24,32 +78,68 @@ func NewRouter(driver, dataSource string) (*Router, error) {
 	if err != nil {
 		return nil, err
 	}
-	r := &Router{Router: httprouter.New(), DB: db, dbdriver: driver}
-	return r, nil
+	return &Router{Router: httprouter.New(), DB: db, dbdriver: driver}, nil
 }
 
-// ServeHTTP wraps the embedded httprouter.Router ServeHTTP to handle
-// file extensions.
+// ServeHTTP wraps the embedded httprouter.Router ServeHTTP to select the
+// response template, according to r.Format.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	ext := path.Ext(req.URL.Path)
-	// currently httprouter uses
-	// req.URL.Path to route the request (see
-	// github.com/julienschmidt/httprouter/router.go#L279
-	// @commit adbc773).
-	// BUG(diego): is modifying req.URL.Path prone to problems?
-	req.URL.Path = strings.TrimSuffix(req.URL.Path, ext)
+	var ext string
+	switch r.Format {
+	case FormatExtension:
+		ext = r.registeredExt(req.URL.Path)
+		// currently httprouter uses
+		// req.URL.Path to route the request (see
+		// github.com/julienschmidt/httprouter/router.go#L279
+		// @commit adbc773).
+		// BUG(diego): is modifying req.URL.Path prone to problems?
+		req.URL.Path = strings.TrimSuffix(req.URL.Path, ext)
+	case FormatQuery:
+		if f := req.URL.Query().Get("format"); f != "" {
+			ext = "." + strings.TrimPrefix(f, ".")
+		}
+	}
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, extKey, ext)
 	req = req.WithContext(ctx)
 	r.Router.ServeHTTP(w, req)
 }
 
+// registeredExt returns the longest suffix of the last element of p
+// starting with a dot, which is the extension of a template of a
+// registered page. It returns "" if there is none.
+func (r *Router) registeredExt(p string) string {
+	name := path.Base(p)
+	for i := 1; i < len(name); i++ { // a leading dot is not an extension
+		if name[i] != '.' {
+			continue
+		}
+		ext := name[i:]
+		for _, ts := range r.templates {
+			if ts.Get(ext) != nil {
+				return ext
+			}
+		}
+	}
+	return ""
+}
+
+func (r *Router) addTemplates(templates *TemplateSet) {
+	for _, ts := range r.templates {
+		if ts == templates {
+			return
+		}
+	}
+	r.templates = append(r.templates, templates)
+}
+
 // SqlGET registers the path pattern to send the given queries on the
 // database upon GET requests.
 //
 // The path given is the pattern without file extension. When matched
-// against a request URL, the URL file extensions is used to find the
-// template used (defaulting to ".html").
+// against a request URL, the template used is selected according to
+// r.Format: by default the URL file extension, else the template
+// negotiated with the request Accept header (defaulting to ".html").
 //
 // The list of templates used for the responses is provided with tmpl. It
 // defaults to DefaultTemplateSet if nil.
@@ -63,10 +153,13 @@ func (r *Router) SqlGET(path string, queries []Query, templates *TemplateSet) {
 		templates: templates,
 		fn:        runQueries,
 		db:        r.DB,
+		driver:    r.dbdriver,
+		method:    http.MethodGet,
 	}
 	if page.templates == nil {
 		page.templates = DefaultTemplateSet
 	}
+	r.addTemplates(page.templates)
 	r.Handler(http.MethodGet, path, page)
 }
 
@@ -74,12 +167,25 @@ func (r *Router) SqlGET(path string, queries []Query, templates *TemplateSet) {
 // database upon POST requests.
 //
 // The path given is the pattern without file extension. When matched
-// against a request URL, the URL file extensions is used to find the
-// template used (defaulting to ".html").
+// against a request URL, the template used is selected according to
+// r.Format: by default the URL file extension, else the template
+// negotiated with the request Accept header (defaulting to ".html").
 //
 // The list of templates used for the responses is provided with tmpl. It
 // defaults to DefaultTemplateSet if nil.
 func (r *Router) SqlPOST(path string, queries []Query, templates *TemplateSet) {
+	r.sqlPOST(path, queries, templates, false)
+}
+
+// SqlPOSTForm is like SqlPOST, and also answers the GET requests of the
+// path by executing the template without running the queries, for
+// example to show the form of the page (see Result.Form). A GET page
+// registered for the same path takes precedence.
+func (r *Router) SqlPOSTForm(path string, queries []Query, templates *TemplateSet) {
+	r.sqlPOST(path, queries, templates, true)
+}
+
+func (r *Router) sqlPOST(path string, queries []Query, templates *TemplateSet, withForm bool) {
 	for i := range queries {
 		bindNamedArgs(r.dbdriver, &queries[i])
 	}
@@ -89,22 +195,64 @@ func (r *Router) SqlPOST(path string, queries []Query, templates *TemplateSet) {
 		templates: templates,
 		fn:        runExecs,
 		db:        r.DB,
+		driver:    r.dbdriver,
+		method:    http.MethodPost,
 	}
 	if page.templates == nil {
 		page.templates = DefaultTemplateSet
 	}
+	r.addTemplates(page.templates)
 	r.Handler(http.MethodPost, path, page)
+	if !withForm {
+		return
+	}
+	if r.forms == nil {
+		// GET requests of POST pages fall through to the forms router
+		r.forms = httprouter.New()
+		r.forms.RedirectTrailingSlash = false
+		r.forms.RedirectFixedPath = false
+		r.forms.HandleMethodNotAllowed = false
+		r.forms.NotFound = http.HandlerFunc(r.methodNotAllowed)
+		r.Router.MethodNotAllowed = r.forms
+	}
+	form := *page
+	form.fn = noQueries
+	r.forms.HandlerFunc(http.MethodGet, path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Del("Allow") // set by r.Router before falling through
+		form.ServeHTTP(w, req)
+	})
+}
+
+// methodNotAllowed replies with the same error as httprouter.Router,
+// whose MethodNotAllowed handler is r.forms: a 405 status with the
+// Allow header listing the methods of the pages of the request path.
+func (r *Router) methodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	var allow []string
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if h, _, _ := r.Lookup(method, req.URL.Path); h != nil && method != req.Method {
+			allow = append(allow, method)
+		}
+	}
+	allow = append(allow, http.MethodOptions) // like httprouter
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 }
 
 func bindNamedArgs(driver string, q *Query) {
 	lexer := lexSQL(q.Q)
+	var toks []item
+	for tok := range lexer.items {
+		toks = append(toks, tok)
+	}
 	q.Params = q.Params[:0]
+	q.Types = q.Types[:0]
 	str := strings.Builder{}
 	tr := namedArgTranslator(driver)
 	o, i := 0, 0
-	for tok := range lexer.items {
+	for j, tok := range toks {
 		if tok.typ == itemIdentifier && tok.val[0] == ':' {
 			q.Params = append(q.Params, tok.val[1:])
+			q.Types = append(q.Types, paramType(toks, j))
 			str.WriteString(q.Q[o:tok.pos])
 			str.WriteString(tr.translate(tok.val, i))
 			o = tok.pos + len(tok.val)
@@ -117,6 +265,42 @@ func bindNamedArgs(driver string, q *Query) {
 	}
 }
 
+// paramType returns the type the parameter toks[i] is cast to, either
+// with "CAST(:name AS type)" or "$name::type", or "" if none.
+func paramType(toks []item, i int) string {
+	// next returns the index of the next token in direction dir,
+	// skipping spaces and comments.
+	next := func(i, dir int) int {
+		for i += dir; i >= 0 && i < len(toks); i += dir {
+			switch toks[i].typ {
+			case itemSpace, itemComment, itemBlockComment:
+				continue
+			}
+			return i
+		}
+		return -1
+	}
+	is := func(i int, typ itemType, val string) bool {
+		return i >= 0 && toks[i].typ == typ && (val == "" || strings.EqualFold(toks[i].val, val))
+	}
+	if n := next(i, +1); is(n, itemOperator, "::") {
+		if n = next(n, +1); is(n, itemIdentifier, "") {
+			return toks[n].val
+		}
+		return ""
+	}
+	p := next(i, -1)
+	if !is(p, itemOperator, "(") || !is(next(p, -1), itemIdentifier, "CAST") {
+		return ""
+	}
+	if n := next(i, +1); is(n, itemIdentifier, "AS") {
+		if n = next(n, +1); is(n, itemIdentifier, "") {
+			return toks[n].val
+		}
+	}
+	return ""
+}
+
 // placeholderType represents the possible placeholders that database
 // engines use. The 32 LSBs encoded the rune used as special
 // character. The 32 MSBs contain flags.
@@ -160,18 +344,12 @@ func (p placeholderType) translate(s string, i int) string {
 }
 
 func namedArgTranslator(driver string) placeholderType {
-	switch driver {
-	case "sqlite3", "oci8":
-		return placeholderNAMED|placeholderType(':')
-	case "postgres", "ql":
-		return placeholderNUMBER|placeholderType('$')
-	case "mysql":
-		return placeholderSIMPLE|placeholderType('?')
-	case "sqlserver":
-		return placeholderNAMED|placeholderType('@')
-	default:
-		return placeholderSIMPLE|placeholderType('?')
+	for _, d := range drivers {
+		if d.Name == driver {
+			return d.placeholder
+		}
 	}
+	return placeholderSIMPLE|placeholderType('?')
 }
 
 type extensionKey struct{}
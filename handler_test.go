@@ -1,6 +1,13 @@
 package sql2http
 
-import "testing"
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
 
 var placeholderTests = []struct{
 	ph   placeholderType
@@ -24,3 +31,92 @@ func TestPlaceholderTranslate(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisteredExt(t *testing.T) {
+	ts := &TemplateSet{}
+	ts.Register(".csv", TemplateFromExecuter(nopExecuter{}, "text/csv"))
+	ts.Register(".chart.html", TemplateFromExecuter(nopExecuter{}, "text/html"))
+	r := &Router{}
+	r.addTemplates(ts)
+	tests := []struct{ path, want string }{
+		{"/file/report.v2", ""},
+		{"/file/report.v2.csv", ".csv"},
+		{"/file/a.chart.html", ".chart.html"},
+		{"/file/.csv", ""},
+		{"/dir.csv/name", ""},
+		{"/name", ""},
+	}
+	for _, tc := range tests {
+		if got := r.registeredExt(tc.path); got != tc.want {
+			t.Errorf("%q: got %q; want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestBindNamedArgsTypes(t *testing.T) {
+	q := Query{Q: "SELECT * FROM t WHERE a = :a::int AND b = CAST( :b AS varchar(20)) AND c = :c AND d = cast(:d as DATE)"}
+	bindNamedArgs("postgres", &q)
+	if q.Q != "SELECT * FROM t WHERE a = $1::int AND b = CAST( $2 AS varchar(20)) AND c = $3 AND d = cast($4 as DATE)" {
+		t.Errorf("query: %q", q.Q)
+	}
+	want := []string{"int", "varchar", "", "DATE"}
+	if len(q.Types) != len(want) {
+		t.Fatalf("types: %q; want %q", q.Types, want)
+	}
+	for i := range want {
+		if q.Types[i] != want[i] {
+			t.Errorf("type of %s: %q; want %q", q.Params[i], q.Types[i], want[i])
+		}
+	}
+}
+
+// methodExecuter writes the method of the page of the Result.
+type methodExecuter struct{}
+
+func (methodExecuter) Execute(wr io.Writer, data interface{}) error {
+	_, err := io.WriteString(wr, data.(*Result).method)
+	return err
+}
+
+func TestPOSTForm(t *testing.T) {
+	ts := &TemplateSet{}
+	ts.Register(".html", TemplateFromExecuter(methodExecuter{}, "text/html"))
+	r := &Router{Router: httprouter.New()} // no forms router yet
+	r.SqlPOST("/del/:id", nil, ts)
+	r.SqlPOSTForm("/add/:id", nil, ts)
+
+	tests := []struct {
+		method, path string
+		status       int
+		allow        string
+		body         string
+	}{
+		{"GET", "/add/1", http.StatusOK, "", "POST"},
+		{"GET", "/add/1.html", http.StatusOK, "", "POST"},
+		{"GET", "/del/1", http.StatusMethodNotAllowed, "POST, OPTIONS", ""},
+		{"PUT", "/add/1", http.StatusMethodNotAllowed, "POST, OPTIONS", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status %d; want %d", tt.method, tt.path, w.Code, tt.status)
+			continue
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow %q; want %q", tt.method, tt.path, got, tt.allow)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s: body %q; want %q", tt.method, tt.path, w.Body.String(), tt.body)
+		}
+	}
+
+	// without form, the router is the plain httprouter one
+	r = &Router{Router: httprouter.New()}
+	r.SqlPOST("/del/:id", nil, ts)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/del/1", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("GET /del/1: status %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
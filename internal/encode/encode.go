@@ -0,0 +1,268 @@
+// Package encode walks the values given to the templates like
+// encoding/json does, for the templates writing other encodings (e.g.
+// CBOR or MessagePack): the output has the shape of the JSON one, with
+// native types where the encoding has them.
+//
+// The values are written as follows:
+//
+//     nil pointers, interfaces, slices and maps: Nil
+//     structs:   maps of their exported fields, named and omitted
+//                following their json tags
+//     maps:      maps, sorted by key; the keys must be strings or
+//                integers, written as strings
+//     []byte:    Bytes
+//     time.Time: Time
+//
+// The values of the rows of a sql2http.Table are written as Bytes when
+// they are strings which are not valid UTF-8, or of a binary database
+// type (e.g. BLOB or BYTEA): database/sql returns them as []byte, which
+// sql2http converts to strings.
+package encode
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// Encoder writes the values of an encoding.
+type Encoder interface {
+	Nil()
+	Bool(b bool)
+	Int(i int64)
+	Uint(u uint64)
+	Float(f float64)
+	String(s string)
+	Bytes(b []byte)
+	Time(t time.Time)
+	Array(n int) // the header of an array of n values
+	Map(n int)   // the header of a map of n keys and values
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	tableType = reflect.TypeOf(sql2http.Table{})
+)
+
+// Value writes v with e.
+func Value(e Encoder, v interface{}) error {
+	return value(e, reflect.ValueOf(v))
+}
+
+func value(e Encoder, v reflect.Value) error {
+	if !v.IsValid() {
+		e.Nil()
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		e.Time(v.Interface().(time.Time))
+		return nil
+	case tableType:
+		return table(e, v.Interface().(sql2http.Table))
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.Nil()
+			return nil
+		}
+		return value(e, v.Elem())
+	case reflect.Bool:
+		e.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.Int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.Uint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.Float(v.Float())
+	case reflect.String:
+		e.String(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.Nil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.Bytes(b)
+			return nil
+		}
+		e.Array(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := value(e, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.Nil()
+			return nil
+		}
+		return mapValue(e, v)
+	case reflect.Struct:
+		return structValue(e, v)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+func mapValue(e Encoder, v reflect.Value) error {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		var s string
+		switch k.Kind() {
+		case reflect.String:
+			s = k.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			s = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return fmt.Errorf("unsupported map key type %v", k.Type())
+		}
+		keys = append(keys, s)
+		values[s] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+	e.Map(len(keys))
+	for _, k := range keys {
+		e.String(k)
+		if err := value(e, values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type field struct {
+	name  string
+	value reflect.Value
+}
+
+func structValue(e Encoder, v reflect.Value) error {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(","+opts+",", ",omitempty,") && empty(fv) {
+			continue
+		}
+		fields = append(fields, field{name, fv})
+	}
+	e.Map(len(fields))
+	for _, f := range fields {
+		e.String(f.name)
+		if err := value(e, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// empty reports whether v is empty, as defined by the json omitempty
+// option.
+func empty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// table writes tbl like a struct, with its binary values as Bytes.
+func table(e Encoder, tbl sql2http.Table) error {
+	binary := make([]bool, len(tbl.Header))
+	for i := range binary {
+		binary[i] = i < len(tbl.Types) && IsBinary(tbl.Types[i])
+	}
+	e.Map(4)
+	e.String("Name")
+	e.String(tbl.Name)
+	for _, f := range []struct {
+		name string
+		v    []string
+	}{{"Header", tbl.Header}, {"Types", tbl.Types}} {
+		e.String(f.name)
+		if err := Value(e, f.v); err != nil {
+			return err
+		}
+	}
+	e.String("Rows")
+	if tbl.Rows == nil {
+		e.Nil()
+		return nil
+	}
+	e.Array(len(tbl.Rows))
+	for _, row := range tbl.Rows {
+		e.Map(2)
+		e.String("Header")
+		if err := Value(e, row.Header); err != nil {
+			return err
+		}
+		e.String("Values")
+		if row.Values == nil {
+			e.Nil()
+			continue
+		}
+		e.Array(len(row.Values))
+		for i, v := range row.Values {
+			if s, ok := v.(string); ok && (i < len(binary) && binary[i] || !utf8.ValidString(s)) {
+				e.Bytes([]byte(s))
+				continue
+			}
+			if err := Value(e, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsBinary reports whether the database type name typ (see
+// sql2http.Table.Types) is the one of binary data.
+func IsBinary(typ string) bool {
+	typ = strings.ToUpper(typ)
+	if i := strings.Index(typ, "("); i >= 0 {
+		typ = strings.TrimSpace(typ[:i])
+	}
+	switch typ {
+	case "RAW", "LONG RAW", "IMAGE", "BFILE":
+		return true
+	}
+	return strings.Contains(typ, "BLOB") || strings.Contains(typ, "BINARY") || typ == "BYTEA"
+}
@@ -0,0 +1,140 @@
+package encode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// builder implements Encoder by building the values decoded by
+// encoding/json into an interface{}.
+type builder struct {
+	stack []*container
+	root  interface{}
+}
+
+type container struct {
+	n     int // values left, keys and values for maps
+	isMap bool
+	array []interface{}
+	m     map[string]interface{}
+	key   string
+}
+
+func (b *builder) add(v interface{}) {
+	if len(b.stack) == 0 {
+		b.root = v
+		return
+	}
+	c := b.stack[len(b.stack)-1]
+	switch {
+	case !c.isMap:
+		c.array = append(c.array, v)
+	case c.n%2 == 0:
+		c.key = v.(string)
+	default:
+		c.m[c.key] = v
+	}
+	c.n--
+	if c.n == 0 {
+		b.stack = b.stack[:len(b.stack)-1]
+		if c.isMap {
+			b.add(c.m)
+		} else {
+			b.add(c.array)
+		}
+	}
+}
+
+func (b *builder) open(c *container) {
+	if c.n == 0 {
+		if c.isMap {
+			b.add(c.m)
+		} else {
+			b.add(c.array)
+		}
+		return
+	}
+	b.stack = append(b.stack, c)
+}
+
+func (b *builder) Nil()             { b.add(nil) }
+func (b *builder) Bool(v bool)      { b.add(v) }
+func (b *builder) Int(i int64)      { b.add(float64(i)) }
+func (b *builder) Uint(u uint64)    { b.add(float64(u)) }
+func (b *builder) Float(f float64)  { b.add(f) }
+func (b *builder) String(s string)  { b.add(s) }
+func (b *builder) Bytes(v []byte)   { b.add(base64.StdEncoding.EncodeToString(v)) }
+func (b *builder) Time(t time.Time) { b.add(t.Format(time.RFC3339Nano)) }
+func (b *builder) Array(n int)      { b.open(&container{n: n, array: []interface{}{}}) }
+func (b *builder) Map(n int) {
+	b.open(&container{n: 2 * n, isMap: true, m: map[string]interface{}{}})
+}
+
+func TestValue(t *testing.T) {
+	u, _ := url.Parse("https://example.org/users/2.cbor?q=1")
+	header := []string{"id", "name", "created", "avatar"}
+	res := &sql2http.Result{
+		Pattern: "/users/:id",
+		Params:  map[string]interface{}{"id": "2", "q": "1"},
+		Queries: []sql2http.Query{{Name: "user", Q: "SELECT * FROM users WHERE id = :id", Params: []string{"id"}}},
+		Tables: sql2http.Tables{{
+			Name:   "user",
+			Header: header,
+			Types:  []string{"INTEGER", "TEXT", "DATETIME", "VARCHAR"},
+			Rows: []sql2http.Row{{Header: header, Values: []interface{}{
+				int64(2), "ann", time.Date(2020, 3, 1, 12, 0, 0, 5, time.UTC), []byte{0xff, 0},
+			}}},
+		}},
+		Request: sql2http.Request{URL: u, Method: "GET", Header: http.Header{"Accept": {"*/*"}}},
+		Time:    time.Date(2020, 3, 1, 12, 0, 1, 0, time.UTC),
+		Version: "v0",
+		Driver:  "sqlite3",
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want interface{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatal(err)
+	}
+	got := &builder{}
+	if err := Value(got, res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.root, want) {
+		g, _ := json.Marshal(got.root)
+		t.Errorf("got\n%s\nwant\n%s", g, b)
+	}
+
+	// binary strings
+	res.Tables[0].Rows[0].Values[1] = "\xff"
+	res.Tables[0].Rows[0].Values[3] = "png"
+	res.Tables[0].Types[3] = "blob"
+	got = &builder{}
+	if err := Value(got, res); err != nil {
+		t.Fatal(err)
+	}
+	values := got.root.(map[string]interface{})["Tables"].([]interface{})[0].(map[string]interface{})["Rows"].([]interface{})[0].(map[string]interface{})["Values"].([]interface{})
+	if values[1] != "/w==" || values[3] != "cG5n" {
+		t.Errorf("binary values %q", values)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	for typ, want := range map[string]bool{
+		"BLOB": true, "longblob": true, "BYTEA": true, "VARBINARY": true, "VARBINARY(16)": true,
+		"RAW": true, "IMAGE": true, "TEXT": false, "VARCHAR": false, "": false, "RAWTEXT": false,
+	} {
+		if got := IsBinary(typ); got != want {
+			t.Errorf("IsBinary(%q) = %v", typ, got)
+		}
+	}
+}
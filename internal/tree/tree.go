@@ -0,0 +1,277 @@
+// Package tree walks template trees: directories holding template files,
+// whose path relative to the tree root (without extension) is the URL
+// pattern they apply to.
+//
+// A template file may start with directives, given as template comments
+// of the form "key: value", one per comment. For example an XML
+// template, with the default template delimiters:
+//
+//     {{/* content-type: application/rss+xml */}}
+//     <?xml version="1.0" encoding="UTF-8"?>
+//
+// The directives, and the line break directly following them, are
+// removed from the template text.
+//
+// Two directories of a tree are special:
+//
+//     _partials/  templates shared by all the pages of the tree, named
+//                 by their path relative to _partials/ without
+//                 extension (e.g. _partials/nav.html defines "nav")
+//     _layouts/   base templates a page can choose with the "layout"
+//                 directive, e.g. {{/* layout: base */}} for
+//                 _layouts/base.html; the page then fills the blocks
+//                 of the layout with {{define "name"}}...{{end}}
+package tree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Directive keys.
+const (
+	ContentType = "content-type" // overrides the content type of a template
+	Layout      = "layout"       // name of the layout of a page
+)
+
+// Special directories of a tree.
+const (
+	PartialsDir = "_partials"
+	LayoutsDir  = "_layouts"
+)
+
+// Tree is the set of template files of a tree, by kind.
+type Tree struct {
+	Pages    []File
+	Partials []File          // named relative to PartialsDir, e.g. "nav"
+	Layouts  map[string]File // by name relative to LayoutsDir, e.g. "base"
+}
+
+// Read walks dir like Walk, and sorts the files by kind. An error is
+// returned if a page refers to an unknown layout.
+func Read(dir, ext string, leftDelim, rightDelim string) (*Tree, error) {
+	files, err := Walk(dir, ext, leftDelim, rightDelim)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{Layouts: make(map[string]File)}
+	for _, f := range files {
+		switch {
+		case strings.HasPrefix(f.Name, "/"+PartialsDir+"/"):
+			f.Name = strings.TrimPrefix(f.Name, "/"+PartialsDir+"/")
+			t.Partials = append(t.Partials, f)
+		case strings.HasPrefix(f.Name, "/"+LayoutsDir+"/"):
+			f.Name = strings.TrimPrefix(f.Name, "/"+LayoutsDir+"/")
+			t.Layouts[f.Name] = f
+		default:
+			t.Pages = append(t.Pages, f)
+		}
+	}
+	for _, f := range t.Pages {
+		if l := f.Directives[Layout]; l != "" {
+			if _, ok := t.Layouts[l]; !ok {
+				return nil, fmt.Errorf("%s: unknown layout %q", f.Path, l)
+			}
+		}
+	}
+	return t, nil
+}
+
+// Namespace is a set of associated templates, e.g. a text/template or
+// an html/template Template, in which the files of a tree are parsed.
+type Namespace interface {
+	// Parse parses text as the definition of the template name.
+	Parse(name, text string) error
+	// Clone returns a copy of the namespace.
+	Clone() (Namespace, error)
+}
+
+// Page is a page of a tree, parsed with the partials and its layout.
+type Page struct {
+	File
+	Namespace Namespace // holds the templates of the page
+	Main      string    // template to execute: the layout if any, else the page
+}
+
+// Parse parses the partials of t in ns, then each page, with its
+// layout, in its own clone of ns. The layout of a page is named after
+// its file under LayoutsDir, e.g. "_layouts/base". The ext of the
+// files is only used in the logs.
+func (t *Tree) Parse(ns Namespace, ext string) ([]Page, error) {
+	for _, f := range t.Partials {
+		log.Println("found partial template", f.Name, ext)
+		if err := ns.Parse(f.Name, f.Text); err != nil {
+			return nil, err
+		}
+	}
+	pages := make([]Page, 0, len(t.Pages))
+	for _, f := range t.Pages {
+		log.Println("found template", f.Name, ext)
+		page := Page{File: f, Main: f.Name}
+		var err error
+		if page.Namespace, err = ns.Clone(); err != nil {
+			return nil, err
+		}
+		if l := f.Directives[Layout]; l != "" {
+			page.Main = LayoutsDir + "/" + l
+			if err := page.Namespace.Parse(page.Main, t.Layouts[l].Text); err != nil {
+				return nil, err
+			}
+		}
+		if err := page.Namespace.Parse(f.Name, f.Text); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// Files are the templates of a tree which are not text parsed in a
+// Namespace, but each parsed from its own file (e.g. workbooks), by name.
+type Files map[string]interface{}
+
+// ParseFiles parses with parse each file of dir with extension ext, as
+// found by Walk. It also returns the name of the first file in lexical
+// order, or "" if there are none.
+func ParseFiles(dir, ext string, parse func(path string) (interface{}, error)) (Files, string, error) {
+	files, err := Walk(dir, ext, "{{", "}}")
+	if err != nil {
+		return nil, "", err
+	}
+	t := make(Files, len(files))
+	for _, f := range files {
+		log.Println("found template", f.Name, ext)
+		v, err := parse(f.Path)
+		if err != nil {
+			return nil, "", err
+		}
+		t[f.Name] = v
+	}
+	if len(files) == 0 {
+		return t, "", nil
+	}
+	return t, files[0].Name, nil
+}
+
+// File is a template file of a tree.
+type File struct {
+	Name       string            // template name: slash separated path relative to the tree root, without extension, e.g. "/name/:id"
+	Path       string            // file path
+	Text       string            // template text, without directives
+	Directives map[string]string // directives, by lowercase key
+}
+
+// Walk walks recursively the files of dir, and returns the ones with
+// the given extension, in lexical order. The names ignored by Ignored
+// are skipped.
+func Walk(dir, ext string, leftDelim, rightDelim string) ([]File, error) {
+	var files []File
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && Ignored(fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || filepath.Ext(path) != ext {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = strings.TrimSuffix(name, ext)
+		name = gopath.Clean("/" + filepath.ToSlash(name))
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		text, directives := Directives(string(b), leftDelim, rightDelim)
+		files = append(files, File{
+			Name:       name,
+			Path:       path,
+			Text:       text,
+			Directives: directives,
+		})
+		return nil
+	})
+	return files, err
+}
+
+// Exts returns the sorted list of file extensions found recursively in
+// dir. Files without extension, and the names ignored by Ignored, are
+// not taken into account.
+func Exts(dir string) ([]string, error) {
+	seen := make(map[string]bool)
+	var exts []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && Ignored(fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(fi.Name()); ext != "" && !seen[ext] {
+			seen[ext] = true
+			exts = append(exts, ext)
+		}
+		return nil
+	})
+	sort.Strings(exts)
+	return exts, err
+}
+
+// Ignored reports whether the file or directory name is not part of a
+// tree: hidden names (e.g. ".git"), and the backup, patch and lock files
+// of editors, version control and office applications ("name~",
+// "#name#", "name.bak", "name.orig", "name.rej", "name.swp",
+// "~$name.xlsx").
+func Ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") ||
+		strings.HasPrefix(name, "~$") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	switch filepath.Ext(name) {
+	case ".bak", ".orig", ".rej", ".swp":
+		return true
+	}
+	return false
+}
+
+func directiveRE(left, right string) *regexp.Regexp {
+	return regexp.MustCompile(`^\s*` + regexp.QuoteMeta(left) +
+		`-?\s*/\*\s*([A-Za-z][\w-]*)\s*:\s*(.*?)\s*\*/\s*-?` +
+		regexp.QuoteMeta(right) + `[ \t]*(\r?\n)?`)
+}
+
+// Directives parses the directives at the start of text, and returns
+// text without them.
+func Directives(text, leftDelim, rightDelim string) (string, map[string]string) {
+	directives := make(map[string]string)
+	re := directiveRE(leftDelim, rightDelim)
+	for {
+		m := re.FindStringSubmatchIndex(text)
+		if m == nil {
+			return text, directives
+		}
+		key := strings.ToLower(text[m[2]:m[3]])
+		directives[key] = text[m[4]:m[5]]
+		text = text[m[1]:]
+	}
+}
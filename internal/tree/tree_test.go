@@ -0,0 +1,160 @@
+package tree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectives(t *testing.T) {
+	in := "{{/* Content-Type: application/xml */}}\n{{- /* layout: base */ -}}\r\n<a/>\n"
+	text, d := Directives(in, "{{", "}}")
+	if text != "<a/>\n" {
+		t.Errorf("text %q; want %q", text, "<a/>\n")
+	}
+	if d[ContentType] != "application/xml" || d[Layout] != "base" {
+		t.Errorf("directives %v", d)
+	}
+	text, d = Directives("{{/* a comment */}}\n", "{{", "}}")
+	if len(d) != 0 || text != "{{/* a comment */}}\n" {
+		t.Errorf("comment taken as directive: %q, %v", text, d)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"_partials/nav.html":   "nav",
+		"_layouts/base.html":   "base",
+		"name/:id.html":        "{{/* layout: base */}}\npage",
+		"name/_default.html":   "default",
+		"name/:id.json":        "json",
+		"_partials/sub/a.html": "a",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, err := Read(dir, ".html", "{{", "}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(files []File) []string {
+		var s []string
+		for _, f := range files {
+			s = append(s, f.Name)
+		}
+		return s
+	}
+	if got := names(tr.Pages); len(got) != 2 || got[0] != "/name/:id" || got[1] != "/name/_default" {
+		t.Errorf("pages %v", got)
+	}
+	if got := names(tr.Partials); len(got) != 2 || got[0] != "nav" || got[1] != "sub/a" {
+		t.Errorf("partials %v", got)
+	}
+	if l, ok := tr.Layouts["base"]; !ok || l.Text != "base" {
+		t.Errorf("layouts %v", tr.Layouts)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "bad.html"), []byte("{{/* layout: nope */}}"), 0644)
+	if _, err := Read(dir, ".html", "{{", "}}"); err == nil {
+		t.Error("no error for unknown layout")
+	}
+}
+
+// recorder is a Namespace recording the definitions parsed in it.
+type recorder []string
+
+func (r *recorder) Parse(name, text string) error {
+	*r = append(*r, name+"="+text)
+	return nil
+}
+
+func (r *recorder) Clone() (Namespace, error) {
+	c := append(recorder(nil), *r...)
+	return &c, nil
+}
+
+func TestParse(t *testing.T) {
+	tr := &Tree{
+		Partials: []File{{Name: "nav", Text: "n"}},
+		Layouts:  map[string]File{"base": {Name: "base", Text: "b"}},
+		Pages: []File{
+			{Name: "/a", Text: "a"},
+			{Name: "/b", Text: "x", Directives: map[string]string{Layout: "base"}},
+		},
+	}
+	ns := &recorder{}
+	pages, err := tr.Parse(ns, ".html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		main string
+		defs string
+	}{
+		{"/a", "[nav=n /a=a]"},
+		{"_layouts/base", "[nav=n _layouts/base=b /b=x]"},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("%d pages; want %d", len(pages), len(want))
+	}
+	for i, p := range pages {
+		if p.Main != want[i].main {
+			t.Errorf("page %s: main %q; want %q", p.Name, p.Main, want[i].main)
+		}
+		if got := fmt.Sprint(*p.Namespace.(*recorder)); got != want[i].defs {
+			t.Errorf("page %s: parsed %s; want %s", p.Name, got, want[i].defs)
+		}
+	}
+	if got := fmt.Sprint(*ns); got != "[nav=n]" {
+		t.Errorf("partials namespace %s; want [nav=n]", got)
+	}
+}
+
+func TestExts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"page.html",
+		"name/:id.json",
+		"page.html~",
+		"page.html.orig",
+		"page.bak",
+		"#page.txt#",
+		"~$report.xlsx",
+		".hidden.csv",
+		".git/hooks/commit.sample",
+		".git/objects/pack/x.pack",
+		"README",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exts, err := Exts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(exts); got != "[.html .json]" {
+		t.Errorf("Exts = %s; want [.html .json]", got)
+	}
+}
@@ -0,0 +1,104 @@
+package sql2http
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// DefaultExt is the file extension of the template used when a request
+// specifies neither a file extension nor an Accept header.
+const DefaultExt = ".html"
+
+// mediaRange is a single element of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the value of an Accept header (RFC 7231 section
+// 5.3.2). Invalid elements are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, s := range strings.Split(accept, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		mt, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+		i := strings.IndexByte(mt, '/')
+		if i < 0 {
+			continue
+		}
+		r := mediaRange{typ: mt[:i], subtype: mt[i+1:], q: 1}
+		if q, ok := params["q"]; ok {
+			f, err := strconv.ParseFloat(q, 64)
+			if err != nil || f < 0 || f > 1 {
+				continue
+			}
+			r.q = f
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// quality returns the quality factor given by ranges to content type
+// ct, and the specificity of the matching range (0 for */*, 1 for
+// type/*, 2 for type/subtype). It returns -1, -1 if no range matches.
+func quality(ranges []mediaRange, ct string) (q float64, specificity int) {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return -1, -1
+	}
+	i := strings.IndexByte(mt, '/')
+	if i < 0 {
+		return -1, -1
+	}
+	typ, subtype := mt[:i], mt[i+1:]
+	q, specificity = -1, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q, specificity
+}
+
+// negotiate returns the extension of the template of ts best matching
+// the Accept header value. Ties are resolved in favour of the most
+// specific match, then of DefaultExt, then of the first extension in
+// lexical order. An empty Accept header selects DefaultExt.
+//
+// It returns false if no template is acceptable.
+func negotiate(accept string, ts *TemplateSet) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return DefaultExt, true
+	}
+	ranges := parseAccept(accept)
+	best, bestQ, bestS := "", 0.0, -1
+	for _, ext := range ts.Exts() {
+		q, s := quality(ranges, ts.Get(ext).ContentType())
+		if q <= 0 {
+			continue
+		}
+		switch {
+		case q > bestQ, q == bestQ && s > bestS,
+			q == bestQ && s == bestS && ext == DefaultExt:
+			best, bestQ, bestS = ext, q, s
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,42 @@
+package sql2http
+
+import (
+	"io"
+	"testing"
+)
+
+type nopExecuter struct{}
+
+func (nopExecuter) Execute(io.Writer, interface{}) error { return nil }
+
+var negotiateTests = []struct {
+	accept string
+	want   string // empty if not acceptable
+}{
+	{"", ".html"},
+	{"*/*", ".html"},
+	{"application/json", ".json"},
+	{"application/json;q=0.5, text/csv", ".csv"},
+	{"text/*", ".html"},
+	{"text/*;q=0.5, text/csv;q=0.6", ".csv"},
+	{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", ".html"},
+	{"text/html;q=0, */*", ".csv"},
+	{"image/png", ""},
+	{"application/json;q=0", ""},
+}
+
+func TestNegotiate(t *testing.T) {
+	ts := &TemplateSet{}
+	ts.Register(".csv", TemplateFromExecuter(nopExecuter{}, "text/csv"))
+	ts.Register(".html", TemplateFromExecuter(nopExecuter{}, "text/html; charset=utf-8"))
+	ts.Register(".json", TemplateFromExecuter(nopExecuter{}, "application/json; charset=utf-8"))
+	for _, tc := range negotiateTests {
+		got, ok := negotiate(tc.accept, ts)
+		if !ok {
+			got = ""
+		}
+		if got != tc.want {
+			t.Errorf("Accept %q: got %q; want %q", tc.accept, got, tc.want)
+		}
+	}
+}
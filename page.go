@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -29,6 +30,8 @@ type page struct {
 	// registered http method.
 	fn func(context.Context, *sql.DB, *Result) error
 	db *sql.DB // the database connection
+	driver string // the database driver name, as given to sql.Open
+	method string // the registered http method
 }
 
 // runQueries runs the list of res.Queries in a single transaction. Then
@@ -61,6 +64,12 @@ func runQueries(ctx context.Context, db *sql.DB, res *Result) error {
 	return tx.Commit()
 }
 
+// noQueries runs no query. It is the page.fn of the form of a POST page,
+// served upon GET requests (see Router.SqlPOSTForm).
+func noQueries(ctx context.Context, db *sql.DB, res *Result) error {
+	return nil
+}
+
 // runExecs runs the list of res.Queries in a single transaction.
 //
 // page.fn is set to runExecs if the page is registered as a POST handler.
@@ -93,36 +102,66 @@ func prepareParams(q Query, p map[string]interface{}) []interface{} {
 // returned rows from a Query, and takes care of closing it once done.
 func readRows(tbl *Table, rows *sql.Rows) error {
 	defer rows.Close()
-	var err error
-	tbl.Header, err = rows.Columns()
-	if err != nil {
+	if err := readColumns(tbl, rows); err != nil {
 		return err
 	}
-	rowptr := make([]interface{}, len(tbl.Header))
 	for rows.Next() {
-		row := Row{
-			Header: tbl.Header,
-			Values: make([]interface{}, len(tbl.Header)),
-		}
-		for i := range rowptr {
-			rowptr[i] = &row.Values[i]
-		}
-		if err := rows.Scan(rowptr...); err != nil {
+		row, err := scanRow(tbl, rows)
+		if err != nil {
 			return err
 		}
-		for i, v := range row.Values {
-			if p, ok := v.([]byte); ok {
-				row.Values[i] = string(p)
-			}
-		}
 		tbl.Rows = append(tbl.Rows, row)
 	}
 	return rows.Err()
 }
 
+// readColumns sets the Header and Types of tbl from rows.
+func readColumns(tbl *Table, rows *sql.Rows) error {
+	var err error
+	tbl.Header, err = rows.Columns()
+	if err != nil {
+		return err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	tbl.Types = make([]string, len(types))
+	for i, t := range types {
+		tbl.Types[i] = t.DatabaseTypeName()
+	}
+	return nil
+}
+
+// scanRow returns the current row of rows, whose columns are the ones of
+// tbl.
+func scanRow(tbl *Table, rows *sql.Rows) (Row, error) {
+	row := Row{
+		Header: tbl.Header,
+		Values: make([]interface{}, len(tbl.Header)),
+	}
+	rowptr := make([]interface{}, len(tbl.Header))
+	for i := range rowptr {
+		rowptr[i] = &row.Values[i]
+	}
+	if err := rows.Scan(rowptr...); err != nil {
+		return row, err
+	}
+	for i, v := range row.Values {
+		if p, ok := v.([]byte); ok {
+			row.Values[i] = string(p)
+		}
+	}
+	return row, nil
+}
+
 // ServeHTTP implements http.Handler
 func (p *page) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
-	tmpl, err := p.lookupTemplate(req)
+	tmpl, err := p.lookupTemplate(wr, req)
+	if err == errNotAcceptable {
+		http.Error(wr, "no acceptable template found", http.StatusNotAcceptable)
+		return
+	}
 	if err != nil {
 		// TODO: log error
 		http.Error(wr, "no template found", http.StatusNotFound)
@@ -132,9 +171,18 @@ func (p *page) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
 		Pattern: p.pattern,
 		Params:  getParams(req),
 		Queries: p.queries,
-		Request: Request{req.URL, req.Method, req.Header},
+		Request: Request{req.URL, req.Method, req.Header, req.Host},
 		Time:    time.Now(),
 		Version: version,
+		Driver:  p.driver,
+		method:  p.method,
+
+		Templates: p.templates,
+		Context:   req.Context(),
+	}
+	if st, ok := tmpl.(StreamTemplate); ok && p.method == http.MethodGet {
+		p.serveStream(wr, req, st, data)
+		return
 	}
 	if err := p.fn(req.Context(), p.db, data); err != nil {
 		http.Error(wr, "error querying the database: " + err.Error(), http.StatusInternalServerError)
@@ -148,11 +196,66 @@ func (p *page) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
 		http.Error(wr, "error executing the template: " + err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if h, ok := tmpl.(HeaderTemplate); ok {
+		h.SetHeader(wr.Header(), data)
+	}
 	if _, err := io.Copy(wr, buf); err != nil {
 		log.Println("ERROR", err)
 	}
 }
 
+// serveStream executes tmpl while running the queries of a GET page.
+func (p *page) serveStream(wr http.ResponseWriter, req *http.Request, tmpl StreamTemplate, data *Result) {
+	ctx := req.Context()
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: IsolationLevel,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		http.Error(wr, "error querying the database: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	tables := &TableStream{ctx: ctx, tx: tx, queries: data.Queries, params: data.Params}
+	if ct := tmpl.ContentType(); ct != "" {
+		wr.Header().Set("Content-Type", ct)
+	}
+	if h, ok := tmpl.(HeaderTemplate); ok {
+		h.SetHeader(wr.Header(), data)
+	}
+	w := &startWriter{w: wr}
+	err = tmpl.ExecuteStream(w, data, tables)
+	tables.close()
+	if err == nil {
+		err = tables.Err()
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err == nil {
+		return
+	}
+	if !w.started {
+		wr.Header().Del("Content-Disposition")
+		http.Error(wr, "error executing the template: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Println("ERROR", req.URL, err)
+}
+
+// startWriter records whether anything was written to w.
+type startWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (w *startWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.started = true
+	}
+	return w.w.Write(p)
+}
+
 func getParams(req *http.Request) map[string]interface{} {
 	params := make(map[string]interface{})
 	req.ParseForm()
@@ -165,10 +268,20 @@ func getParams(req *http.Request) map[string]interface{} {
 	return params
 }
 
-func (p *page) lookupTemplate(req *http.Request) (Template, error) {
+var errNotAcceptable = errors.New("no acceptable template")
+
+// lookupTemplate returns the template to use for req: the one of the
+// request file extension if any, else the one negotiated with the
+// Accept header (in which case the Vary header is set on wr).
+func (p *page) lookupTemplate(wr http.ResponseWriter, req *http.Request) (Template, error) {
 	ext, _ := req.Context().Value(extKey).(string)
 	if ext == "" {
-		ext = ".html"
+		wr.Header().Add("Vary", "Accept")
+		var ok bool
+		ext, ok = negotiate(req.Header.Get("Accept"), p.templates)
+		if !ok {
+			return nil, errNotAcceptable
+		}
 	}
 	tmpl := p.templates.Get(ext)
 	if tmpl == nil {
@@ -185,10 +298,34 @@ type Result struct {
 	Request Request
 	Time    time.Time // when the request was made
 	Version string    // this package's version
+	Driver  string    // the database driver name, e.g. "sqlite3"
+
+	// Templates are the templates of the page, for templates executing
+	// other ones (e.g. to convert their output).
+	Templates *TemplateSet `json:"-"`
+
+	// Context is the context of the request, cancelled when the client
+	// goes away, for templates doing long work (e.g. running commands).
+	Context context.Context `json:"-"`
+
+	method string // the http method of the page, see Form
+}
+
+// Option returns the request option name of the templates of package
+// pkg (e.g. "csv"): the value of the URL query parameter "_pkg.name",
+// e.g. "_csv.header". Options are read neither from the path parameters
+// nor from the form values, so that they never collide with the SQL
+// parameters of the page (see Params).
+func (r *Result) Option(pkg, name string) string {
+	if r.Request.URL == nil {
+		return ""
+	}
+	return r.Request.URL.Query().Get("_" + pkg + "." + name)
 }
 
 type Request struct {
 	URL    *url.URL
 	Method string
 	Header http.Header
+	Host   string // the host requested by the client, see http.Request.Host
 }
@@ -18,22 +18,27 @@ import (
 //     `base`.yaml: YAML based configuration format
 //
 // However if both files exist, an error is returned.
-func parseConfig(base string, mux *sql2http.Router) error {
+//
+// The templates found under `base`.template/ are returned, for reloading.
+func parseConfig(base string, mux *sql2http.Router) (*Templates, error) {
 	fileCONF := base + ".conf"
 	fileYAML := base + ".yaml"
 	_, errCONF := os.Stat(fileCONF)
 	_, errYAML := os.Stat(fileYAML)
 	if errCONF == nil && errYAML == nil {
-		return fmt.Errorf("both %v and %v config files exist", fileCONF, fileYAML)
+		return nil, fmt.Errorf("both %v and %v config files exist", fileCONF, fileYAML)
+	}
+	tmpls, err := parseTemplates(base+".template", nil)
+	if err != nil {
+		return nil, err
 	}
-	tmpls := parseTemplates(base + ".template")
 	if errCONF == nil {
-		return parseCONF(fileCONF, mux, tmpls)
+		return tmpls, parseCONF(fileCONF, mux, tmpls)
 	}
 	if errYAML == nil {
-		return parseYAML(fileYAML, mux, tmpls)
+		return tmpls, parseYAML(fileYAML, mux, tmpls)
 	}
-	return fmt.Errorf("config file not found (looking for %v or %v)", fileCONF, fileYAML)
+	return nil, fmt.Errorf("config file not found (looking for %v or %v)", fileCONF, fileYAML)
 }
 
 func parseCONF(file string, mux *sql2http.Router, templates *Templates) error {
@@ -142,13 +147,17 @@ func (p *parser) register() error {
 		p.queries[len(p.queries)-1].Q = p.query.String()
 		p.query.Reset()
 	}
+	ts, err := p.tmpls.PageTemplateSet(p.path, nil)
+	if err != nil {
+		return err
+	}
 	switch p.method {
 	case "GET":
 		log.Printf("GET  %q %+q\n", p.path, p.queries)
-		p.SqlGET(p.path, p.queries, p.tmpls.GetTemplateSet(p.path))
+		p.SqlGET(p.path, p.queries, ts)
 	case "POST":
 		log.Printf("POST %q %+q\n", p.path, p.queries)
-		p.SqlPOST(p.path, p.queries, p.tmpls.GetTemplateSet(p.path))
+		p.SqlPOST(p.path, p.queries, ts)
 	default:
 		return fmt.Errorf("invalid HTTP method %v", p.method)
 	}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"mime"
+	"strings"
+	"time"
 
 	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/template/filter"
 	"gopkg.in/yaml.v2"
 )
 
@@ -13,10 +17,22 @@ type yamlConf struct {
 		Driver  string
 		Options string
 	}
+	Format     string              // template selection: extension, query or accept
+	Extensions []string            // template file extensions of unknown content types
+	Filters    map[string]struct { // by virtual extension, e.g. ".pdf"
+		Template    string
+		Command     []string
+		Dir         string
+		Timeout     string // a time.Duration, e.g. "30s"
+		ContentType string `yaml:"content-type"`
+		Concurrency int
+	}
 	Pages []struct {
-		Pattern string
-		Method  string
-		Queries yaml.MapSlice
+		Pattern   string
+		Method    string
+		Queries   yaml.MapSlice
+		Templates map[string]map[string]string // options by template extension
+		Form      bool                         // POST pages: show the form on GET
 	}
 }
 
@@ -34,6 +50,33 @@ func parseYAML(file string, mux *sql2http.Router, templates *Templates) error {
 		return err
 	}
 	*mux = *m
+	if conf.Format != "" {
+		if err := mux.Format.Set(conf.Format); err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+	}
+	if err := templates.AddExts(conf.Extensions...); err != nil {
+		return fmt.Errorf("%v:extensions: %v", file, err)
+	}
+	for ext, f := range conf.Filters {
+		t, err := parseFilter(ext, f.Template, f.Command, f.Timeout)
+		if err != nil {
+			return fmt.Errorf("%v:filters:%v: %v", file, ext, err)
+		}
+		t.Dir, t.Type, t.Concurrency = f.Dir, f.ContentType, f.Concurrency
+		if t.Type == "" {
+			t.Type = mime.TypeByExtension(ext)
+		}
+		// filters may execute other filters, but not themselves
+		seen := map[string]bool{ext: true}
+		for next := f.Template; next != ""; next = conf.Filters[next].Template {
+			if seen[next] {
+				return fmt.Errorf("%v:filters:%v: filter executing itself through %q", file, ext, next)
+			}
+			seen[next] = true
+		}
+		templates.AddFilter(ext, t)
+	}
 	for _, page := range conf.Pages {
 		if page.Pattern == "" {
 			return fmt.Errorf("%v: pages.pattern must be non-empty; found %q", file, page.Pattern)
@@ -50,14 +93,47 @@ func parseYAML(file string, mux *sql2http.Router, templates *Templates) error {
 				return fmt.Errorf("%v:%v:%v: invalid SQL query", file, page.Pattern, queries[i].Name)
 			}
 		}
-		switch page.Method {
-		case "GET":
-			mux.SqlGET(page.Pattern, queries, templates.GetTemplateSet(page.Pattern))
-		case "POST":
-			mux.SqlPOST(page.Pattern, queries, templates.GetTemplateSet(page.Pattern))
+		ts, err := templates.PageTemplateSet(page.Pattern, page.Templates)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", file, page.Pattern, err)
+		}
+		if page.Form && page.Method != "POST" {
+			return fmt.Errorf("%v:%v: form is only valid for POST pages", file, page.Pattern)
+		}
+		switch {
+		case page.Method == "GET":
+			mux.SqlGET(page.Pattern, queries, ts)
+		case page.Method == "POST" && page.Form:
+			mux.SqlPOSTForm(page.Pattern, queries, ts)
+		case page.Method == "POST":
+			mux.SqlPOST(page.Pattern, queries, ts)
 		default:
 			return fmt.Errorf("%v:%v: invalid method %q", file, page.Pattern, page.Method)
 		}
 	}
 	return nil
 }
+
+// parseFilter returns the filter template of the virtual extension ext,
+// executing the template of extension tmpl and piping it through
+// command.
+func parseFilter(ext, tmpl string, command []string, timeout string) (*filter.Template, error) {
+	if !strings.HasPrefix(ext, ".") || !strings.HasPrefix(tmpl, ".") {
+		return nil, fmt.Errorf("extensions must start with a dot")
+	}
+	if ext == tmpl {
+		return nil, fmt.Errorf("template must differ from the filter extension")
+	}
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("command must be non-empty")
+	}
+	t := &filter.Template{Template: tmpl, Command: command}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", timeout)
+		}
+		t.Timeout = d
+	}
+	return t, nil
+}
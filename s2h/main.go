@@ -6,13 +6,25 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"git.sr.ht/~detaoin/sql2http"
+	_ "git.sr.ht/~detaoin/sql2http/template/bundle"
+	_ "git.sr.ht/~detaoin/sql2http/template/cbor"
+	_ "git.sr.ht/~detaoin/sql2http/template/chart"
 	_ "git.sr.ht/~detaoin/sql2http/template/csv"
+	_ "git.sr.ht/~detaoin/sql2http/template/feed"
+	_ "git.sr.ht/~detaoin/sql2http/template/geojson"
 	_ "git.sr.ht/~detaoin/sql2http/template/html"
+	_ "git.sr.ht/~detaoin/sql2http/template/ics"
 	_ "git.sr.ht/~detaoin/sql2http/template/json"
+	_ "git.sr.ht/~detaoin/sql2http/template/msgpack"
+	_ "git.sr.ht/~detaoin/sql2http/template/ods"
+	_ "git.sr.ht/~detaoin/sql2http/template/pdf"
+	_ "git.sr.ht/~detaoin/sql2http/template/sql"
 	_ "git.sr.ht/~detaoin/sql2http/template/tex"
 	_ "git.sr.ht/~detaoin/sql2http/template/xlsx"
+	_ "git.sr.ht/~detaoin/sql2http/template/yaml"
 )
 
 var (
@@ -27,11 +39,29 @@ func main() {
 	}
 	flag.StringVar(&addr, "http", addr, "address to expose the http service")
 	flag.StringVar(&base, "c", base, "configuration files basename")
+	format := flag.String("format", "", "template selection: extension, query or accept (overrides the config file)")
+	watch := flag.Bool("watch", true, "reload the templates when their files change")
+	poll := flag.Duration("poll", 2*time.Second, "polling interval of the templates, if file system notifications are unavailable")
 	flag.Parse()
 	mux := &sql2http.Router{}
-	if err := parseConfig(base, mux); err != nil {
+	tmpls, err := parseConfig(base, mux)
+	if err != nil {
 		log.Fatalln(err)
 	}
+	if *watch {
+		watchTemplates(tmpls.dir, *poll, func() {
+			if err := tmpls.Reload(); err != nil {
+				log.Println("templates not reloaded:", err)
+				return
+			}
+			log.Println("templates reloaded")
+		})
+	}
+	if *format != "" {
+		if err := mux.Format.Set(*format); err != nil {
+			log.Fatalln(err)
+		}
+	}
 	log.Println("db connected:", mux.Stats())
 	log.Fatalln(http.ListenAndServe(addr, mux))
 }
@@ -1,41 +1,291 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	gopath "path"
+	"reflect"
+	"strings"
+
 	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
 	"git.sr.ht/~detaoin/sql2http/template/html"
+	"git.sr.ht/~detaoin/sql2http/template/office"
 	"git.sr.ht/~detaoin/sql2http/template/tex"
+	"git.sr.ht/~detaoin/sql2http/template/text"
+	xlsx "git.sr.ht/~detaoin/sql2http/template/xlsx"
 )
 
 type Templates struct {
 	*sql2http.TemplateSet
-	htmlTree *html.Template
-	texTree  *tex.Template
+	dir   string                  // the templates directory
+	exts  map[string]bool         // other extensions to parse, see AddExts
+	trees map[string]templateTree // by file extension
+	pages []*pageTemplates        // the template sets of the registered pages
+
+	filters map[string]sql2http.Template // by virtual extension, see AddFilter
+}
+
+// pageTemplates is the TemplateSet of a registered page, with what is
+// needed to rebuild it when the template files change.
+type pageTemplates struct {
+	*sql2http.TemplateSet
+	pattern string
+	options map[string]map[string]string
+}
+
+// templateTree is a parsed tree of templates, as returned by the
+// ParseTree functions of the template packages.
+type templateTree interface {
+	// lookup returns the template with the given name, or nil.
+	lookup(name string) sql2http.Template
 }
 
-func parseTemplates(dir string) *Templates {
-	templates := &Templates{TemplateSet: sql2http.DefaultTemplateSet}
-	templates.htmlTree, _ = html.ParseTree(dir)
-	templates.texTree, _ = tex.ParseTree(dir)
-	if t := templates.htmlTree.Lookup("/_default"); t != nil {
-		templates.Register(html.Ext, t)
+// lookupFunc is the templateTree of the Lookup method of a parsed tree.
+// As the Lookup methods return nil pointers of their own template type
+// for unknown names, those are returned as nil.
+type lookupFunc func(name string) sql2http.Template
+
+func (f lookupFunc) lookup(name string) sql2http.Template {
+	tmpl := f(name)
+	if v := reflect.ValueOf(tmpl); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
 	}
-	if t := templates.texTree.Lookup("/_default"); t != nil {
-		templates.Register(tex.Ext, t)
+	return tmpl
+}
+
+// htmlExts are the file extensions of the templates parsed with
+// html/template; all others but ".tex" and the binary documents
+// (".xlsx", ".docx", ".odt") are parsed with text/template.
+var htmlExts = map[string]bool{
+	".html":  true,
+	".htm":   true,
+	".xhtml": true,
+}
+
+// parseTree parses the templates of dir having extension ext, using the
+// template package suited for ext.
+func parseTree(dir, ext string) (templateTree, error) {
+	switch {
+	case ext == tex.Ext:
+		t, err := tex.ParseTree(dir)
+		return lookupFunc(func(name string) sql2http.Template { return t.Lookup(name) }), err
+	case htmlExts[ext]:
+		t, err := html.ParseTreeExt(dir, ext)
+		return lookupFunc(func(name string) sql2http.Template { return t.Lookup(name) }), err
+	case ext == xlsx.Ext:
+		t, err := xlsx.ParseTree(dir)
+		return lookupFunc(func(name string) sql2http.Template { return t.Lookup(name) }), err
+	case ext == office.DOCX || ext == office.ODT:
+		t, err := office.ParseTree(dir, ext)
+		return lookupFunc(func(name string) sql2http.Template { return t.Lookup(name) }), err
+	default:
+		t, err := text.ParseTree(dir, ext)
+		return lookupFunc(func(name string) sql2http.Template { return t.Lookup(name) }), err
 	}
-	return templates
 }
 
-func (tmpls *Templates) GetTemplateSet(pattern string) *sql2http.TemplateSet {
-	ts := tmpls.TemplateSet
-	if t := tmpls.htmlTree.Lookup(pattern); t != nil {
-		ts = ts.Clone()
-		ts.Register(html.Ext, t)
+// knownExt reports whether ext is the extension of a known content type,
+// or of a compiled-in template.
+func knownExt(ext string) bool {
+	return mime.TypeByExtension(ext) != "" || sql2http.DefaultTemplateSet.Get(ext) != nil
+}
+
+// parseTemplates parses the template files under dir whose extension is
+// known (see knownExt), or is one of exts. A missing dir is not an
+// error.
+func parseTemplates(dir string, exts map[string]bool) (*Templates, error) {
+	templates := &Templates{
+		TemplateSet: sql2http.DefaultTemplateSet,
+		dir:         dir,
+		exts:        exts,
+		trees:       make(map[string]templateTree),
+	}
+	found, err := tree.Exts(dir)
+	if os.IsNotExist(err) {
+		return templates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range found {
+		if !knownExt(ext) && !exts[ext] {
+			log.Println("ignoring template files of unknown extension", ext)
+			continue
+		}
+		t, err := parseTree(dir, ext)
+		if err != nil {
+			return nil, err
+		}
+		templates.trees[ext] = t
+	}
+	for ext, t := range templates.trees {
+		if tmpl := t.lookup("/_default"); tmpl != nil {
+			templates.register(ext, tmpl)
+		}
+	}
+	return templates, nil
+}
+
+// AddExts parses the template files of the given extensions, which
+// are not known content types (see parseTemplates), and keeps them on
+// Reload.
+func (tmpls *Templates) AddExts(exts ...string) error {
+	if tmpls.exts == nil {
+		tmpls.exts = make(map[string]bool)
+	}
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("extension %q must start with a dot", ext)
+		}
+		tmpls.exts[ext] = true
+		if _, ok := tmpls.trees[ext]; ok {
+			continue
+		}
+		t, err := parseTree(tmpls.dir, ext)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		tmpls.trees[ext] = t
+		if tmpl := t.lookup("/_default"); tmpl != nil {
+			tmpls.register(ext, tmpl)
+		}
+	}
+	return nil
+}
+
+// AddFilter registers t for the extension ext in the templates of all
+// the pages registered afterwards, and keeps it on Reload. It is used
+// for the filters of the configuration, which execute other templates
+// of the page (see package template/filter).
+func (tmpls *Templates) AddFilter(ext string, t sql2http.Template) {
+	if tmpls.filters == nil {
+		tmpls.filters = make(map[string]sql2http.Template)
+	}
+	tmpls.filters[ext] = t
+	tmpls.register(ext, t)
+}
+
+// register registers t for ext, without changing DefaultTemplateSet.
+func (tmpls *Templates) register(ext string, t sql2http.Template) {
+	if tmpls.TemplateSet == sql2http.DefaultTemplateSet {
+		tmpls.TemplateSet = tmpls.Clone()
 	}
-	if t := tmpls.texTree.Lookup(pattern); t != nil {
-		if ts == tmpls.TemplateSet {
-			ts = ts.Clone()
+	tmpls.Register(ext, t)
+}
+
+// GetTemplateSet returns a new TemplateSet for the page pattern: the
+// default templates, overridden by the template files of the pattern
+// (see lookupTemplate), except for the extensions of filters.
+func (tmpls *Templates) GetTemplateSet(pattern string) *sql2http.TemplateSet {
+	ts := tmpls.Clone()
+	for ext, t := range tmpls.trees {
+		if _, ok := tmpls.filters[ext]; ok {
+			continue
+		}
+		if tmpl := lookupTemplate(t, pattern); tmpl != nil {
+			ts.Register(ext, tmpl)
 		}
-		ts.Register(tex.Ext, t)
 	}
 	return ts
 }
+
+// lookupTemplate returns the template of t for the page pattern: the
+// one named like the pattern, or else the nearest "_default" template
+// walking up the pattern directories. For example with pattern
+// /admin/users/:id, the templates looked up are in order:
+//
+//     /admin/users/:id
+//     /admin/users/_default
+//     /admin/_default
+//     /_default
+//
+// It returns nil if none exists.
+func lookupTemplate(t templateTree, pattern string) sql2http.Template {
+	if tmpl := t.lookup(pattern); tmpl != nil {
+		return tmpl
+	}
+	for dir := gopath.Dir(pattern); ; dir = gopath.Dir(dir) {
+		if tmpl := t.lookup(gopath.Join(dir, "_default")); tmpl != nil {
+			return tmpl
+		}
+		if dir == "/" || dir == "." {
+			return nil
+		}
+	}
+}
+
+// PageTemplateSet returns the TemplateSet of a page to be registered
+// with the given pattern and template options (see configureTemplates).
+//
+// The returned TemplateSet is updated in place by Reload.
+func (tmpls *Templates) PageTemplateSet(pattern string, options map[string]map[string]string) (*sql2http.TemplateSet, error) {
+	ts, err := configureTemplates(tmpls.GetTemplateSet(pattern), options)
+	if err != nil {
+		return nil, err
+	}
+	tmpls.pages = append(tmpls.pages, &pageTemplates{
+		TemplateSet: ts,
+		pattern:     pattern,
+		options:     options,
+	})
+	return ts, nil
+}
+
+// Reload parses again all the template files, and updates the template
+// sets of the registered pages.
+//
+// If a template fails to parse, or a page fails to be configured, an
+// error is returned and the previous templates are kept.
+func (tmpls *Templates) Reload() error {
+	t, err := parseTemplates(tmpls.dir, tmpls.exts)
+	if err != nil {
+		return err
+	}
+	for ext, f := range tmpls.filters {
+		t.AddFilter(ext, f)
+	}
+	sets := make([]*sql2http.TemplateSet, len(tmpls.pages))
+	for i, p := range tmpls.pages {
+		sets[i], err = configureTemplates(t.GetTemplateSet(p.pattern), p.options)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.pattern, err)
+		}
+	}
+	for i, p := range tmpls.pages {
+		p.Swap(sets[i])
+	}
+	tmpls.TemplateSet, tmpls.trees = t.TemplateSet, t.trees
+	return nil
+}
+
+// configureTemplates returns ts with the templates listed in options
+// replaced by their configured version (see sql2http.Configurer). The
+// options are keyed by template file extension.
+func configureTemplates(ts *sql2http.TemplateSet, options map[string]map[string]string) (*sql2http.TemplateSet, error) {
+	if len(options) == 0 {
+		return ts, nil
+	}
+	ts = ts.Clone()
+	for ext, opts := range options {
+		t := ts.Get(ext)
+		if t == nil {
+			return nil, fmt.Errorf("no template for %q", ext)
+		}
+		c, ok := t.(sql2http.Configurer)
+		if !ok {
+			return nil, fmt.Errorf("template %q has no options", ext)
+		}
+		t, err := c.Configure(opts)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %v", ext, err)
+		}
+		ts.Register(ext, t)
+	}
+	return ts, nil
+}
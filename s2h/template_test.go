@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/template/csv"
+)
+
+// nameTemplate is a template which writes its name.
+type nameTemplate string
+
+func (t nameTemplate) Execute(wr io.Writer, data interface{}) error {
+	_, err := io.WriteString(wr, string(t))
+	return err
+}
+
+func (t nameTemplate) ContentType() string { return "text/plain" }
+
+// mapTree is a templateTree of nameTemplates.
+type mapTree map[string]bool
+
+func (t mapTree) lookup(name string) sql2http.Template {
+	if t[name] {
+		return nameTemplate(name)
+	}
+	return nil
+}
+
+func TestLookupTemplate(t *testing.T) {
+	tree := mapTree{
+		"/_default":              true,
+		"/admin/_default":        true,
+		"/admin/users/:id":       true,
+		"/reports/_default":      true,
+		"/reports/2020/_default": true,
+	}
+	tests := []struct {
+		pattern string
+		want    string // empty if none
+	}{
+		{"/", "/_default"},
+		{"/home", "/_default"},
+		{"/admin", "/_default"},
+		{"/admin/users/:id", "/admin/users/:id"},
+		{"/admin/users/:id/edit", "/admin/_default"},
+		{"/admin/groups", "/admin/_default"},
+		{"/reports/2020/q1", "/reports/2020/_default"},
+		{"/reports/2021/q1", "/reports/_default"},
+	}
+	for _, tt := range tests {
+		got := lookupTemplate(tree, tt.pattern)
+		if got == nil || string(got.(nameTemplate)) != tt.want {
+			t.Errorf("lookupTemplate(%q) = %v; want %s", tt.pattern, got, tt.want)
+		}
+	}
+	if got := lookupTemplate(mapTree{"/admin/_default": true}, "/home"); got != nil {
+		t.Errorf("lookupTemplate(/home) = %v; want nil", got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, text string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("page.txt", "v1")
+
+	tmpls, err := parseTemplates(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpls.AddFilter(".up", nameTemplate("filter"))
+	options := map[string]map[string]string{".csv": {"header": "false"}}
+	page, err := tmpls.PageTemplateSet("/page", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := tmpls.PageTemplateSet("/other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(ts *sql2http.TemplateSet, ext string) string {
+		t.Helper()
+		tmpl := ts.Get(ext)
+		if tmpl == nil {
+			t.Fatalf("no %s template", ext)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, &sql2http.Result{}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	check := func(step, want string) {
+		t.Helper()
+		if got := execute(page, ".txt"); got != want {
+			t.Errorf("%s: page .txt = %q; want %q", step, got, want)
+		}
+		if got := execute(page, ".up"); got != "filter" {
+			t.Errorf("%s: page .up = %q; want filter", step, got)
+		}
+		if got := execute(other, ".up"); got != "filter" {
+			t.Errorf("%s: other .up = %q; want filter", step, got)
+		}
+		if c, ok := page.Get(".csv").(*csv.Template); !ok || !c.NoHeader {
+			t.Errorf("%s: page .csv options lost: %#v", step, page.Get(".csv"))
+		}
+		if c, ok := other.Get(".csv").(*csv.Template); !ok || c.NoHeader {
+			t.Errorf("%s: other .csv configured: %#v", step, other.Get(".csv"))
+		}
+	}
+	check("before reload", "v1")
+
+	write("page.txt", "v2")
+	write("_default.up", "not a filter")
+	if err := tmpls.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	check("after reload", "v2")
+
+	// a template failing to parse keeps the previous templates
+	write("page.txt", "{{if}}")
+	if err := tmpls.Reload(); err == nil {
+		t.Error("no error for an invalid template")
+	}
+	check("after failed reload", "v2")
+}
+
+func TestParseTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"page.txt":             "txt",
+		"page.s2hfoo":          "foo",
+		"page.txt~":            "{{if}}",
+		"page.bak":             "{{if}}",
+		"#page.txt#":           "{{if}}",
+		".git/hooks/x.sample":  "{{if}}",
+		".git/objects/x.pack":  "{{if}}",
+		"sub/.hidden/page.txt": "{{if}}",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpls, err := parseTemplates(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpls.trees) != 1 || tmpls.trees[".txt"] == nil {
+		t.Errorf("trees %v; want only .txt", tmpls.trees)
+	}
+	if tmpl := tmpls.trees[".txt"].lookup("/nope"); tmpl != nil {
+		t.Errorf("lookup(/nope) = %#v; want nil", tmpl)
+	}
+	if err := tmpls.AddExts(".s2hfoo"); err != nil {
+		t.Fatal(err)
+	}
+	if tmpls.trees[".s2hfoo"] == nil {
+		t.Error("no tree for the added extension")
+	}
+	if err := tmpls.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if tmpls.trees[".s2hfoo"] == nil {
+		t.Error("added extension lost on reload")
+	}
+}
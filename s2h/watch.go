@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settle is the delay between a change notification and the reload, so
+// that a set of files written together (e.g. by an editor or a
+// deployment) triggers a single reload.
+const settle = 200 * time.Millisecond
+
+// watchTemplates calls reload whenever the files under dir change. It
+// uses the file system notifications where available, and falls back
+// to polling dir every interval.
+func watchTemplates(dir string, interval time.Duration, reload func()) {
+	changed := make(chan struct{}, 1)
+	if err := watchEvents(dir, changed); err != nil {
+		log.Printf("watching %s: %v; polling every %v", dir, err, interval)
+		go poll(dir, interval, changed)
+	}
+	go func() {
+		for range changed {
+			time.Sleep(settle)
+			select {
+			case <-changed:
+			default:
+			}
+			reload()
+		}
+	}()
+}
+
+// notify sends on changed, unless a notification is already pending.
+func notify(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// poll notifies changed whenever the snapshot of dir changes, checking
+// every interval.
+func poll(dir string, interval time.Duration, changed chan<- struct{}) {
+	last := snapshot(dir)
+	for range time.Tick(interval) {
+		if s := snapshot(dir); s != last {
+			last = s
+			notify(changed)
+		}
+	}
+}
+
+// snapshot returns a summary of the files under dir: their names, sizes
+// and modification times.
+func snapshot(dir string) string {
+	var b strings.Builder
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %v\n", path, err)
+			return nil
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MODIFY |
+	syscall.IN_ATTRIB | syscall.IN_DELETE_SELF
+
+// watchEvents notifies changed upon inotify events on dir or any of its
+// subdirectories.
+func watchEvents(dir string, changed chan<- struct{}) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	// addWatches watches all directories; watching an already watched
+	// directory is harmless.
+	addWatches := func() error {
+		return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return err
+			}
+			_, err = syscall.InotifyAddWatch(fd, path, inotifyMask)
+			return err
+		})
+	}
+	if err := addWatches(); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				log.Printf("watching %s: read: %v", dir, err)
+				syscall.Close(fd)
+				return
+			}
+			if err := addWatches(); err != nil {
+				log.Printf("watching %s: %v", dir, err)
+			}
+			notify(changed)
+		}
+	}()
+	return nil
+}
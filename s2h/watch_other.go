@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// watchEvents is only implemented on linux; other systems use polling.
+func watchEvents(dir string, changed chan<- struct{}) error {
+	return errors.New("file system notifications not supported")
+}
@@ -1,10 +1,18 @@
 package sql2http
 
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 // Query represents a single query, with its name.
 type Query struct {
 	Name   string
 	Q      string
 	Params []string
+	Types  []string // declared SQL types of Params, e.g. "integer", or ""
 }
 
 // Row represents a row of query result. The Headers are present for
@@ -28,9 +36,18 @@ func (r Row) Get(key string) interface{} {
 type Table struct {
 	Name   string
 	Header []string
+	Types  []string // database type names of the columns, e.g. "VARCHAR"
 	Rows   []Row
 }
 
+// Type returns the database type name of column i, or "" if unknown.
+func (t Table) Type(i int) string {
+	if i < 0 || i >= len(t.Types) {
+		return ""
+	}
+	return t.Types[i]
+}
+
 type Tables []Table
 
 // Get returns the Table with given name. If it doesn't exist, and empty
@@ -43,3 +60,48 @@ func (t Tables) Get(name string) Table {
 	}
 	return Table{}
 }
+
+// maxSheetName is the maximum length of a sheet name accepted by
+// spreadsheet applications (Excel being the most restrictive).
+const maxSheetName = 31
+
+// SheetNames returns one sheet name per table, suitable for spreadsheet
+// outputs: forbidden characters ([]*?:/\) are replaced by '_', names are
+// truncated to 31 characters, empty names default to "default", and
+// duplicates (compared case-insensitively) get a " (n)" suffix.
+func (t Tables) SheetNames() []string {
+	names := make([]string, len(t))
+	seen := make(map[string]bool)
+	for i, tbl := range t {
+		base := sanitizeSheetName(tbl.Name)
+		name := base
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = truncateRunes(base, maxSheetName-len(suffix)) + suffix
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func sanitizeSheetName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]*?:/\`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, "'")
+	if s == "" {
+		s = "default"
+	}
+	return truncateRunes(s, maxSheetName)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
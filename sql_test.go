@@ -0,0 +1,28 @@
+package sql2http
+
+import "testing"
+
+func TestSheetNames(t *testing.T) {
+	tables := Tables{
+		{Name: ""},
+		{Name: "a/b:c"},
+		{Name: "Default"},
+		{Name: "a_b_c"},
+		{Name: "a very long table name which does not fit"},
+		{Name: "a very long table name which does not fit either"},
+	}
+	want := []string{
+		"default",
+		"a_b_c",
+		"Default (2)",
+		"a_b_c (2)",
+		"a very long table name which do",
+		"a very long table name whic (2)",
+	}
+	got := tables.SheetNames()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sheet %d: got %q; want %q", i, got[i], want[i])
+		}
+	}
+}
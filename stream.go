@@ -0,0 +1,139 @@
+package sql2http
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+)
+
+// StreamTemplate is implemented by Templates which can write their
+// output while the rows are read from the database, instead of from the
+// buffered Result.Tables, for example to export large tables.
+//
+// For GET pages, ExecuteStream is called instead of Execute, with data
+// holding no Tables. The response is not buffered: an error returned
+// once the output has started cannot change the response status, and is
+// only logged.
+type StreamTemplate interface {
+	Template
+
+	// ExecuteStream writes the output to wr, reading the tables from
+	// tables.
+	ExecuteStream(wr io.Writer, data *Result, tables *TableStream) error
+}
+
+// TableStream iterates over the tables of a page, and over the rows of
+// each table:
+//
+//     for tables.NextTable() {
+//         tbl := tables.Table() // Name, Header and Types
+//         for tables.NextRow() {
+//             row := tables.Row()
+//             ...
+//         }
+//     }
+//     if err := tables.Err(); err != nil {
+//         ...
+//     }
+type TableStream struct {
+	// reading from memory
+	tables Tables
+	ti, ri int
+
+	// reading from the database
+	ctx     context.Context
+	tx      *sql.Tx
+	queries []Query
+	params  map[string]interface{}
+	rows    *sql.Rows
+
+	table Table
+	row   Row
+	err   error
+}
+
+// Stream returns a TableStream over the tables t, for example to execute
+// a StreamTemplate on buffered Result.Tables.
+func (t Tables) Stream() *TableStream {
+	return &TableStream{tables: t, ti: -1}
+}
+
+// NextTable advances to the next table, and reports whether there is
+// one. The rows of the previous table which have not been read are
+// skipped.
+func (s *TableStream) NextTable() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.tx == nil {
+		s.ti++
+		s.ri = 0
+		if s.ti >= len(s.tables) {
+			return false
+		}
+		s.table = s.tables[s.ti]
+		s.table.Rows = nil
+		return true
+	}
+	s.close()
+	if len(s.queries) == 0 {
+		return false
+	}
+	q := s.queries[0]
+	s.queries = s.queries[1:]
+	log.Printf("New query: %q\n  %+q\n", q.Q, s.params)
+	s.rows, s.err = s.tx.QueryContext(s.ctx, q.Q, prepareParams(q, s.params)...)
+	if s.err != nil {
+		return false
+	}
+	s.table = Table{Name: q.Name}
+	s.err = readColumns(&s.table, s.rows)
+	return s.err == nil
+}
+
+// Table returns the current table, without rows.
+func (s *TableStream) Table() *Table { return &s.table }
+
+// NextRow advances to the next row of the current table, and reports
+// whether there is one.
+func (s *TableStream) NextRow() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.tx == nil {
+		if s.ti < 0 || s.ti >= len(s.tables) || s.ri >= len(s.tables[s.ti].Rows) {
+			return false
+		}
+		s.row = s.tables[s.ti].Rows[s.ri]
+		s.ri++
+		return true
+	}
+	if s.rows == nil {
+		return false
+	}
+	if !s.rows.Next() {
+		s.close()
+		return false
+	}
+	s.row, s.err = scanRow(&s.table, s.rows)
+	return s.err == nil
+}
+
+// Row returns the current row.
+func (s *TableStream) Row() Row { return s.row }
+
+// Err returns the first error encountered, if any.
+func (s *TableStream) Err() error { return s.err }
+
+// close closes the current rows, keeping their first error.
+func (s *TableStream) close() {
+	if s.rows == nil {
+		return
+	}
+	if err := s.rows.Err(); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.rows.Close()
+	s.rows = nil
+}
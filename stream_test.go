@@ -0,0 +1,38 @@
+package sql2http
+
+import "testing"
+
+func TestTablesStream(t *testing.T) {
+	tables := Tables{
+		{Name: "a", Header: []string{"x"}, Rows: []Row{{Values: []interface{}{1}}, {Values: []interface{}{2}}}},
+		{Name: "b"},
+		{Name: "c", Rows: []Row{{Values: []interface{}{3}}}},
+	}
+	s := tables.Stream()
+	if s.NextRow() {
+		t.Error("row before the first table")
+	}
+	var got []interface{}
+	for s.NextTable() {
+		got = append(got, s.Table().Name)
+		if s.Table().Rows != nil {
+			t.Errorf("table %s has rows", s.Table().Name)
+		}
+		for s.NextRow() {
+			got = append(got, s.Row().Values[0])
+		}
+	}
+	want := []interface{}{"a", 1, 2, "b", "c", 3}
+	if len(got) != len(want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v; want %v", got, want)
+			break
+		}
+	}
+	if s.Err() != nil {
+		t.Error(s.Err())
+	}
+}
@@ -0,0 +1,228 @@
+// Package bundle implements a ZIP archive template, holding one file
+// per result table, written with another template of the page (e.g.
+// ".csv").
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".zip"
+	ContentType = "application/zip"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// DefaultInner is the default extension of the template of the files.
+const DefaultInner = ".csv"
+
+// ManifestName is the name of the manifest file of the archives.
+const ManifestName = "manifest.json"
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer by writing a ZIP archive with a file per table,
+// named after the table (its query name) and the extension of the
+// template writing it. The template is the one of the page for that
+// extension (see sql2http.Result.Templates), executed with a Result
+// holding only that table, without the request options of the bundle,
+// and whose Templates exclude the bundle templates.
+//
+// The following request options (see sql2http.Result.Option) are
+// recognized, prefixed with "_bundle.":
+//
+//     inner:    extension of the template of the files, e.g. "json"
+//     manifest: "true" to add a manifest file, "false" to leave it out
+type Template struct {
+	// Inner is the extension of the template of the files. If empty,
+	// DefaultInner is used.
+	Inner string
+
+	// Manifest adds a JSON file named ManifestName to the archive,
+	// with the request URL, parameters and time, and the list of the
+	// files with their table name and row count.
+	Manifest bool
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are:
+//
+//     inner:    extension of the template of the files, e.g. ".json"
+//     manifest: "true" or "false"
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		switch k {
+		case "inner":
+			c.Inner = ext(v)
+		case "manifest":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid manifest %q", v)
+			}
+			c.Manifest = b
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return &c, nil
+}
+
+// ext returns the extension s, adding the leading dot if missing.
+func ext(s string) string {
+	return "." + strings.TrimPrefix(s, ".")
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+type manifest struct {
+	URL     string                 `json:"url"`
+	Pattern string                 `json:"pattern"`
+	Params  map[string]interface{} `json:"params"`
+	Time    string                 `json:"time"`
+	Files   []manifestFile         `json:"files"`
+}
+
+type manifestFile struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/bundle: only *sql2http.Result can be passed as data")
+	}
+	inner, withManifest := t.Inner, t.Manifest
+	if inner == "" {
+		inner = DefaultInner
+	}
+	if s := resp.Option("bundle", "inner"); s != "" {
+		inner = ext(s)
+	}
+	if s := resp.Option("bundle", "manifest"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("template/bundle: invalid manifest %q", s)
+		}
+		withManifest = b
+	}
+	ts := resp.Templates
+	if ts == nil {
+		ts = sql2http.DefaultTemplateSet
+	}
+	tmpl := ts.Get(inner)
+	if tmpl == nil {
+		return fmt.Errorf("template/bundle: no template for %q", inner)
+	}
+	if isBundle(tmpl) {
+		return fmt.Errorf("template/bundle: invalid inner template %q", inner)
+	}
+
+	// the inner templates see neither the options of the bundle, nor
+	// the bundle templates, which a filter template would otherwise
+	// execute again, endlessly
+	params := make(map[string]interface{}, len(resp.Params))
+	for k, v := range resp.Params {
+		if !strings.HasPrefix(k, "_bundle.") {
+			params[k] = v
+		}
+	}
+	innerTS := &sql2http.TemplateSet{}
+	for _, e := range ts.Exts() {
+		if t := ts.Get(e); !isBundle(t) {
+			innerTS.Register(e, t)
+		}
+	}
+
+	m := manifest{
+		Pattern: resp.Pattern,
+		Params:  resp.Params,
+		Time:    resp.Time.Format(time.RFC3339),
+	}
+	if resp.Request.URL != nil {
+		m.URL = resp.Request.URL.String()
+	}
+	z := zip.NewWriter(wr)
+	for i, name := range FileNames(resp.Tables) {
+		name += inner
+		f, err := z.CreateHeader(header(name, resp))
+		if err != nil {
+			return err
+		}
+		sub := *resp
+		sub.Tables = resp.Tables[i : i+1]
+		sub.Params = params
+		sub.Templates = innerTS
+		if err := tmpl.Execute(f, &sub); err != nil {
+			return fmt.Errorf("template/bundle: %s: %v", name, err)
+		}
+		m.Files = append(m.Files, manifestFile{
+			Name:  name,
+			Table: resp.Tables[i].Name,
+			Rows:  len(resp.Tables[i].Rows),
+		})
+	}
+	if withManifest {
+		f, err := z.CreateHeader(header(ManifestName, resp))
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func isBundle(t sql2http.Template) bool {
+	_, ok := t.(*Template)
+	return ok
+}
+
+func header(name string, resp *sql2http.Result) *zip.FileHeader {
+	return &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: resp.Time}
+}
+
+// FileNames returns one file name (without extension) per table:
+// characters not allowed in file names on usual systems (/\:*?"<>| and
+// control characters) are replaced by '_', empty names default to
+// "table", and duplicates (compared case-insensitively), as well as
+// the name of the manifest, get a "-n" suffix.
+func FileNames(tables sql2http.Tables) []string {
+	names := make([]string, len(tables))
+	seen := make(map[string]bool)
+	for i, tbl := range tables {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+				return '_'
+			}
+			return r
+		}, strings.TrimSpace(tbl.Name))
+		if name == "" || name == "." || name == ".." {
+			name = "table"
+		}
+		unique := name
+		for n := 2; seen[strings.ToLower(unique)] || strings.EqualFold(unique+".json", ManifestName); n++ {
+			unique = name + "-" + strconv.Itoa(n)
+		}
+		seen[strings.ToLower(unique)] = true
+		names[i] = unique
+	}
+	return names
+}
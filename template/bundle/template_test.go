@@ -0,0 +1,132 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+	_ "git.sr.ht/~detaoin/sql2http/template/csv"
+)
+
+func TestFileNames(t *testing.T) {
+	tables := sql2http.Tables{{Name: "a/b"}, {Name: ""}, {Name: "A_b"}, {Name: "manifest"}, {Name: ".."}, {Name: "x\ty"}}
+	got := FileNames(tables)
+	want := []string{"a_b", "table", "A_b-2", "manifest-2", "table-2", "x_y"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("FileNames = %q; want %q", got, want)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"id", "name"}
+	u, _ := url.Parse("/report?month=3&_bundle.manifest=true")
+	res := &sql2http.Result{
+		Pattern: "/report",
+		Tables: sql2http.Tables{
+			{Name: "users", Header: header, Rows: []sql2http.Row{{Header: header, Values: []interface{}{int64(1), "ann"}}}},
+			{Name: "users", Header: []string{"n"}},
+		},
+		Params:  map[string]interface{}{"month": "3", "_bundle.manifest": "true", "inner": "nope"},
+		Request: sql2http.Request{URL: u},
+		Time:    time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	buf := &bytes.Buffer{}
+	if err := (&Template{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	var names []string
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+		names = append(names, f.Name)
+	}
+	if fmt.Sprint(names) != "[users.csv users-2.csv manifest.json]" {
+		t.Fatalf("files %q", names)
+	}
+	if got := files["users.csv"]; got != "id,name\n1,ann\n" {
+		t.Errorf("users.csv: %q", got)
+	}
+	if got := files["users-2.csv"]; got != "n\n" {
+		t.Errorf("users-2.csv: %q", got)
+	}
+	var m manifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.URL != "/report?month=3&_bundle.manifest=true" || m.Params["month"] != "3" || m.Time != "2020-03-01T12:00:00Z" ||
+		len(m.Files) != 2 || m.Files[1] != (manifestFile{"users-2.csv", "users", 0}) {
+		t.Errorf("manifest: %+v", m)
+	}
+
+	for _, inner := range []string{"zip", "nope"} {
+		res.Request.URL = &url.URL{Path: "/report", RawQuery: "_bundle.inner=" + inner}
+		if err := (&Template{}).Execute(&bytes.Buffer{}, res); err == nil {
+			t.Errorf("inner %q: no error", inner)
+		}
+	}
+}
+
+// zipTemplate executes the ".zip" template of the page if any, as a
+// filter template converting it would, else writes the parameters.
+type zipTemplate struct{}
+
+func (zipTemplate) Execute(wr io.Writer, data interface{}) error {
+	resp := data.(*sql2http.Result)
+	if tmpl := resp.Templates.Get(".zip"); tmpl != nil {
+		return tmpl.Execute(wr, data)
+	}
+	_, err := fmt.Fprint(wr, resp.Params)
+	return err
+}
+
+func (zipTemplate) ContentType() string { return "text/plain" }
+
+func TestInnerTemplates(t *testing.T) {
+	ts := &sql2http.TemplateSet{}
+	ts.Register(".zip", &Template{})
+	ts.Register(".pdf", zipTemplate{})
+	res := &sql2http.Result{
+		Tables:    sql2http.Tables{{Name: "t"}},
+		Params:    map[string]interface{}{"_bundle.inner": "pdf", "table": "t"},
+		Request:   sql2http.Request{URL: &url.URL{RawQuery: "_bundle.inner=pdf&table=t"}},
+		Templates: ts,
+	}
+	buf := &bytes.Buffer{}
+	if err := ts.Get(".zip").Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := z.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "map[table:t]" {
+		t.Errorf("t.pdf = %q; want the parameters without the bundle options", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Package cbor implements a CBOR (RFC 7049) template, encoding the
+// result like template/json, with native types.
+package cbor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/encode"
+)
+
+const (
+	Ext         = ".cbor"
+	ContentType = "application/cbor"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Template implements interface sql2http.Template by writing the full
+// Result in CBOR, with the shape of the output of template/json (see
+// package internal/encode): integers, floats, text strings, byte
+// strings for the binary values (e.g. BLOB columns), and timestamps
+// tagged as epoch-based date/times (tag 1).
+type Template struct{}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/cbor: only *sql2http.Result can be passed as data")
+	}
+	e := &encoder{bufio.NewWriter(wr)}
+	if err := encode.Value(e, resp); err != nil {
+		return fmt.Errorf("template/cbor: %v", err)
+	}
+	return e.w.Flush()
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+// The major types.
+const (
+	typeUint   = 0
+	typeNegInt = 1
+	typeBytes  = 2
+	typeString = 3
+	typeArray  = 4
+	typeMap    = 5
+	typeTag    = 6
+)
+
+// encoder implements interface encode.Encoder. The write errors are
+// kept by w, and returned by its Flush method.
+type encoder struct {
+	w *bufio.Writer
+}
+
+// head writes the head of a data item of the given major type and
+// argument n.
+func (e *encoder) head(major byte, n uint64) {
+	major <<= 5
+	var b [9]byte
+	switch {
+	case n < 24:
+		e.w.WriteByte(major | byte(n))
+		return
+	case n <= math.MaxUint8:
+		b[0], b[1] = major|24, byte(n)
+		e.w.Write(b[:2])
+	case n <= math.MaxUint16:
+		b[0] = major | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		e.w.Write(b[:3])
+	case n <= math.MaxUint32:
+		b[0] = major | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		e.w.Write(b[:5])
+	default:
+		b[0] = major | 27
+		binary.BigEndian.PutUint64(b[1:], n)
+		e.w.Write(b[:9])
+	}
+}
+
+func (e *encoder) Nil() { e.w.WriteByte(0xf6) }
+
+func (e *encoder) Bool(b bool) {
+	if b {
+		e.w.WriteByte(0xf5)
+	} else {
+		e.w.WriteByte(0xf4)
+	}
+}
+
+func (e *encoder) Int(i int64) {
+	if i < 0 {
+		e.head(typeNegInt, uint64(-1-i))
+	} else {
+		e.head(typeUint, uint64(i))
+	}
+}
+
+func (e *encoder) Uint(u uint64) { e.head(typeUint, u) }
+
+// Float writes f in single precision if it is exact, else in double
+// precision.
+func (e *encoder) Float(f float64) {
+	var b [9]byte
+	if f32 := float32(f); float64(f32) == f {
+		b[0] = 0xfa
+		binary.BigEndian.PutUint32(b[1:], math.Float32bits(f32))
+		e.w.Write(b[:5])
+		return
+	}
+	b[0] = 0xfb
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+	e.w.Write(b[:])
+}
+
+func (e *encoder) String(s string) {
+	e.head(typeString, uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *encoder) Bytes(b []byte) {
+	e.head(typeBytes, uint64(len(b)))
+	e.w.Write(b)
+}
+
+// Time writes t as the number of seconds since the epoch (tag 1): an
+// integer, or a float for fractions of seconds.
+func (e *encoder) Time(t time.Time) {
+	e.head(typeTag, 1)
+	if t.Nanosecond() == 0 {
+		e.Int(t.Unix())
+		return
+	}
+	e.Float(float64(t.Unix()) + float64(t.Nanosecond())/1e9)
+}
+
+func (e *encoder) Array(n int) { e.head(typeArray, uint64(n)) }
+
+func (e *encoder) Map(n int) { e.head(typeMap, uint64(n)) }
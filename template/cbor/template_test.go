@@ -0,0 +1,63 @@
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// The examples of RFC 7049 appendix A, except for the floats written in
+// half precision there.
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		write func(e *encoder)
+		want  string
+	}{
+		{func(e *encoder) { e.Int(0) }, "00"},
+		{func(e *encoder) { e.Int(23) }, "17"},
+		{func(e *encoder) { e.Int(24) }, "1818"},
+		{func(e *encoder) { e.Int(1000) }, "1903e8"},
+		{func(e *encoder) { e.Int(1000000) }, "1a000f4240"},
+		{func(e *encoder) { e.Uint(18446744073709551615) }, "1bffffffffffffffff"},
+		{func(e *encoder) { e.Int(-1) }, "20"},
+		{func(e *encoder) { e.Int(-1000) }, "3903e7"},
+		{func(e *encoder) { e.Float(100000) }, "fa47c35000"},
+		{func(e *encoder) { e.Float(1.1) }, "fb3ff199999999999a"},
+		{func(e *encoder) { e.Bool(true) }, "f5"},
+		{func(e *encoder) { e.Nil() }, "f6"},
+		{func(e *encoder) { e.Time(time.Unix(1363896240, 0)) }, "c11a514b67b0"},
+		{func(e *encoder) { e.Time(time.Unix(1363896240, 5e8)) }, "c1fb41d452d9ec200000"},
+		{func(e *encoder) { e.Bytes([]byte{1, 2, 3, 4}) }, "4401020304"},
+		{func(e *encoder) { e.String("ü") }, "62c3bc"},
+		{func(e *encoder) { e.Array(3); e.Int(1); e.Int(2); e.Int(3) }, "83010203"},
+		{func(e *encoder) { e.Map(1); e.String("a"); e.Int(1) }, "a1616101"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		e := &encoder{bufio.NewWriter(buf)}
+		test.write(e)
+		e.w.Flush()
+		if got := hex.EncodeToString(buf.Bytes()); got != test.want {
+			t.Errorf("got %s; want %s", got, test.want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	res := &sql2http.Result{
+		Tables: sql2http.Tables{{Name: "t", Header: []string{"b"}, Types: []string{"BLOB"},
+			Rows: []sql2http.Row{{Header: []string{"b"}, Values: []interface{}{"\x01"}}}}},
+	}
+	buf := &bytes.Buffer{}
+	if err := (&Template{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	// the Values of the row: an array of a byte string
+	if !bytes.Contains(buf.Bytes(), []byte("Values\x81\x41\x01")) {
+		t.Errorf("no BLOB byte string in %x", buf.Bytes())
+	}
+}
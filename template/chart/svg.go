@@ -0,0 +1,366 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// palette are the colors of the series (or pie slices), reused in
+// order when there are more.
+var palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// Layout, in pixels.
+const (
+	fontSize  = 12
+	titleSize = 15
+	charWidth = 7 // average width of a character at fontSize
+	pad       = 8
+	swatch    = 10 // size of the colored squares of the legend
+)
+
+// chart is a chart being drawn in buf.
+type chart struct {
+	buf           *bytes.Buffer
+	kind          string
+	title         string
+	width, height float64
+	data          *data
+
+	top float64 // of the free space, below the title and legend
+}
+
+// num formats the coordinate n.
+func num(n float64) string {
+	return strconv.FormatFloat(math.Round(n*100)/100, 'f', -1, 64)
+}
+
+// value formats the data value v, for the tooltips.
+func value(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+func color(i int) string {
+	return palette[i%len(palette)]
+}
+
+// textWidth estimates the width of s written with fontSize.
+func textWidth(s string) float64 {
+	return float64(utf8.RuneCountInString(s)) * charWidth
+}
+
+// truncate shortens s to at most n characters, ending with an ellipsis
+// if shortened.
+func truncate(s string, n int) string {
+	if n < 1 {
+		n = 1
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+func (c *chart) draw() {
+	fmt.Fprintf(c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %[1]s %[2]s" font-family="sans-serif" font-size="%d">`+"\n",
+		num(c.width), num(c.height), fontSize)
+	c.buf.WriteString("<style>.v:hover { opacity: 0.7; }</style>\n")
+	fmt.Fprintf(c.buf, `<rect width="%s" height="%s" fill="white"/>`+"\n", num(c.width), num(c.height))
+	c.top = pad
+	if c.title != "" {
+		fmt.Fprintf(c.buf, "<title>%s</title>\n", esc(c.title))
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s" text-anchor="middle" font-size="%d" font-weight="bold">%s</text>`+"\n",
+			num(c.width/2), num(c.top+titleSize), titleSize, esc(c.title))
+		c.top += titleSize + pad
+	}
+	switch {
+	case len(c.data.labels) == 0:
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s" text-anchor="middle" fill="#666">No data available.</text>`+"\n",
+			num(c.width/2), num(c.height/2))
+	case c.kind == Pie:
+		c.pie()
+	default:
+		c.axes()
+	}
+	c.buf.WriteString("</svg>\n")
+}
+
+// legend draws the legend entries, in rows below the title.
+func (c *chart) legend(names []string) {
+	x, y := float64(pad), c.top
+	for i, name := range names {
+		name = truncate(name, 40)
+		w := swatch + 4 + textWidth(name) + 2*pad
+		if x > pad && x+w > c.width-pad {
+			x, y = pad, y+fontSize+pad
+		}
+		fmt.Fprintf(c.buf, `<rect x="%s" y="%s" width="%d" height="%d" fill="%s"/>`, num(x), num(y+2), swatch, swatch, color(i))
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s">%s</text>`+"\n", num(x+swatch+4), num(y+fontSize), esc(name))
+		x += w
+	}
+	c.top = y + fontSize + 2*pad
+}
+
+// axes draws the bar, stacked bar and line charts.
+func (c *chart) axes() {
+	names := make([]string, len(c.data.series))
+	for i, s := range c.data.series {
+		names[i] = s.name
+	}
+	c.legend(names)
+
+	// the range of the y axis
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i := range c.data.labels {
+		pos, neg := 0., 0.
+		for _, s := range c.data.series {
+			v := s.values[i]
+			if math.IsNaN(v) {
+				continue
+			}
+			if c.kind == Stacked {
+				if v > 0 {
+					pos += v
+				} else {
+					neg += v
+				}
+				lo, hi = math.Min(lo, neg), math.Max(hi, pos)
+			} else {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+	}
+	if math.IsInf(lo, 0) { // only NULL values
+		lo, hi = 0, 1
+	}
+	if c.kind != Line {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+	if hi == lo {
+		lo, hi = lo-1, hi+1
+	}
+	step := niceStep(hi-lo, 5)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	var ticks []float64
+	for i := 0; i <= int(math.Round((hi-lo)/step)); i++ {
+		v := lo + float64(i)*step
+		if math.Abs(v) < step*1e-9 {
+			v = 0
+		}
+		ticks = append(ticks, v)
+	}
+	decimals := decimals(step)
+
+	// the plot area
+	labelWidth := 0.
+	for _, v := range ticks {
+		labelWidth = math.Max(labelWidth, textWidth(strconv.FormatFloat(v, 'f', decimals, 64)))
+	}
+	left, right := labelWidth+2*pad, c.width-2*pad
+	top, bottom := c.top, c.height-fontSize-2*pad
+	if bottom-top < 20 {
+		top = bottom - 20
+	}
+	y := func(v float64) float64 {
+		return top + (bottom-top)*(hi-v)/(hi-lo)
+	}
+
+	// the y axis, with grid lines
+	c.buf.WriteString(`<g stroke="#ddd">` + "\n")
+	for _, v := range ticks {
+		fmt.Fprintf(c.buf, `<line x1="%s" y1="%s" x2="%s" y2="%[2]s"/>`+"\n", num(left), num(y(v)), num(right))
+	}
+	c.buf.WriteString("</g>\n")
+	c.buf.WriteString(`<g text-anchor="end" fill="#333">` + "\n")
+	for _, v := range ticks {
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s">%s</text>`+"\n", num(left-pad/2), num(y(v)+fontSize/3),
+			strconv.FormatFloat(v, 'f', decimals, 64))
+	}
+	c.buf.WriteString("</g>\n")
+
+	// the x axis, with the labels which fit
+	n := len(c.data.labels)
+	slot := (right - left) / float64(n)
+	center := func(i int) float64 {
+		return left + slot*(float64(i)+0.5)
+	}
+	maxLabel := 0.
+	for _, l := range c.data.labels {
+		maxLabel = math.Max(maxLabel, textWidth(truncate(l, 20)))
+	}
+	every := 1
+	for every < n && maxLabel > slot*float64(every)-pad && float64(every)*slot < 20*charWidth+pad {
+		every++
+	}
+	fmt.Fprintf(c.buf, `<g text-anchor="middle" fill="#333">`+"\n")
+	for i := 0; i < n; i += every {
+		l := truncate(c.data.labels[i], int((slot*float64(every)-pad)/charWidth))
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s">%s</text>`+"\n", num(center(i)), num(bottom+pad+fontSize), esc(l))
+	}
+	c.buf.WriteString("</g>\n")
+	base := y(math.Max(lo, math.Min(hi, 0)))
+	fmt.Fprintf(c.buf, `<g stroke="#333"><line x1="%[1]s" y1="%[2]s" x2="%[1]s" y2="%[3]s"/><line x1="%[1]s" y1="%[4]s" x2="%[5]s" y2="%[4]s"/></g>`+"\n",
+		num(left), num(top), num(bottom), num(base), num(right))
+
+	switch c.kind {
+	case Bar:
+		m := float64(len(c.data.series))
+		w := slot * 0.8 / m
+		for j, s := range c.data.series {
+			fmt.Fprintf(c.buf, `<g fill="%s">`+"\n", color(j))
+			for i, v := range s.values {
+				if math.IsNaN(v) {
+					continue
+				}
+				x := left + slot*float64(i) + slot*0.1 + w*float64(j)
+				c.bar(x, w, y(math.Max(v, 0)), y(math.Min(v, 0)), i, s.name, v)
+			}
+			c.buf.WriteString("</g>\n")
+		}
+	case Stacked:
+		w := slot * 0.7
+		pos := make([]float64, n)
+		neg := make([]float64, n)
+		for j, s := range c.data.series {
+			fmt.Fprintf(c.buf, `<g fill="%s">`+"\n", color(j))
+			for i, v := range s.values {
+				if math.IsNaN(v) || v == 0 {
+					continue
+				}
+				x := left + slot*float64(i) + slot*0.15
+				if v > 0 {
+					c.bar(x, w, y(pos[i]+v), y(pos[i]), i, s.name, v)
+					pos[i] += v
+				} else {
+					c.bar(x, w, y(neg[i]), y(neg[i]+v), i, s.name, v)
+					neg[i] += v
+				}
+			}
+			c.buf.WriteString("</g>\n")
+		}
+	case Line:
+		for j, s := range c.data.series {
+			d := &bytes.Buffer{}
+			move := true
+			for i, v := range s.values {
+				if math.IsNaN(v) {
+					move = true
+					continue
+				}
+				cmd := "L"
+				if move {
+					cmd, move = "M", false
+				}
+				fmt.Fprintf(d, "%s%s %s ", cmd, num(center(i)), num(y(v)))
+			}
+			fmt.Fprintf(c.buf, `<path d="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", bytes.TrimSpace(d.Bytes()), color(j))
+			fmt.Fprintf(c.buf, `<g fill="%s">`+"\n", color(j))
+			for i, v := range s.values {
+				if math.IsNaN(v) {
+					continue
+				}
+				fmt.Fprintf(c.buf, `<circle class="v" cx="%s" cy="%s" r="3.5"><title>%s</title></circle>`+"\n",
+					num(center(i)), num(y(v)), esc(c.tooltip(i, s.name, v)))
+			}
+			c.buf.WriteString("</g>\n")
+		}
+	}
+}
+
+// bar draws a bar from y0 (top) to y1, for the value v of the series
+// name at x index i.
+func (c *chart) bar(x, w, y0, y1 float64, i int, name string, v float64) {
+	fmt.Fprintf(c.buf, `<rect class="v" x="%s" y="%s" width="%s" height="%s"><title>%s</title></rect>`+"\n",
+		num(x), num(y0), num(w), num(math.Max(y1-y0, 0)), esc(c.tooltip(i, name, v)))
+}
+
+// tooltip returns the text of the value v of the series name at x
+// index i.
+func (c *chart) tooltip(i int, name string, v float64) string {
+	return fmt.Sprintf("%s, %s: %s", c.data.labels[i], name, value(v))
+}
+
+// pie draws the pie chart of the first series, leaving out the values
+// which are not positive.
+func (c *chart) pie() {
+	s := c.data.series[0]
+	total := 0.
+	for _, v := range s.values {
+		if v > 0 {
+			total += v
+		}
+	}
+	var names []string
+	var slices []int // indexes of the values drawn
+	for i, v := range s.values {
+		if v > 0 {
+			names = append(names, fmt.Sprintf("%s (%.1f%%)", c.data.labels[i], 100*v/total))
+			slices = append(slices, i)
+		}
+	}
+	if len(slices) == 0 {
+		fmt.Fprintf(c.buf, `<text x="%s" y="%s" text-anchor="middle" fill="#666">No positive values.</text>`+"\n",
+			num(c.width/2), num(c.height/2))
+		return
+	}
+	c.legend(names)
+	r := math.Max(math.Min(c.width, c.height-c.top)/2-pad, 10)
+	cx, cy := c.width/2, c.top+(c.height-c.top)/2
+	a := -math.Pi / 2 // from the top, clockwise
+	c.buf.WriteString(`<g stroke="white" stroke-width="1">` + "\n")
+	for j, i := range slices {
+		v := s.values[i]
+		title := esc(fmt.Sprintf("%s, %s: %s (%.1f%%)", c.data.labels[i], s.name, value(v), 100*v/total))
+		if len(slices) == 1 {
+			fmt.Fprintf(c.buf, `<circle class="v" cx="%s" cy="%s" r="%s" fill="%s"><title>%s</title></circle>`+"\n",
+				num(cx), num(cy), num(r), color(j), title)
+			break
+		}
+		b := a + 2*math.Pi*v/total
+		large := 0
+		if b-a > math.Pi {
+			large = 1
+		}
+		fmt.Fprintf(c.buf, `<path class="v" d="M%s %s L%s %s A%s %[5]s 0 %d 1 %s %s Z" fill="%s"><title>%s</title></path>`+"\n",
+			num(cx), num(cy), num(cx+r*math.Cos(a)), num(cy+r*math.Sin(a)), num(r), large,
+			num(cx+r*math.Cos(b)), num(cy+r*math.Sin(b)), color(j), title)
+		a = b
+	}
+	c.buf.WriteString("</g>\n")
+}
+
+// niceStep returns a round step (1, 2, 2.5 or 5 times a power of ten)
+// dividing span in about n intervals.
+func niceStep(span float64, n int) float64 {
+	raw := span / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 2.5, 5} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// decimals returns the number of decimals needed to write the multiples
+// of step.
+func decimals(step float64) int {
+	for d := 0; d < 10; d++ {
+		f := step * math.Pow(10, float64(d))
+		if math.Abs(f-math.Round(f)) < 1e-6*f {
+			return d
+		}
+	}
+	return 10
+}
@@ -0,0 +1,368 @@
+// Package chart implements chart templates, drawing bar, line, stacked
+// bar or pie charts of a result table as SVG images (.svg), for example
+// to be embedded in HTML templates with <img src="...svg">, or as HTML
+// pages (.chart.html).
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext             = ".svg"
+	HTMLExt         = ".chart.html"
+	ContentType     = "image/svg+xml"
+	HTMLContentType = "text/html; charset=utf-8"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+	sql2http.DefaultTemplateSet.Register(HTMLExt, &Template{HTML: true})
+}
+
+// The chart types.
+const (
+	Bar     = "bar"     // a group of bars per x value, one per series
+	Stacked = "stacked" // a bar per x value, stacking the series
+	Line    = "line"    // a line per series
+	Pie     = "pie"     // a slice per x value, of the first series
+)
+
+// Defaults of the Template fields.
+const (
+	DefaultWidth  = 640
+	DefaultHeight = 400
+)
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer by drawing a chart of a result table, in pure
+// SVG: with axes and legend, and the values as tooltips.
+//
+// The x values are taken as categories, evenly spaced in the order of
+// the rows; the series values are numbers, and NULL values are left
+// out.
+//
+// The following request options (see sql2http.Result.Option) are
+// recognized, prefixed with "_chart.", overriding the fields of the
+// Template:
+//
+//     chart:  chart type: bar, stacked, line or pie
+//     table:  name of the query of the charted table
+//     x:      column of the x values
+//     series: comma-separated columns of the series
+//     title:  title of the chart
+//     width:  width of the chart, in pixels
+//     height: height of the chart, in pixels
+//
+// For example: /sales.svg?_chart.chart=line&_chart.x=day&_chart.series=north,south
+type Template struct {
+	// Chart is the chart type, one of Bar, Stacked, Line or Pie. If
+	// empty, Bar is used.
+	Chart string
+
+	// Table is the name of the query of the charted table. If empty,
+	// the first query is used.
+	Table string
+
+	// X is the column of the x values (categories, or pie slices). If
+	// empty, the first column is used.
+	X string
+
+	// Series are the columns of the charted values. If empty, all the
+	// numeric columns other than X are used.
+	Series []string
+
+	// Title is the title of the chart. If empty, the chart has no
+	// title.
+	Title string
+
+	// Width and Height are the size of the chart, in pixels. If zero,
+	// DefaultWidth and DefaultHeight are used.
+	Width, Height int
+
+	// HTML makes the template write an HTML page showing the chart,
+	// instead of the SVG image.
+	HTML bool
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are the request options of the Template: chart, table, x,
+// series, title, width and height.
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		if err := c.set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// set sets the field of the template or request option k.
+func (t *Template) set(k, v string) error {
+	switch k {
+	case "chart":
+		v = strings.ToLower(v)
+		if v != Bar && v != Stacked && v != Line && v != Pie {
+			return fmt.Errorf("unknown chart type %q", v)
+		}
+		t.Chart = v
+	case "table":
+		t.Table = v
+	case "x":
+		t.X = v
+	case "series":
+		t.Series = nil
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				t.Series = append(t.Series, s)
+			}
+		}
+	case "title":
+		t.Title = v
+	case "width", "height":
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 4000 {
+			return fmt.Errorf("invalid %s %q: must be between 100 and 4000", k, v)
+		}
+		if k == "width" {
+			t.Width = n
+		} else {
+			t.Height = n
+		}
+	default:
+		return fmt.Errorf("unknown option %q", k)
+	}
+	return nil
+}
+
+func (t *Template) ContentType() string {
+	if t.HTML {
+		return HTMLContentType
+	}
+	return ContentType
+}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/chart: only *sql2http.Result can be passed as data")
+	}
+	c := *t
+	for _, k := range []string{"chart", "table", "x", "series", "title", "width", "height"} {
+		if s := resp.Option("chart", k); s != "" {
+			if err := c.set(k, s); err != nil {
+				return fmt.Errorf("template/chart: %v", err)
+			}
+		}
+	}
+	if c.Chart == "" {
+		c.Chart = Bar
+	}
+	if c.Width == 0 {
+		c.Width = DefaultWidth
+	}
+	if c.Height == 0 {
+		c.Height = DefaultHeight
+	}
+
+	var tbl *sql2http.Table
+	for i := range resp.Tables {
+		if c.Table == "" || resp.Tables[i].Name == c.Table {
+			tbl = &resp.Tables[i]
+			break
+		}
+	}
+	if tbl == nil {
+		if c.Table != "" {
+			return fmt.Errorf("template/chart: no query named %q", c.Table)
+		}
+		tbl = &sql2http.Table{}
+	}
+	d, err := extract(tbl, c.X, c.Series)
+	if err != nil {
+		return fmt.Errorf("template/chart: %v", err)
+	}
+	if c.Chart == Pie && len(d.series) > 1 {
+		d.series = d.series[:1]
+	}
+
+	buf := &bytes.Buffer{}
+	if c.HTML {
+		title := c.Title
+		if title == "" && resp.Request.URL != nil {
+			title = "Chart for " + resp.Request.URL.EscapedPath()
+		}
+		fmt.Fprintf(buf, htmlHeader, html.EscapeString(title))
+	}
+	ch := &chart{
+		buf:    buf,
+		kind:   c.Chart,
+		title:  c.Title,
+		width:  float64(c.Width),
+		height: float64(c.Height),
+		data:   d,
+	}
+	ch.draw()
+	if c.HTML {
+		buf.WriteString(htmlFooter)
+	}
+	_, err = buf.WriteTo(wr)
+	return err
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+svg { max-width: 100%%; height: auto; }
+</style>
+</head>
+<body>
+`
+
+const htmlFooter = `</body>
+</html>
+`
+
+// data are the values of a chart.
+type data struct {
+	labels []string // the x values
+	series []series
+}
+
+type series struct {
+	name   string
+	values []float64 // NaN for NULL values
+}
+
+// extract returns the data of the table tbl, with the x values of
+// column x, and the series of columns cols (see Template).
+func extract(tbl *sql2http.Table, x string, cols []string) (*data, error) {
+	index := func(col string) (int, error) {
+		for i, h := range tbl.Header {
+			if h == col {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no column %q in table %q", col, tbl.Name)
+	}
+	d := &data{}
+	if len(tbl.Rows) == 0 {
+		return d, nil
+	}
+	xi := 0
+	if x != "" {
+		i, err := index(x)
+		if err != nil {
+			return nil, err
+		}
+		xi = i
+	}
+	var indexes []int
+	if len(cols) == 0 {
+		for i := range tbl.Header {
+			if i != xi && numeric(tbl, i) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			return nil, fmt.Errorf("no numeric column in table %q", tbl.Name)
+		}
+	}
+	for _, col := range cols {
+		i, err := index(col)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, i)
+	}
+
+	for _, row := range tbl.Rows {
+		d.labels = append(d.labels, label(row.Values[xi]))
+	}
+	for _, i := range indexes {
+		s := series{name: tbl.Header[i], values: make([]float64, len(tbl.Rows))}
+		for j, row := range tbl.Rows {
+			f, ok := toFloat(row.Values[i])
+			if !ok {
+				return nil, fmt.Errorf("column %q: not a number: %q", tbl.Header[i], label(row.Values[i]))
+			}
+			s.values[j] = f
+		}
+		d.series = append(d.series, s)
+	}
+	return d, nil
+}
+
+// numeric reports whether the values of column i of tbl are numbers or
+// NULL, with at least one number.
+func numeric(tbl *sql2http.Table, i int) bool {
+	n := 0
+	for _, row := range tbl.Rows {
+		f, ok := toFloat(row.Values[i])
+		if !ok {
+			return false
+		}
+		if !math.IsNaN(f) {
+			n++
+		}
+	}
+	return n > 0
+}
+
+// toFloat returns the number v, or NaN if v is nil. It returns false if
+// v is not a number.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case nil:
+		return math.NaN(), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, !math.IsInf(v, 0)
+	case float32:
+		return float64(v), true
+	case []byte:
+		return toFloat(string(v))
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return 0, false
+}
+
+// label returns the text of the x value v.
+func label(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04")
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
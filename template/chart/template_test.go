@@ -0,0 +1,140 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		span, step float64
+		decimals   int
+	}{
+		{10, 2, 0},
+		{1, 0.2, 1},
+		{12, 2.5, 1},
+		{1234, 250, 0},
+		{0.03, 0.01, 2},
+		{40, 10, 0},
+	}
+	for _, test := range tests {
+		if got := niceStep(test.span, 5); got != test.step {
+			t.Errorf("niceStep(%v) = %v; want %v", test.span, got, test.step)
+		}
+		if got := decimals(test.step); got != test.decimals {
+			t.Errorf("decimals(%v) = %v; want %v", test.step, got, test.decimals)
+		}
+	}
+}
+
+// elements returns the count of the SVG elements by name, and the
+// texts of the tooltips, failing if doc is not well-formed XML.
+func elements(t *testing.T, doc []byte) (map[string]int, []string) {
+	count := make(map[string]int)
+	var titles []string
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	d.Strict = true
+	inTitle := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v\n%s", err, doc)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			count[tok.Name.Local]++
+			inTitle = tok.Name.Local == "title"
+		case xml.EndElement:
+			inTitle = false
+		case xml.CharData:
+			if inTitle {
+				titles = append(titles, string(tok))
+			}
+		}
+	}
+	return count, titles
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"day", "north", "south", "note"}
+	day := func(d int) time.Time { return time.Date(2020, 3, d, 0, 0, 0, 0, time.UTC) }
+	tbl := sql2http.Table{Name: "sales", Header: header, Rows: []sql2http.Row{
+		{Header: header, Values: []interface{}{day(1), int64(3), 2.5, "a <&>"}},
+		{Header: header, Values: []interface{}{day(2), int64(5), nil, "b"}},
+		{Header: header, Values: []interface{}{day(3), int64(-1), []byte("4"), nil}},
+	}}
+	res := func(query string) *sql2http.Result {
+		return &sql2http.Result{
+			Tables:  sql2http.Tables{tbl},
+			Request: sql2http.Request{URL: &url.URL{Path: "/sales", RawQuery: query}},
+			// parameters of the page, which are not options
+			Params: map[string]interface{}{"title": "x", "x": "2", "width": "5"},
+		}
+	}
+
+	tests := []struct {
+		tmpl  *Template
+		query string
+		count map[string]int
+		title string // one of the tooltips
+	}{
+		// day is the first column, note is not numeric; the rects are
+		// the background, legend, and bars
+		{&Template{}, "", map[string]int{"rect": 1 + 2 + 5, "path": 0}, "2020-03-02, north: 5"},
+		{&Template{}, "x=note&chart=pie", map[string]int{"rect": 1 + 2 + 5, "path": 0}, "2020-03-02, north: 5"},
+		{&Template{}, "_chart.chart=stacked&_chart.series=south", map[string]int{"rect": 1 + 1 + 2}, "2020-03-03, south: 4"},
+		{&Template{Chart: Line}, "", map[string]int{"path": 2, "circle": 5}, "2020-03-01, south: 2.5"},
+		{&Template{Chart: Pie, Title: "Sales"}, "", map[string]int{"path": 2}, "2020-03-02, north: 5 (62.5%)"},
+		{&Template{}, "_chart.chart=pie&_chart.x=note&_chart.series=south", map[string]int{"path": 2}, "a <&>, south: 2.5 (38.5%)"},
+	}
+	for i, test := range tests {
+		buf := &bytes.Buffer{}
+		if err := test.tmpl.Execute(buf, res(test.query)); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		count, titles := elements(t, buf.Bytes())
+		for name, n := range test.count {
+			if count[name] != n {
+				t.Errorf("%d: %d %s elements; want %d", i, count[name], name, n)
+			}
+		}
+		found := false
+		for _, title := range titles {
+			found = found || title == test.title
+		}
+		if !found {
+			t.Errorf("%d: no tooltip %q in %q", i, test.title, titles)
+		}
+	}
+
+	for _, query := range []string{
+		"_chart.chart=radar",
+		"_chart.x=month",
+		"_chart.series=note",
+		"_chart.table=other",
+		"_chart.width=5",
+	} {
+		if err := (&Template{}).Execute(&bytes.Buffer{}, res(query)); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := (&Template{HTML: true}).Execute(buf, res("")); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "<title>Chart for /sales</title>") || !strings.Contains(s, "<svg ") {
+		t.Errorf("HTML page:\n%s", s)
+	}
+}
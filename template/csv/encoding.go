@@ -0,0 +1,86 @@
+package csv
+
+import (
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encoders append the encoding of a rune, by Template.Encoding. They
+// are nil for UTF-8, which needs no conversion.
+var encoders = map[string]func(b []byte, r rune) []byte{
+	"":             nil,
+	"utf-8":        nil,
+	"utf-16le":     appendUTF16LE,
+	"windows-1252": appendWindows1252,
+}
+
+func appendUTF16LE(b []byte, r rune) []byte {
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		b = append(b, byte(r1), byte(r1>>8))
+		r = r2
+	}
+	return append(b, byte(r), byte(r>>8))
+}
+
+// windows1252 maps the runes of Windows-1252 outside of Latin-1 to
+// their code.
+var windows1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+func appendWindows1252(b []byte, r rune) []byte {
+	switch {
+	case r < 0x80 || r >= 0xa0 && r <= 0xff:
+		return append(b, byte(r))
+	case r == 0xfeff: // no byte order mark in this encoding
+		return b
+	case windows1252[r] != 0:
+		return append(b, windows1252[r])
+	}
+	return append(b, '?')
+}
+
+// encodeWriter writes to w the UTF-8 text written to it, in the encoding
+// of encode. The invalid UTF-8 bytes are written as utf8.RuneError.
+type encodeWriter struct {
+	w       io.Writer
+	encode  func(b []byte, r rune) []byte
+	buf     []byte
+	partial []byte // the start of a rune split across writes
+}
+
+func (w *encodeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(w.partial) > 0 {
+		p = append(w.partial, p...)
+		w.partial = nil
+	}
+	w.buf = w.buf[:0]
+	for len(p) > 0 {
+		if !utf8.FullRune(p) {
+			w.partial = append([]byte(nil), p...)
+			break
+		}
+		r, size := utf8.DecodeRune(p)
+		w.buf = w.encode(w.buf, r)
+		p = p[size:]
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Close writes the incomplete rune left, if any.
+func (w *encodeWriter) Close() error {
+	if len(w.partial) == 0 {
+		return nil
+	}
+	w.partial = nil
+	_, err := w.w.Write(w.encode(nil, utf8.RuneError))
+	return err
+}
@@ -4,6 +4,11 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"git.sr.ht/~detaoin/sql2http"
 )
@@ -13,12 +18,120 @@ func init() {
 	sql2http.DefaultTemplateSet.Register(".tsv", &Template{Comma: '\t'})
 }
 
-// Template implements interface sql2http.Template by writing with
+// Template implements interfaces sql2http.Template,
+// sql2http.Configurer and sql2http.HeaderTemplate by writing with
 // csv.Encode the SQL query rows to the io.Writer. Each individual SQL
 // query result set is separated by an empty line.
+//
+// The following request options (see sql2http.Result.Option) are
+// recognized, prefixed with "_csv.", overriding the fields of the
+// Template:
+//
+//     header:     "false" to leave out the header rows
+//     null:       text of the NULL values
+//     bom:        "true" to start with a byte order mark
+//     encoding:   output encoding (see Encoding)
+//     table:      name of the single query to write
+//     timeformat: layout of the times (see TimeFormat)
+//     filename:   file name to download the response as
+//
+// For example, for Excel: /report.csv?_csv.bom=true&_csv.table=sales
 type Template struct {
 	Comma   rune // default ','; e.g. use '\t' for tab-separated values
 	UseCRLF bool // use "\r\n" end-of-line character instead of "\n"
+
+	NoHeader bool   // leave out the header row of the tables
+	Null     string // text of the NULL values, empty by default
+
+	// BOM starts the output with a byte order mark, which some
+	// applications (e.g. Excel) need to detect the encoding.
+	BOM bool
+
+	// Encoding is the output encoding, one of "utf-8" (the default),
+	// "utf-16le" or "windows-1252". The characters which cannot be
+	// encoded in windows-1252 are written as '?'.
+	Encoding string
+
+	// Table is the name of the single query whose rows are written. If
+	// empty, the rows of all the queries are.
+	Table string
+
+	// TimeFormat is the layout of the time values (see time.Format), or
+	// one of the names "date", "datetime", "time", "rfc3339" or
+	// "rfc1123". If empty, times are written with fmt.Sprint.
+	TimeFormat string
+
+	// Filename makes the response an attachment to download with that
+	// file name (see SetHeader), instead of showing it in the browser.
+	Filename string
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are the request options of the Template: header, null, bom,
+// encoding, table, timeformat and filename.
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		if err := c.set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// set sets the field of the template or request option k.
+func (t *Template) set(k, v string) error {
+	switch k {
+	case "header", "bom":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", k, v)
+		}
+		if k == "header" {
+			t.NoHeader = !b
+		} else {
+			t.BOM = b
+		}
+	case "null":
+		t.Null = v
+	case "encoding":
+		if _, ok := encoders[strings.ToLower(v)]; !ok {
+			return fmt.Errorf("unknown encoding %q", v)
+		}
+		t.Encoding = strings.ToLower(v)
+	case "table":
+		t.Table = v
+	case "timeformat":
+		t.TimeFormat = v
+	case "filename":
+		t.Filename = v
+	default:
+		return fmt.Errorf("unknown option %q", k)
+	}
+	return nil
+}
+
+// params returns t with the fields overridden by the request options
+// of resp.
+func (t *Template) params(resp *sql2http.Result) (*Template, error) {
+	c := *t
+	for _, k := range []string{"header", "null", "bom", "encoding", "table", "timeformat", "filename"} {
+		if s := resp.Option("csv", k); s != "" {
+			if err := c.set(k, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &c, nil
+}
+
+// timeLayouts are the named layouts of TimeFormat.
+var timeLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+	"time":     "15:04:05",
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
 }
 
 func (t *Template) Execute(wr io.Writer, data interface{}) error {
@@ -26,24 +139,77 @@ func (t *Template) Execute(wr io.Writer, data interface{}) error {
 	if !ok {
 		return fmt.Errorf("template/csv: only *sql2http.Result can be passed as data")
 	}
+	t, err := t.params(resp)
+	if err != nil {
+		return fmt.Errorf("template/csv: %v", err)
+	}
+	tables := resp.Tables
+	if t.Table != "" {
+		tables = nil
+		for _, tbl := range resp.Tables {
+			if tbl.Name == t.Table {
+				tables = sql2http.Tables{tbl}
+				break
+			}
+		}
+		if tables == nil {
+			return fmt.Errorf("template/csv: no query named %q", t.Table)
+		}
+	}
+	layout := ""
+	if t.TimeFormat != "" {
+		layout = t.TimeFormat
+		if l, ok := timeLayouts[strings.ToLower(layout)]; ok {
+			layout = l
+		}
+	}
+
+	enc := &encodeWriter{w: wr, encode: encoders[t.Encoding]}
+	if enc.encode != nil {
+		wr = enc
+	}
+	if t.BOM {
+		if _, err := io.WriteString(wr, "\ufeff"); err != nil {
+			return err
+		}
+	}
 	out := csv.NewWriter(wr)
 	out.Comma = t.Comma
 	out.UseCRLF = t.UseCRLF
-	for i, tbl := range resp.Tables {
+	for i, tbl := range tables {
 		if i > 0 { // separate tables with an empty line
 			out.Write([]string{})
 		}
 		vals := make([]string, len(tbl.Header))
-		out.Write(tbl.Header)
+		if !t.NoHeader {
+			out.Write(tbl.Header)
+		}
 		for _, row := range tbl.Rows {
-			for i := range row.Values {
-				vals[i] = fmt.Sprint(row.Values[i])
+			for i, v := range row.Values {
+				switch v := v.(type) {
+				case nil:
+					vals[i] = t.Null
+				case time.Time:
+					if layout == "" {
+						vals[i] = fmt.Sprint(v)
+					} else {
+						vals[i] = v.Format(layout)
+					}
+				default:
+					vals[i] = fmt.Sprint(v)
+				}
 			}
 			out.Write(vals)
 		}
 	}
 	out.Flush()
-	return out.Error()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	if enc.encode != nil {
+		return enc.Close()
+	}
+	return nil
 }
 
 func (t *Template) ContentType() string {
@@ -56,3 +222,34 @@ func (t *Template) ContentType() string {
 		return "text/plain"
 	}
 }
+
+// SetHeader implements interface sql2http.HeaderTemplate: it sets the
+// charset of the Content-Type for other encodings than UTF-8, and the
+// Content-Disposition header if Filename is set.
+func (t *Template) SetHeader(h http.Header, data *sql2http.Result) {
+	t, err := t.params(data)
+	if err != nil { // reported by Execute
+		return
+	}
+	if t.Encoding != "" && t.Encoding != "utf-8" {
+		h.Set("Content-Type", t.ContentType()+"; charset="+t.Encoding)
+	}
+	if name := filename(t.Filename); name != "" {
+		if v := mime.FormatMediaType("attachment", map[string]string{"filename": name}); v != "" {
+			h.Set("Content-Disposition", v)
+		}
+	}
+}
+
+// filename returns the base name of name, without control characters.
+func filename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+}
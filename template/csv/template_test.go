@@ -0,0 +1,81 @@
+package csv
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestExecute(t *testing.T) {
+	header := []string{"name", "at", "note"}
+	res := func(query string) *sql2http.Result {
+		return &sql2http.Result{
+			Tables: sql2http.Tables{
+				{Name: "a", Header: header, Rows: []sql2http.Row{
+					{Header: header, Values: []interface{}{"José €", time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), nil}},
+				}},
+				{Name: "b", Header: []string{"n"}, Rows: []sql2http.Row{{Header: []string{"n"}, Values: []interface{}{int64(1)}}}},
+			},
+			// parameters of the page, which are not options
+			Params:  map[string]interface{}{"table": "c", "header": "maybe", "filename": "x"},
+			Request: sql2http.Request{URL: &url.URL{Path: "/report", RawQuery: query}},
+		}
+	}
+	tests := []struct {
+		tmpl  *Template
+		query string
+		want  string
+	}{
+		{&Template{Comma: ','}, "", "name,at,note\nJosé €,2020-03-01 12:00:00 +0000 UTC,\n\nn\n1\n"},
+		{&Template{Comma: ','}, "table=c&header=maybe", "name,at,note\nJosé €,2020-03-01 12:00:00 +0000 UTC,\n\nn\n1\n"},
+		{&Template{Comma: ';', Null: "NULL", TimeFormat: "date"}, "_csv.table=a&_csv.header=false",
+			"José €;2020-03-01;NULL\n"},
+		{&Template{Comma: ','}, "_csv.table=b&_csv.bom=1", "\xef\xbb\xbfn\n1\n"},
+		{&Template{Comma: ',', Encoding: "windows-1252", BOM: true}, "_csv.table=a&_csv.timeformat=02/01/2006",
+			"name,at,note\nJos\xe9 \x80,01/03/2020,\n"},
+		{&Template{Comma: '\t', Encoding: "utf-16le", BOM: true}, "_csv.table=b",
+			"\xff\xfen\x00\n\x001\x00\n\x00"},
+	}
+	for i, test := range tests {
+		buf := &bytes.Buffer{}
+		if err := test.tmpl.Execute(buf, res(test.query)); err != nil {
+			t.Errorf("%d: %v", i, err)
+		} else if got := buf.String(); got != test.want {
+			t.Errorf("%d: got %q; want %q", i, got, test.want)
+		}
+	}
+	for _, query := range []string{"_csv.table=c", "_csv.encoding=latin-9", "_csv.header=maybe"} {
+		if err := (&Template{}).Execute(&bytes.Buffer{}, res(query)); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+
+	h := http.Header{"Content-Type": {"text/csv"}}
+	(&Template{Comma: ',', Encoding: "utf-16le"}).SetHeader(h, res("_csv.filename=../report%0A%202020.csv"))
+	if got := h.Get("Content-Type"); got != "text/csv; charset=utf-16le" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if got := h.Get("Content-Disposition"); got != `attachment; filename="report 2020.csv"` {
+		t.Errorf("Content-Disposition %q", got)
+	}
+}
+
+func TestEncodeWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := &encodeWriter{w: buf, encode: appendUTF16LE}
+	b := []byte("é𝄞\xff")
+	for i := range b { // runes split across writes
+		if n, err := w.Write(b[i : i+1]); n != 1 || err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	w.Write([]byte("\xf0"))
+	w.Close()
+	if got, want := buf.String(), "\xe9\x00\x34\xd8\x1e\xdd\xfd\xff\xfd\xff"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,587 @@
+// Package feed implements Atom (RFC 4287) and RSS 2.0 feed templates.
+//
+// The entries of the feed are the rows of one of the result tables; the
+// columns used for each entry field are given by Template.Columns,
+// defaulting to columns named like the fields: id, title, updated,
+// link, author and content.
+//
+// The feed metadata (title, subtitle, id, link and author) is taken
+// from the Template fields, overridden by the first row of the metadata
+// query (named "feed" by default) if any.
+//
+// The ids of the feed and its entries must not change, so they are
+// never made from the request: the feed id defaults to its link, else
+// to the page path under the base URL, and the entry ids default to
+// their link. Entry ids which are not IRIs are appended to the feed id as
+// a fragment, e.g. "https://example.com/changes#42".
+//
+// The entries must have an updated time. The feed is updated at the
+// time of the metadata query, else of its latest entry; an empty Atom
+// feed is updated at the time of the request, RSS leaves lastBuildDate
+// out.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	AtomExt         = ".atom"
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	RSSExt          = ".rss"
+	RSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(AtomExt, &Template{Format: Atom})
+	sql2http.DefaultTemplateSet.Register(RSSExt, &Template{Format: RSS})
+}
+
+// Format is the output feed format.
+type Format int
+
+const (
+	Atom Format = iota
+	RSS
+)
+
+// Columns maps the result columns to the feed entry fields. Empty
+// values default to the lowercase field name (e.g. "updated").
+type Columns struct {
+	ID      string
+	Title   string
+	Updated string
+	Link    string
+	Author  string
+	Content string
+}
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer by writing the query results as a feed.
+type Template struct {
+	Format  Format
+	Columns Columns
+
+	// Table is the name of the query whose rows are the feed entries.
+	// If empty, the first query other than Meta is used.
+	Table string
+
+	// Meta is the name of the query giving the feed metadata, with
+	// columns named title, subtitle, id, link, author and updated.
+	// If empty, "feed" is used.
+	Meta string
+
+	// HTML is set if the content column holds HTML rather than plain
+	// text.
+	HTML bool
+
+	// Feed metadata, possibly overridden by the Meta query.
+	Title    string
+	Subtitle string
+	ID       string // defaults to Link, or the page path under BaseURL
+	Link     string
+	Author   string
+
+	// BaseURL is the absolute URL against which the relative links and
+	// ids are resolved. If empty, the links are resolved against the
+	// scheme and host of the request, which are unknown when the request
+	// has no Host, and the ids must be absolute.
+	BaseURL string
+
+	// Proxy is set if the server is behind a reverse proxy, whose
+	// X-Forwarded-Proto header gives the scheme of the request. It is
+	// ignored otherwise, as any client can set it.
+	Proxy bool
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are:
+//
+//     id, title, updated, link, author, content: entry column names
+//     table:    name of the entries query
+//     meta:     name of the feed metadata query
+//     html:     "true" if the content column is HTML
+//     feed.title, feed.subtitle, feed.id, feed.link, feed.author:
+//               feed metadata
+//     base:     base URL of the relative links and ids
+//     proxy:    "true" to trust the X-Forwarded-Proto header
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		switch k {
+		case "id":
+			c.Columns.ID = v
+		case "title":
+			c.Columns.Title = v
+		case "updated":
+			c.Columns.Updated = v
+		case "link":
+			c.Columns.Link = v
+		case "author":
+			c.Columns.Author = v
+		case "content":
+			c.Columns.Content = v
+		case "table":
+			c.Table = v
+		case "meta":
+			c.Meta = v
+		case "html":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("option html: %v", err)
+			}
+			c.HTML = b
+		case "feed.title":
+			c.Title = v
+		case "feed.subtitle":
+			c.Subtitle = v
+		case "feed.id":
+			c.ID = v
+		case "feed.link":
+			c.Link = v
+		case "feed.author":
+			c.Author = v
+		case "base":
+			u, err := url.Parse(v)
+			if err != nil || !u.IsAbs() {
+				return nil, fmt.Errorf("option base: %q is not an absolute URL", v)
+			}
+			c.BaseURL = v
+		case "proxy":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("option proxy: %v", err)
+			}
+			c.Proxy = b
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return &c, nil
+}
+
+func (t *Template) ContentType() string {
+	if t.Format == RSS {
+		return RSSContentType
+	}
+	return AtomContentType
+}
+
+func (t *Template) ext() string {
+	if t.Format == RSS {
+		return RSSExt
+	}
+	return AtomExt
+}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/feed: only *sql2http.Result can be passed as data")
+	}
+	f, err := t.feed(resp)
+	if err != nil {
+		return fmt.Errorf("template/feed: %v", err)
+	}
+	var v interface{}
+	if t.Format == RSS {
+		v = f.rss()
+	} else {
+		v = f.atom()
+	}
+	if _, err := io.WriteString(wr, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(wr)
+	enc.Indent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err = io.WriteString(wr, "\n")
+	return err
+}
+
+// feed is the format independent representation of a feed.
+type feed struct {
+	title, subtitle, id, link, self, author string
+	updated                                 time.Time
+	html                                    bool
+	entries                                 []entry
+}
+
+type entry struct {
+	id, title, link, author, content string
+	updated                          time.Time
+}
+
+func (t *Template) feed(resp *sql2http.Result) (*feed, error) {
+	base := baseURL(resp.Request, t.Proxy)
+	idBase := &url.URL{} // the ids never depend on the request
+	if t.BaseURL != "" {
+		u, err := url.Parse(t.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("base URL: %v", err)
+		}
+		base, idBase = u, u
+	}
+	f := &feed{
+		title:    t.Title,
+		subtitle: t.Subtitle,
+		id:       t.ID,
+		link:     t.Link,
+		author:   t.Author,
+		html:     t.HTML,
+	}
+	if u := resp.Request.URL; u != nil {
+		// the router strips the extension from the request path
+		self := *u
+		if ext := t.ext(); !strings.HasSuffix(self.Path, ext) {
+			self.Path += ext
+		}
+		f.self = resolve(base, self.RequestURI())
+	}
+	meta := t.Meta
+	if meta == "" {
+		meta = "feed"
+	}
+	var entries *sql2http.Table
+	for i := range resp.Tables {
+		tbl := &resp.Tables[i]
+		switch {
+		case tbl.Name == meta:
+			if len(tbl.Rows) > 0 {
+				row := tbl.Rows[0]
+				set(&f.title, row, "title")
+				set(&f.subtitle, row, "subtitle")
+				set(&f.id, row, "id")
+				set(&f.link, row, "link")
+				set(&f.author, row, "author")
+				if v := row.Get("updated"); v != nil {
+					tm, err := parseTime(v)
+					if err != nil {
+						return nil, fmt.Errorf("%s.updated: %v", meta, err)
+					}
+					f.updated = tm
+				}
+			}
+		case entries == nil && (t.Table == "" || tbl.Name == t.Table):
+			entries = tbl
+		}
+	}
+	if entries == nil && t.Table != "" {
+		return nil, fmt.Errorf("no query named %q", t.Table)
+	}
+	if f.id == "" && f.link != "" {
+		f.id = resolve(idBase, f.link)
+	}
+	if f.link != "" {
+		f.link = resolve(base, f.link)
+	}
+	if f.id == "" && t.BaseURL != "" && resp.Request.URL != nil {
+		// the page path, without the query nor the feed extension
+		p := strings.TrimSuffix(resp.Request.URL.Path, t.ext())
+		f.id = idBase.ResolveReference(&url.URL{Path: p}).String()
+	}
+	if f.id == "" {
+		return nil, fmt.Errorf("no feed id nor link, set the base URL")
+	}
+	if !absolute(f.id) {
+		return nil, fmt.Errorf("feed id %q is not an absolute IRI, set the base URL", f.id)
+	}
+	if f.title == "" && resp.Request.URL != nil {
+		f.title = resp.Request.URL.Path
+	}
+
+	cols := t.Columns
+	def := func(s *string, name string) {
+		if *s == "" {
+			*s = name
+		}
+	}
+	def(&cols.ID, "id")
+	def(&cols.Title, "title")
+	def(&cols.Updated, "updated")
+	def(&cols.Link, "link")
+	def(&cols.Author, "author")
+	def(&cols.Content, "content")
+	var latest time.Time
+	if entries != nil {
+		for i, row := range entries.Rows {
+			e := entry{
+				id:      text(row.Get(cols.ID)),
+				title:   text(row.Get(cols.Title)),
+				link:    text(row.Get(cols.Link)),
+				author:  text(row.Get(cols.Author)),
+				content: text(row.Get(cols.Content)),
+			}
+			switch {
+			case e.id == "" && e.link == "":
+				return nil, fmt.Errorf("row %d: no %s nor %s value", i+1, cols.ID, cols.Link)
+			case e.id == "":
+				e.id = resolve(idBase, e.link)
+				if !absolute(e.id) {
+					return nil, fmt.Errorf("row %d: no %s and link %q is not an absolute IRI, set the base URL", i+1, cols.ID, e.link)
+				}
+			case !strings.Contains(e.id, ":"):
+				// entry ids must be absolute IRIs
+				e.id = f.id + "#" + url.PathEscape(e.id)
+			}
+			if e.link != "" {
+				e.link = resolve(base, e.link)
+			}
+			v := row.Get(cols.Updated)
+			if v == nil {
+				return nil, fmt.Errorf("row %d: no %s value", i+1, cols.Updated)
+			}
+			tm, err := parseTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %s: %v", i+1, cols.Updated, err)
+			}
+			e.updated = tm
+			if e.updated.After(latest) {
+				latest = e.updated
+			}
+			f.entries = append(f.entries, e)
+		}
+	}
+	if f.updated.IsZero() {
+		f.updated = latest
+	}
+	if f.updated.IsZero() && t.Format == Atom {
+		f.updated = resp.Time
+	}
+	// Atom requires an author for the feed, unless all entries have one.
+	needAuthor := len(f.entries) == 0
+	for _, e := range f.entries {
+		needAuthor = needAuthor || e.author == ""
+	}
+	if f.author == "" && needAuthor {
+		f.author = resp.Request.Host
+		if f.author == "" {
+			f.author = "sql2http"
+		}
+	}
+	return f, nil
+}
+
+// set sets *s to the text value of the row column if it is not NULL.
+func set(s *string, row sql2http.Row, column string) {
+	if v := row.Get(column); v != nil {
+		*s = text(v)
+	}
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseTime returns the time of a database value: either a time.Time,
+// a date string, or a unix timestamp.
+func parseTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	}
+	return time.Time{}, fmt.Errorf("invalid date %v", v)
+}
+
+// baseURL returns the absolute URL of the server, as requested by the
+// client. The X-Forwarded-Proto header is used only behind a proxy.
+func baseURL(req sql2http.Request, proxy bool) *url.URL {
+	if req.Host == "" {
+		return &url.URL{}
+	}
+	scheme := "http"
+	if s := req.Header.Get("X-Forwarded-Proto"); proxy && (s == "http" || s == "https") {
+		scheme = s
+	}
+	return &url.URL{Scheme: scheme, Host: req.Host}
+}
+
+// absolute returns whether s is an absolute IRI, as required for ids.
+func absolute(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs()
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  *atomPerson `xml:"author,omitempty"`
+	Content *atomText   `xml:"content,omitempty"`
+}
+
+func person(name string) *atomPerson {
+	if name == "" {
+		return nil
+	}
+	return &atomPerson{Name: name}
+}
+
+func (f *feed) atom() *atomFeed {
+	a := &atomFeed{
+		ID:        f.id,
+		Title:     f.title,
+		Subtitle:  f.subtitle,
+		Updated:   f.updated.Format(time.RFC3339),
+		Author:    person(f.author),
+		Generator: "sql2http",
+	}
+	if f.self != "" {
+		a.Links = append(a.Links, atomLink{Rel: "self", Href: f.self})
+	}
+	if f.link != "" {
+		a.Links = append(a.Links, atomLink{Rel: "alternate", Href: f.link})
+	}
+	contentType := "text"
+	if f.html {
+		contentType = "html"
+	}
+	for _, e := range f.entries {
+		ae := atomEntry{
+			ID:      e.id,
+			Title:   e.title,
+			Updated: e.updated.Format(time.RFC3339),
+			Author:  person(e.author),
+		}
+		if e.link != "" {
+			ae.Links = []atomLink{{Rel: "alternate", Href: e.link}}
+		}
+		if e.content != "" || e.link == "" {
+			// an entry without alternate link must have a content
+			ae.Content = &atomText{Type: contentType, Body: e.content}
+		}
+		a.Entries = append(a.Entries, ae)
+	}
+	return a
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title,omitempty"`
+	Link        string  `xml:"link,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Author      string  `xml:"author,omitempty"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+func (f *feed) rss() *rssFeed {
+	link := f.link
+	if link == "" {
+		link = f.self
+	}
+	r := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.title,
+			Link:        link,
+			Description: f.subtitle,
+			Generator:   "sql2http",
+		},
+	}
+	if !f.updated.IsZero() {
+		r.Channel.LastBuildDate = f.updated.Format(time.RFC1123Z)
+	}
+	for _, e := range f.entries {
+		r.Channel.Items = append(r.Channel.Items, rssItem{
+			Title:       e.title,
+			Link:        e.link,
+			GUID:        rssGUID{IsPermaLink: e.id == e.link, ID: e.id},
+			PubDate:     e.updated.Format(time.RFC1123Z),
+			Author:      e.author,
+			Description: e.content,
+		})
+	}
+	return r
+}
@@ -0,0 +1,166 @@
+package feed
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func testResult() *sql2http.Result {
+	header := []string{"id", "title", "updated", "content"}
+	return &sql2http.Result{
+		Request: sql2http.Request{
+			URL:    &url.URL{Path: "/changes"},
+			Header: http.Header{},
+		},
+		Time: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Tables: sql2http.Tables{
+			{
+				Name:   "changes",
+				Header: header,
+				Rows: []sql2http.Row{
+					{Header: header, Values: []interface{}{int64(1), "First", "2020-03-01 12:00:00", "a < b"}},
+					{Header: header, Values: []interface{}{int64(2), "Second", time.Date(2020, 3, 2, 8, 30, 0, 0, time.UTC), nil}},
+				},
+			},
+		},
+	}
+}
+
+func execute(t *testing.T, tmpl sql2http.Template, resp *sql2http.Result) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, resp); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestAtom(t *testing.T) {
+	tmpl := &Template{Format: Atom, Title: "Changes", BaseURL: "https://example.com"}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<id>https://example.com/changes</id>
+	<title>Changes</title>
+	<updated>2020-03-02T08:30:00Z</updated>
+	<link rel="self" href="https://example.com/changes.atom"></link>
+	<author>
+		<name>sql2http</name>
+	</author>
+	<generator>sql2http</generator>
+	<entry>
+		<id>https://example.com/changes#1</id>
+		<title>First</title>
+		<updated>2020-03-01T12:00:00Z</updated>
+		<content type="text">a &lt; b</content>
+	</entry>
+	<entry>
+		<id>https://example.com/changes#2</id>
+		<title>Second</title>
+		<updated>2020-03-02T08:30:00Z</updated>
+		<content type="text"></content>
+	</entry>
+</feed>
+`
+	if got := execute(t, tmpl, testResult()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	tmpl := &Template{Format: RSS, Title: "Changes", Subtitle: "All changes", ID: "tag:example.com,2020:changes"}
+	resp := testResult()
+	resp.Request.Host = "example.com"
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+		<title>Changes</title>
+		<link>http://example.com/changes.rss</link>
+		<description>All changes</description>
+		<lastBuildDate>Mon, 02 Mar 2020 08:30:00 +0000</lastBuildDate>
+		<generator>sql2http</generator>
+		<item>
+			<title>First</title>
+			<guid isPermaLink="false">tag:example.com,2020:changes#1</guid>
+			<pubDate>Sun, 01 Mar 2020 12:00:00 +0000</pubDate>
+			<description>a &lt; b</description>
+		</item>
+		<item>
+			<title>Second</title>
+			<guid isPermaLink="false">tag:example.com,2020:changes#2</guid>
+			<pubDate>Mon, 02 Mar 2020 08:30:00 +0000</pubDate>
+		</item>
+	</channel>
+</rss>
+`
+	if got := execute(t, tmpl, resp); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEmptyFeed(t *testing.T) {
+	resp := testResult()
+	resp.Tables[0].Rows = nil
+	tmpl := &Template{Format: RSS, BaseURL: "https://example.com"}
+	if got := execute(t, tmpl, resp); strings.Contains(got, "lastBuildDate") {
+		t.Errorf("lastBuildDate without entries:\n%s", got)
+	}
+	tmpl = &Template{Format: Atom, BaseURL: "https://example.com"}
+	if got := execute(t, tmpl, resp); !strings.Contains(got, "<updated>2030-01-01T00:00:00Z</updated>") {
+		t.Errorf("not updated at the request time:\n%s", got)
+	}
+}
+
+func TestIDs(t *testing.T) {
+	resp := testResult()
+	resp.Request.URL.RawQuery = "page=2"
+	resp.Request.Host = "10.0.0.1:8080"
+	resp.Request.Header.Set("X-Forwarded-Proto", "https")
+	tmpl := &Template{Format: Atom, BaseURL: "https://example.com"}
+	got := execute(t, tmpl, resp)
+	for _, want := range []string{
+		"<id>https://example.com/changes</id>",
+		`<link rel="self" href="https://example.com/changes.atom?page=2"></link>`,
+		"<id>https://example.com/changes#1</id>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("no %s in:\n%s", want, got)
+		}
+	}
+
+	// the scheme of the self link is forwarded only behind a proxy
+	tmpl = &Template{Format: Atom, ID: "urn:changes"}
+	if got := execute(t, tmpl, resp); !strings.Contains(got, `href="http://10.0.0.1:8080/changes.atom?page=2"`) {
+		t.Errorf("X-Forwarded-Proto used without proxy:\n%s", got)
+	}
+	tmpl.Proxy = true
+	if got := execute(t, tmpl, resp); !strings.Contains(got, `href="https://10.0.0.1:8080/changes.atom?page=2"`) {
+		t.Errorf("X-Forwarded-Proto not used behind a proxy:\n%s", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	resp := testResult()
+	resp.Tables[0].Rows[1].Values[2] = nil
+	tmpl := &Template{Format: Atom, BaseURL: "https://example.com"}
+	if err := tmpl.Execute(&bytes.Buffer{}, resp); err == nil {
+		t.Error("no error for an entry without updated time")
+	}
+
+	// without BaseURL, the ids would depend on the request
+	tmpl = &Template{Format: Atom}
+	resp = testResult()
+	resp.Request.Host = "example.com"
+	if err := tmpl.Execute(&bytes.Buffer{}, resp); err == nil {
+		t.Error("no error for a feed id from the request")
+	}
+	tmpl = &Template{Format: Atom, Link: "/changes"}
+	if err := tmpl.Execute(&bytes.Buffer{}, resp); err == nil {
+		t.Error("no error for a relative feed id")
+	}
+}
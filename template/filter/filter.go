@@ -0,0 +1,169 @@
+// Package filter implements templates converting the output of another
+// template of the page with an external command, for example an HTML
+// page to PDF with wkhtmltopdf, or a LaTeX document with a script
+// running pdflatex.
+package filter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// DefaultTimeout is the default time limit of a filter command.
+const DefaultTimeout = time.Minute
+
+// Template implements interface sql2http.Template by executing the
+// template of the page registered for extension Template, and writing
+// it to the standard input of Command. The standard output of Command
+// is the output of the template.
+//
+// An error is returned if the command exits with a non-zero status, or
+// if it runs longer than Timeout; its error output is then part of the
+// error message. The command is killed if the context of the Result is
+// cancelled, e.g. when the client goes away. On Unix systems, the
+// processes started by the command are killed with it, as they are in
+// its process group (unless they start their own).
+type Template struct {
+	// Template is the extension of the executed template, e.g. ".tex".
+	Template string
+
+	// Command is the program, looked up in the PATH if it has no
+	// slash, followed by its arguments. It is not run by a shell.
+	Command []string
+
+	// Dir is the working directory of the command. If empty, it is
+	// the one of the server.
+	Dir string
+
+	// Timeout limits the time waited for the command to run. If zero,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Type is the returned Content-Type. If empty,
+	// "application/octet-stream" is used.
+	Type string
+
+	// Concurrency is the maximum number of commands running at the
+	// same time, other requests waiting for one to finish (within
+	// Timeout). If zero, it is not limited.
+	Concurrency int
+
+	once sync.Once
+	sem  chan struct{}
+}
+
+func (t *Template) ContentType() string {
+	if t.Type == "" {
+		return "application/octet-stream"
+	}
+	return t.Type
+}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/filter: only *sql2http.Result can be passed as data")
+	}
+	if len(t.Command) == 0 {
+		return fmt.Errorf("template/filter: no command")
+	}
+	ts := resp.Templates
+	if ts == nil {
+		ts = sql2http.DefaultTemplateSet
+	}
+	tmpl := ts.Get(t.Template)
+	if tmpl == nil {
+		return fmt.Errorf("template/filter: no template for %q", t.Template)
+	}
+	in := &bytes.Buffer{}
+	if err := tmpl.Execute(in, data); err != nil {
+		return err
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	parent := resp.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	if t.Concurrency > 0 {
+		t.once.Do(func() { t.sem = make(chan struct{}, t.Concurrency) })
+		select {
+		case t.sem <- struct{}{}:
+			defer func() { <-t.sem }()
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				return fmt.Errorf("template/filter: %s: %v", t.Command[0], ctx.Err())
+			}
+			return fmt.Errorf("template/filter: %s: timeout waiting for other commands after %v", t.Command[0], timeout)
+		}
+	}
+
+	cmd := exec.Command(t.Command[0], t.Command[1:]...)
+	cmd.Dir = t.Dir
+	cmd.Stdin = in
+	cmd.Stdout = wr
+	stderr := &tailBuffer{max: 1024}
+	cmd.Stderr = stderr
+	setGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("template/filter: %s: %v", t.Command[0], err)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			kill(cmd)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("template/filter: %s: timeout after %v", t.Command[0], timeout)
+	}
+	if ctx.Err() == context.Canceled {
+		return fmt.Errorf("template/filter: %s: %v", t.Command[0], ctx.Err())
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("template/filter: %s: %v: %s", t.Command[0], err, msg)
+		}
+		return fmt.Errorf("template/filter: %s: %v", t.Command[0], err)
+	}
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	b   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > b.max {
+		p = p[len(p)-b.max:]
+	}
+	if extra := len(b.b) + len(p) - b.max; extra > 0 {
+		b.b = b.b[extra:]
+	}
+	b.b = append(b.b, p...)
+	return n, nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.b)
+}
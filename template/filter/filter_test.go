@@ -0,0 +1,80 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+type constTemplate string
+
+func (t constTemplate) Execute(wr io.Writer, data interface{}) error {
+	_, err := io.WriteString(wr, string(t))
+	return err
+}
+
+func (t constTemplate) ContentType() string { return "text/plain" }
+
+func TestExecute(t *testing.T) {
+	ts := &sql2http.TemplateSet{}
+	ts.Register(".txt", constTemplate("hello\nworld\n"))
+	res := &sql2http.Result{Templates: ts}
+
+	tests := []struct {
+		tmpl *Template
+		out  string
+		err  string
+	}{
+		{&Template{Template: ".txt", Command: []string{"cat"}}, "hello\nworld\n", ""},
+		{&Template{Template: ".txt", Command: []string{"wc", "-l"}, Concurrency: 1}, "2", ""},
+		{&Template{Template: ".csv", Command: []string{"cat"}}, "", `no template for ".csv"`},
+		{&Template{Template: ".txt", Command: []string{"sh", "-c", "echo oops >&2; exit 3"}}, "", "exit status 3: oops"},
+		{&Template{Template: ".txt", Command: []string{"sleep", "5"}, Timeout: 50 * time.Millisecond}, "", "timeout after 50ms"},
+		{&Template{Template: ".txt", Command: []string{"sh", "-c", "sleep 5; true"}, Timeout: 50 * time.Millisecond}, "", "timeout after 50ms"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		start := time.Now()
+		err := test.tmpl.Execute(buf, res)
+		name := fmt.Sprint(test.tmpl.Command)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: ran %v", name, d)
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v; want %q", name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if got := strings.TrimSpace(buf.String()); got != strings.TrimSpace(test.out) {
+			t.Errorf("%s: output %q; want %q", name, got, test.out)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ts := &sql2http.TemplateSet{}
+	ts.Register(".txt", constTemplate(""))
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &sql2http.Result{Templates: ts, Context: ctx}
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// the child processes of the command are killed too
+	tmpl := &Template{Template: ".txt", Command: []string{"sh", "-c", "sleep 5; true"}}
+	start := time.Now()
+	err := tmpl.Execute(&bytes.Buffer{}, res)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("error %v; want context canceled", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("command ran %v after the context was cancelled", d)
+	}
+}
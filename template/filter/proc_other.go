@@ -0,0 +1,14 @@
+//go:build windows || plan9 || js
+// +build windows plan9 js
+
+package filter
+
+import "os/exec"
+
+// setGroup does nothing: process groups are not supported.
+func setGroup(cmd *exec.Cmd) {}
+
+// kill kills the started command, but not its children.
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
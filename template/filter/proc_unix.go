@@ -0,0 +1,21 @@
+//go:build !windows && !plan9 && !js
+// +build !windows,!plan9,!js
+
+package filter
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setGroup makes the command start its own process group, so that kill
+// also stops its children (e.g. pdflatex run by a script), which would
+// otherwise hold the output pipe open.
+func setGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kill kills the process group of the started command.
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
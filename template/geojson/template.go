@@ -0,0 +1,322 @@
+// Package geojson implements a GeoJSON (RFC 7946) template, writing a
+// FeatureCollection with one Feature per row of a result table.
+//
+// The geometry of each feature comes from either:
+//
+//     - a GeoJSON text column (Template.GeoJSON),
+//     - a WKT text column (Template.WKT), also accepting the PostGIS
+//       EWKT "SRID=4326;" prefix,
+//     - or latitude and longitude columns (Template.Lat, Template.Lon).
+//
+// If none is configured, columns named "geojson", "wkt", or "lat" and
+// "lon" are used, in that order. All the other columns become the
+// feature properties.
+//
+// A row whose geometry cannot be parsed does not abort the response: its
+// feature gets a null geometry and an "error" member explaining why.
+package geojson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".geojson"
+	ContentType = "application/geo+json"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer.
+type Template struct {
+	// Columns holding the geometry; see the package documentation.
+	GeoJSON string
+	WKT     string
+	Lat     string
+	Lon     string
+
+	// ID is the column used as feature identifier. If empty, features
+	// have no identifier.
+	ID string
+
+	// Table is the name of the query whose rows are the features. If
+	// empty, the first query is used.
+	Table string
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are geojson, wkt, lat, lon, id (column names), and table.
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		switch k {
+		case "geojson":
+			c.GeoJSON = v
+		case "wkt":
+			c.WKT = v
+		case "lat":
+			c.Lat = v
+		case "lon":
+			c.Lon = v
+		case "id":
+			c.ID = v
+		case "table":
+			c.Table = v
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return &c, nil
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/geojson: only *sql2http.Result can be passed as data")
+	}
+	var tbl *sql2http.Table
+	for i := range resp.Tables {
+		if t.Table == "" || resp.Tables[i].Name == t.Table {
+			tbl = &resp.Tables[i]
+			break
+		}
+	}
+	if tbl == nil && t.Table != "" {
+		return fmt.Errorf("template/geojson: no query named %q", t.Table)
+	}
+	w := bufio.NewWriter(wr)
+	w.WriteString(`{"type":"FeatureCollection","features":[`)
+	if tbl != nil {
+		src, err := t.source(tbl.Header)
+		if err != nil {
+			return fmt.Errorf("template/geojson: %v", err)
+		}
+		for i, row := range tbl.Rows {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString("\n")
+			b, err := json.Marshal(src.feature(row))
+			if err != nil {
+				return fmt.Errorf("template/geojson: row %d: %v", i+1, err)
+			}
+			w.Write(b)
+		}
+	}
+	w.WriteString("\n]}\n")
+	return w.Flush()
+}
+
+// source is the resolved geometry source of a table.
+type source struct {
+	geojson, wkt, lat, lon, id int // column indexes, -1 if unused
+	header                     []string
+}
+
+func (t *Template) source(header []string) (*source, error) {
+	index := func(name string) int {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+		return -1
+	}
+	s := &source{geojson: -1, wkt: -1, lat: -1, lon: -1, id: -1, header: header}
+	col := func(name string) (int, error) {
+		if i := index(name); i >= 0 {
+			return i, nil
+		}
+		return -1, fmt.Errorf("no column named %q", name)
+	}
+	var err error
+	if t.ID != "" {
+		if s.id, err = col(t.ID); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case t.GeoJSON != "":
+		s.geojson, err = col(t.GeoJSON)
+	case t.WKT != "":
+		s.wkt, err = col(t.WKT)
+	case t.Lat != "" || t.Lon != "":
+		if s.lat, err = col(t.Lat); err == nil {
+			s.lon, err = col(t.Lon)
+		}
+	case index("geojson") >= 0:
+		s.geojson = index("geojson")
+	case index("wkt") >= 0:
+		s.wkt = index("wkt")
+	case index("lat") >= 0 && index("lon") >= 0:
+		s.lat, s.lon = index("lat"), index("lon")
+	default:
+		err = fmt.Errorf("no geometry column found")
+	}
+	return s, err
+}
+
+type feature struct {
+	Type       string          `json:"type"`
+	ID         interface{}     `json:"id,omitempty"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties properties      `json:"properties"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func (s *source) feature(row sql2http.Row) *feature {
+	f := &feature{Type: "Feature", Geometry: json.RawMessage("null")}
+	geom, err := s.geometry(row.Values)
+	if err != nil {
+		f.Error = err.Error()
+	} else if geom != nil {
+		f.Geometry = geom
+	}
+	if s.id >= 0 {
+		f.ID = jsonValue(row.Values[s.id])
+	}
+	for i, v := range row.Values {
+		switch i {
+		case s.geojson, s.wkt, s.lat, s.lon, s.id:
+			continue
+		}
+		f.Properties = append(f.Properties, property{s.header[i], jsonValue(v)})
+	}
+	return f
+}
+
+// geometry returns the GeoJSON geometry of the row values, or nil if the
+// geometry is NULL.
+func (s *source) geometry(values []interface{}) (json.RawMessage, error) {
+	switch {
+	case s.geojson >= 0:
+		v := values[s.geojson]
+		if v == nil {
+			return nil, nil
+		}
+		b := []byte(fmt.Sprint(v))
+		var g struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(b, &g); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+		}
+		if g.Type == "" {
+			return nil, fmt.Errorf("invalid GeoJSON: missing geometry type")
+		}
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, b); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case s.wkt >= 0:
+		v := values[s.wkt]
+		if v == nil {
+			return nil, nil
+		}
+		g, err := ParseWKT(fmt.Sprint(v))
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(g)
+	}
+	lat, lon := values[s.lat], values[s.lon]
+	if lat == nil || lon == nil {
+		return nil, nil
+	}
+	y, err := number(lat)
+	if err != nil || y < -90 || y > 90 {
+		return nil, fmt.Errorf("invalid latitude %v", lat)
+	}
+	x, err := number(lon)
+	if err != nil || x < -180 || x > 180 {
+		return nil, fmt.Errorf("invalid longitude %v", lon)
+	}
+	return json.Marshal(&Geometry{Type: "Point", Coordinates: []float64{x, y}})
+}
+
+// number returns the finite number of v.
+func number(v interface{}) (float64, error) {
+	var f float64
+	switch v := v.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(v, 64); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("not a finite number: %v", v)
+	}
+	return f, nil
+}
+
+// jsonValue returns v, replacing the float values which cannot be
+// represented in JSON (NaN and infinities) by nil.
+func jsonValue(v interface{}) interface{} {
+	switch f := v.(type) {
+	case float64:
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil
+		}
+	case float32:
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return nil
+		}
+	}
+	return v
+}
+
+type property struct {
+	key   string
+	value interface{}
+}
+
+// properties is a JSON object keeping the order of its members.
+type properties []property
+
+func (p properties) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, kv := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(kv.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(kv.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
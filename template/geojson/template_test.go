@@ -0,0 +1,77 @@
+package geojson
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		header []string
+		rows   [][]interface{}
+		errors []bool // whether each feature has an error member
+	}{
+		{
+			[]string{"name", "lat", "lon"},
+			[][]interface{}{
+				{"a", 46.5, 6.6},
+				{"b", math.NaN(), 6.6},
+				{"c", "47.4", "8.5"},
+				{"d", "46.5", "Inf"},
+				{"e", nil, nil},
+			},
+			[]bool{false, true, false, true, false},
+		},
+		{
+			[]string{"name", "wkt"},
+			[][]interface{}{
+				{"a", "POINT (6.6 46.5)"},
+				{"b", "POINT (NaN 46.5)"},
+				{"c", "LINESTRING (1 2, 3 4)"},
+			},
+			[]bool{false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		tbl := sql2http.Table{Header: tt.header}
+		for _, v := range tt.rows {
+			tbl.Rows = append(tbl.Rows, sql2http.Row{Header: tt.header, Values: v})
+		}
+		var buf bytes.Buffer
+		err := (&Template{}).Execute(&buf, &sql2http.Result{Tables: sql2http.Tables{tbl}})
+		if err != nil {
+			t.Errorf("%v: %v", tt.header, err)
+			continue
+		}
+		var fc struct {
+			Features []struct {
+				Geometry   json.RawMessage
+				Properties map[string]interface{}
+				Error      string
+			}
+		}
+		if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+			t.Errorf("%v: invalid JSON: %v\n%s", tt.header, err, buf.Bytes())
+			continue
+		}
+		if len(fc.Features) != len(tt.rows) {
+			t.Errorf("%v: %d features; want %d", tt.header, len(fc.Features), len(tt.rows))
+			continue
+		}
+		for i, f := range fc.Features {
+			if hasErr := f.Error != ""; hasErr != tt.errors[i] {
+				t.Errorf("%v: feature %d: error %q", tt.header, i, f.Error)
+			}
+			if f.Error != "" && string(f.Geometry) != "null" {
+				t.Errorf("%v: feature %d: geometry %s with error", tt.header, i, f.Geometry)
+			}
+			if f.Properties["name"] != tt.rows[i][0] {
+				t.Errorf("%v: feature %d: name %v", tt.header, i, f.Properties["name"])
+			}
+		}
+	}
+}
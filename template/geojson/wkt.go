@@ -0,0 +1,257 @@
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Geometry is a GeoJSON geometry object.
+type Geometry struct {
+	Type string
+
+	// Coordinates is []float64 for a Point, [][]float64 for a
+	// LineString or MultiPoint, [][][]float64 for a Polygon or
+	// MultiLineString, and [][][][]float64 for a MultiPolygon.
+	Coordinates interface{}
+
+	// Geometries holds the members of a GeometryCollection.
+	Geometries []*Geometry
+}
+
+// MarshalJSON implements interface json.Marshaler.
+func (g *Geometry) MarshalJSON() ([]byte, error) {
+	if g.Type == "GeometryCollection" {
+		geoms := g.Geometries
+		if geoms == nil {
+			geoms = []*Geometry{}
+		}
+		return json.Marshal(struct {
+			Type       string      `json:"type"`
+			Geometries []*Geometry `json:"geometries"`
+		}{g.Type, geoms})
+	}
+	return json.Marshal(struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}{g.Type, g.Coordinates})
+}
+
+// wktTypes maps the WKT geometry types to their GeoJSON name.
+var wktTypes = map[string]string{
+	"POINT":              "Point",
+	"LINESTRING":         "LineString",
+	"POLYGON":            "Polygon",
+	"MULTIPOINT":         "MultiPoint",
+	"MULTILINESTRING":    "MultiLineString",
+	"MULTIPOLYGON":       "MultiPolygon",
+	"GEOMETRYCOLLECTION": "GeometryCollection",
+}
+
+// ParseWKT parses the Well-Known Text representation of a geometry, with
+// an optional EWKT "SRID=n;" prefix. Z coordinates are kept, and M
+// coordinates are dropped.
+func ParseWKT(s string) (*Geometry, error) {
+	if strings.HasPrefix(strings.ToUpper(s), "SRID=") {
+		i := strings.IndexByte(s, ';')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid WKT: missing ';' after SRID")
+		}
+		s = s[i+1:]
+	}
+	p := &wktParser{s: s}
+	g, err := p.geometry()
+	if err == nil {
+		if tok := p.next(); tok != "" {
+			err = fmt.Errorf("unexpected %q", tok)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid WKT: %v", err)
+	}
+	return g, nil
+}
+
+type wktParser struct {
+	s    string
+	pos  int
+	dims string // "", "Z", "M" or "ZM" of the current geometry
+}
+
+// next returns the next token: a word, a number, or one of "(),".
+// It returns "" at the end of input.
+func (p *wktParser) next() string {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return ""
+	}
+	start := p.pos
+	if strings.IndexByte("(),", p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[start:p.pos]
+	}
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n(),", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *wktParser) peek() string {
+	pos := p.pos
+	tok := p.next()
+	p.pos = pos
+	return tok
+}
+
+func (p *wktParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, found %q", tok, got)
+	}
+	return nil
+}
+
+func (p *wktParser) geometry() (*Geometry, error) {
+	word := strings.ToUpper(p.next())
+	typ, ok := wktTypes[word]
+	if !ok {
+		return nil, fmt.Errorf("unknown geometry type %q", word)
+	}
+	g := &Geometry{Type: typ}
+	p.dims = ""
+	switch d := strings.ToUpper(p.peek()); d {
+	case "Z", "M", "ZM":
+		p.dims = d
+		p.next()
+	}
+	if strings.ToUpper(p.peek()) == "EMPTY" {
+		p.next()
+		if typ != "GeometryCollection" {
+			g.Coordinates = []float64{}
+		}
+		return g, nil
+	}
+	var err error
+	switch typ {
+	case "Point":
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		if g.Coordinates, err = p.coord(); err != nil {
+			return nil, err
+		}
+		err = p.expect(")")
+	case "LineString":
+		g.Coordinates, err = p.coords()
+	case "Polygon", "MultiLineString":
+		g.Coordinates, err = p.rings()
+	case "MultiPoint":
+		g.Coordinates, err = p.multiPoint()
+	case "MultiPolygon":
+		var polys [][][][]float64
+		err = p.list(func() error {
+			rings, err := p.rings()
+			polys = append(polys, rings)
+			return err
+		})
+		g.Coordinates = polys
+	case "GeometryCollection":
+		err = p.list(func() error {
+			member, err := p.geometry()
+			g.Geometries = append(g.Geometries, member)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// list parses a parenthesized, comma separated list, calling item for
+// each element.
+func (p *wktParser) list(item func() error) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		switch tok := p.next(); tok {
+		case ",":
+		case ")":
+			return nil
+		default:
+			return fmt.Errorf("expected \",\" or \")\", found %q", tok)
+		}
+	}
+}
+
+func (p *wktParser) coord() ([]float64, error) {
+	var c []float64
+	for {
+		tok := p.peek()
+		if tok == "" || tok == "," || tok == ")" || tok == "(" {
+			break
+		}
+		p.next()
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid coordinate %q", tok)
+		}
+		c = append(c, f)
+	}
+	if len(c) < 2 || len(c) > 4 {
+		return nil, fmt.Errorf("invalid position with %d coordinates", len(c))
+	}
+	if len(c) == 4 || p.dims == "M" && len(c) == 3 {
+		c = c[:len(c)-1] // drop M
+	}
+	return c, nil
+}
+
+func (p *wktParser) coords() ([][]float64, error) {
+	var cs [][]float64
+	err := p.list(func() error {
+		c, err := p.coord()
+		cs = append(cs, c)
+		return err
+	})
+	return cs, err
+}
+
+func (p *wktParser) rings() ([][][]float64, error) {
+	var rs [][][]float64
+	err := p.list(func() error {
+		r, err := p.coords()
+		rs = append(rs, r)
+		return err
+	})
+	return rs, err
+}
+
+// multiPoint accepts both MULTIPOINT (1 2, 3 4) and
+// MULTIPOINT ((1 2), (3 4)).
+func (p *wktParser) multiPoint() ([][]float64, error) {
+	var cs [][]float64
+	err := p.list(func() error {
+		paren := p.peek() == "("
+		if paren {
+			p.next()
+		}
+		c, err := p.coord()
+		if err != nil {
+			return err
+		}
+		cs = append(cs, c)
+		if paren {
+			return p.expect(")")
+		}
+		return nil
+	})
+	return cs, err
+}
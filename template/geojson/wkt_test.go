@@ -0,0 +1,52 @@
+package geojson
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var wktTests = []struct {
+	in   string
+	want string // JSON encoding; empty if an error is expected
+}{
+	{"POINT (30 10)", `{"type":"Point","coordinates":[30,10]}`},
+	{"SRID=4326;POINT Z (1 2 3)", `{"type":"Point","coordinates":[1,2,3]}`},
+	{"point m (1 2 3)", `{"type":"Point","coordinates":[1,2]}`},
+	{"LINESTRING (30 10, 10 30, 40 40)", `{"type":"LineString","coordinates":[[30,10],[10,30],[40,40]]}`},
+	{"POLYGON ((30 10, 40 40, 20 40, 30 10))", `{"type":"Polygon","coordinates":[[[30,10],[40,40],[20,40],[30,10]]]}`},
+	{"MULTIPOINT ((10 40), (40 30))", `{"type":"MultiPoint","coordinates":[[10,40],[40,30]]}`},
+	{"MULTIPOINT (10 40, 40 30)", `{"type":"MultiPoint","coordinates":[[10,40],[40,30]]}`},
+	{"MULTIPOLYGON (((1 1, 2 2, 1 2, 1 1)), ((5 5, 6 6, 5 6, 5 5)))", `{"type":"MultiPolygon","coordinates":[[[[1,1],[2,2],[1,2],[1,1]]],[[[5,5],[6,6],[5,6],[5,5]]]]}`},
+	{"GEOMETRYCOLLECTION (POINT (4 6), LINESTRING (4 6, 7 10))", `{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[4,6]},{"type":"LineString","coordinates":[[4,6],[7,10]]}]}`},
+	{"GEOMETRYCOLLECTION EMPTY", `{"type":"GeometryCollection","geometries":[]}`},
+	{"POINT (30)", ""},
+	{"POINT (30 10", ""},
+	{"CIRCLE (1 2)", ""},
+	{"POINT (1 2) trailing", ""},
+	{"POINT (NaN 2)", ""},
+	{"LINESTRING (1 2, 3 +Inf)", ""},
+}
+
+func TestParseWKT(t *testing.T) {
+	for _, tc := range wktTests {
+		g, err := ParseWKT(tc.in)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		b, err := json.Marshal(g)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if string(b) != tc.want {
+			t.Errorf("%q:\n got %s\nwant %s", tc.in, b, tc.want)
+		}
+	}
+}
@@ -2,14 +2,11 @@ package html
 
 import (
 	"html/template"
-	"io/ioutil"
-	"log"
-	"os"
-	gopath "path"
-	"path/filepath"
+	"mime"
 	"strings"
 
 	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
 )
 
 func init() {
@@ -25,75 +22,194 @@ const (
 // interface sql2http.Template (with ContentType method).
 type Template struct {
 	*template.Template
+
+	contentType string               // overrides ContentType if not empty
+	pages       map[string]*Template // the pages of a tree, see ParseTree
 }
 
 // ContentType implements interface sql2http.Template.
-// It returns the constant string ContentType.
-func (t *Template) ContentType() string { return ContentType }
+// It returns the constant string ContentType, unless the template was
+// parsed with a different content type (see ParseTreeExt).
+func (t *Template) ContentType() string {
+	if t.contentType != "" {
+		return t.contentType
+	}
+	return ContentType
+}
 
 // Lookup returns the template associated with t with given name. This
-// method is particularly useful with ParseTree.
+// method is particularly useful with ParseTree, in which case the name
+// is the one of a page.
 //
 // If no such template exists, nil is returned.
 func (t *Template) Lookup(name string) *Template {
 	if t == nil {
 		return nil
 	}
+	if t.pages != nil {
+		return t.pages[name]
+	}
 	tmpl := t.Template.Lookup(name)
 	if tmpl == nil {
 		return nil
 	}
-	return &Template{Template: tmpl}
+	return &Template{Template: tmpl, contentType: t.contentType}
 }
 
-// New wraps the standard library html/template.New.
-// It is a simple helper function to avoid importing the standard library.
+// New wraps the standard library html/template.New, adding
+// sql2http.TemplateFuncs to the template functions.
 func New(name string) *Template {
-	return &Template{Template: template.New(name)}
+	return &Template{Template: template.New(name).Funcs(templateFuncs)}
+}
+
+// templateFuncs are sql2http.TemplateFuncs, with the result of json
+// typed as template.JS, so that it is not escaped again. The results of
+// query and urlpath are strings, escaped and filtered like any URL: a
+// URL with a query is written by a single action, e.g.
+//
+//     <a href="{{printf "%s?%s" (urlpath $.Pattern "id" 3) (query "page" 2)}}">
+var templateFuncs = func() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, fn := range sql2http.TemplateFuncs {
+		funcs[name] = fn
+	}
+	json := funcs["json"].(func(interface{}) (string, error))
+	funcs["json"] = func(v interface{}) (template.JS, error) {
+		s, err := json(v)
+		return template.JS(s), err
+	}
+	funcs["inputattrs"] = inputAttrs
+	funcs["isnull"] = isNull
+	funcs["isnumber"] = isNumber
+	return funcs
+}()
+
+// isNull reports whether v is a NULL value.
+func isNull(v interface{}) bool { return v == nil }
+
+// isNumber reports whether v is a numeric value: either of a Go numeric
+// type, or a string of a column of the given numeric SQL type, as
+// drivers return e.g. DECIMAL values (see sql2http.Table.Type).
+func isNumber(v interface{}, sqlType ...string) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	case string:
+		return len(sqlType) > 0 && numericType(sqlType[0])
+	}
+	return false
+}
+
+// numericType reports whether the SQL type name typ is numeric.
+func numericType(typ string) bool {
+	typ = strings.ToLower(typ)
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = typ[:i] // e.g. DECIMAL(10,2)
+	}
+	switch {
+	case strings.Contains(typ, "int") && !strings.Contains(typ, "interval") && !strings.Contains(typ, "point"):
+		return true
+	case strings.HasPrefix(typ, "float") || strings.HasPrefix(typ, "double") || strings.HasPrefix(typ, "unsigned"):
+		return true
+	}
+	switch strings.TrimSpace(typ) {
+	case "decimal", "numeric", "number", "dec", "real", "money", "smallmoney", "serial", "bigserial":
+		return true
+	}
+	return false
+}
+
+// inputAttrs returns the type attribute, and the related attributes, of
+// the html input for a value of the given SQL type (see
+// sql2http.Input).
+func inputAttrs(sqlType string) template.HTMLAttr {
+	typ := strings.ToLower(sqlType)
+	switch {
+	case strings.Contains(typ, "int") || typ == "serial" || typ == "bigserial":
+		return `type="number" step="1"`
+	case typ == "numeric" || typ == "decimal" || typ == "real" || typ == "money" ||
+		strings.HasPrefix(typ, "float") || strings.HasPrefix(typ, "double"):
+		return `type="number" step="any"`
+	case typ == "date":
+		return `type="date"`
+	case strings.HasPrefix(typ, "timestamp") || typ == "datetime" || typ == "datetime2" || typ == "smalldatetime":
+		return `type="datetime-local"`
+	case strings.HasPrefix(typ, "time"):
+		return `type="time"`
+	}
+	return `type="text"`
 }
 
 // ParseTree creates a new Template, walks recursively the files starting
 // at the given directory, and for each file ending with ".html" parses
 // the template definition under the relative file name.
-// The returned template is the first matching file.
+// The returned template is the first matching file; the others are
+// returned by its Lookup method.
+//
+// The files under _partials/ and _layouts/ are not pages: they define
+// templates shared by all pages, and layouts pages can extend (see
+// package git.sr.ht/~detaoin/sql2http/internal/tree). Each page is
+// parsed in its own namespace, so that pages can define the blocks of
+// their layout. For example, with _layouts/base.html:
+//
+//     <html><body>{{template "nav" .}}{{block "main" .}}{{end}}</body></html>
+//
+// and _partials/nav.html defining the "nav" template, a page can be:
+//
+//     {{/* layout: base */}}
+//     {{define "main"}}<p>page content</p>{{end}}
+//
+// A file may also override its content type with a leading directive:
+//
+//     {{/* content-type: application/xhtml+xml */}}
 func ParseTree(dir string) (*Template, error) {
+	return ParseTreeExt(dir, Ext)
+}
+
+// ParseTreeExt is like ParseTree, for the files ending with the given
+// extension, e.g. ".htm". The content type of the templates is
+// given by mime.TypeByExtension, unless overridden by the files.
+func ParseTreeExt(dir, ext string) (*Template, error) {
+	tr, err := tree.Read(dir, ext, "{{", "}}")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := tr.Parse(namespace{New("").Template}, ext)
+	if err != nil {
+		return nil, err
+	}
 	var t *Template
-	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if fi.IsDir() || filepath.Ext(path) != Ext {
-			return nil
-		}
-		name, err := filepath.Rel(dir, path)
-		if err != nil {
-			return err
+	pages := make(map[string]*Template)
+	for _, p := range parsed {
+		tmpl := p.Namespace.(namespace).Lookup(p.Main)
+		ct := p.Directives[tree.ContentType]
+		if ct == "" && ext != Ext {
+			ct = mime.TypeByExtension(ext)
 		}
-		name = strings.TrimSuffix(name, Ext)
-		name = gopath.Clean("/" + filepath.ToSlash(name))
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		s := string(b)
+		page := &Template{Template: tmpl, contentType: ct, pages: pages}
+		pages[p.Name] = page
 		if t == nil {
-			t = New(name)
-		}
-		var tmpl *template.Template
-		if name == t.Name() {
-			tmpl = t.Template
-		} else {
-			tmpl = t.New(name)
+			t = page
 		}
-		log.Println("found template", name, Ext)
-		_, err = tmpl.Parse(s)
-		return err
-	})
-	return t, err
+	}
+	return t, nil
 }
 
 var DefaultTemplate = must(New("_default.html").Parse(DefaultHTML))
 
+// namespace implements interface tree.Namespace.
+type namespace struct{ *template.Template }
+
+func (ns namespace) Parse(name, text string) error {
+	_, err := ns.New(name).Parse(text)
+	return err
+}
+
+func (ns namespace) Clone() (tree.Namespace, error) {
+	t, err := ns.Template.Clone()
+	return namespace{t}, err
+}
+
 func must(t *template.Template, err error) *Template {
 	if err != nil {
 		panic(err)
@@ -101,18 +217,52 @@ func must(t *template.Template, err error) *Template {
 	return &Template{Template: t}
 }
 
-// The default html template.
+// The default html template. Its tables can be sorted by clicking their
+// headers, filtered, and are paged by 100 rows; without JavaScript they
+// are shown in full. NULL values are shown as a grayed "NULL", and
+// numbers are right-aligned. It needs no external resource.
 // It is exported for documentation purposes (can be used as a basis
 // for your more elaborate templates).
 const DefaultHTML = `<!DOCTYPE html>
 <html>
 <head>
 <meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Results{{with .Request}} for {{.URL.Path}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.table { max-height: 80vh; overflow: auto; }
+table { border-collapse: collapse; }
+th, td { padding: .2em .6em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+thead th { position: sticky; top: 0; background: #eee; }
+th.sortable { cursor: pointer; }
+th[aria-sort=ascending]::after { content: " \25B2"; }
+th[aria-sort=descending]::after { content: " \25BC"; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+td.null { color: #999; font-style: italic; }
+.controls { display: none; margin: .5em 0; }
+.js .controls { display: block; }
+.count { color: #666; }
+</style>
 </head>
 <body>
 <h1>Results{{with .Request}} for {{.URL.EscapedPath}}{{end}}</h1>
-{{range .Tables}}
-	<p>{{.Name}}</p>
+{{with .Form}}
+<form action="{{.Action}}" method="{{.Method}}">
+	{{range .Inputs -}}
+	<p><label>{{.Name}} <input name="{{.Name}}" {{inputattrs .Type}}{{with .Value}} value="{{.}}"{{end}}></label></p>
+	{{end -}}
+	<p><button type="submit">{{if eq .Method "GET"}}Search{{else}}Submit{{end}}</button></p>
+</form>
+{{end}}
+{{range .Tables}}{{$table := .}}
+<section class="result">
+	<h2>{{.Name}}</h2>
+	<div class="controls">
+		<input type="search" placeholder="Filter" aria-label="Filter {{.Name}}">
+		<span class="pages"></span>
+	</div>
+	<div class="table">
 	<table>
 		<thead>
 			<tr>
@@ -124,18 +274,102 @@ const DefaultHTML = `<!DOCTYPE html>
 		<tbody>
 			{{range .Rows}}
 			<tr>
-				{{range .Values -}}
-				<td>{{.}}</td>
+				{{range $i, $v := .Values -}}
+				{{if isnull $v}}<td class="null">NULL</td>{{else if isnumber $v ($table.Type $i)}}<td class="num">{{$v}}</td>{{else}}<td>{{$v}}</td>{{end}}
 				{{- end}}
 			</tr>
 			{{end}}
 		</tbody>
 	</table>
-{{else}}
+	</div>
+	<p class="count">{{len .Rows}} rows</p>
+</section>
+{{else}}{{if not .Form}}
 	<p>No data available.</p>
-{{end}}
+{{end}}{{end}}
 <footer>
 </footer>
+<script>
+(function() {
+	var pageSize = 100;
+	var each = function(list, fn) { Array.prototype.forEach.call(list, fn); };
+	document.documentElement.className += " js";
+
+	// key returns the sort key of a cell: null for NULL, a number for
+	// numeric cells, else the cell text.
+	function key(td) {
+		if (td.className === "null") return null;
+		if (td.className === "num") return parseFloat(td.textContent);
+		return td.textContent;
+	}
+	function compare(a, b) {
+		if (a === null || b === null) return (a === null ? 0 : 1) - (b === null ? 0 : 1);
+		if (typeof a === "number" && typeof b === "number") return a - b;
+		return String(a).localeCompare(String(b));
+	}
+
+	each(document.querySelectorAll("section.result"), function(sec) {
+		var tbody = sec.querySelector("tbody");
+		var filter = sec.querySelector(".controls input");
+		var pages = sec.querySelector(".controls .pages");
+		var count = sec.querySelector(".count");
+		var rows = Array.prototype.slice.call(tbody.rows);
+		var shown = rows, page = 0;
+		each(rows, function(r, i) { r.index = i; });
+
+		function button(label, p) {
+			var b = document.createElement("button");
+			b.type = "button";
+			b.textContent = label;
+			b.disabled = p < 0 || p * pageSize >= shown.length;
+			b.onclick = function() { page = p; render(); };
+			return b;
+		}
+		function render() {
+			var n = Math.max(1, Math.ceil(shown.length / pageSize));
+			page = Math.min(page, n - 1);
+			while (tbody.firstChild) tbody.removeChild(tbody.firstChild);
+			each(shown.slice(page * pageSize, (page + 1) * pageSize), function(r) { tbody.appendChild(r); });
+			count.textContent = shown.length === rows.length ?
+				rows.length + " rows" : shown.length + " of " + rows.length + " rows";
+			pages.textContent = "";
+			if (n > 1) {
+				pages.appendChild(button("\u2039", page - 1));
+				pages.appendChild(document.createTextNode(" page " + (page + 1) + " of " + n + " "));
+				pages.appendChild(button("\u203A", page + 1));
+			}
+		}
+		function apply() {
+			var s = filter.value.toLowerCase();
+			shown = s === "" ? rows : rows.filter(function(r) {
+				return r.textContent.toLowerCase().indexOf(s) >= 0;
+			});
+			render();
+		}
+		filter.addEventListener("input", function() { page = 0; apply(); });
+
+		var headers = sec.querySelectorAll("thead th");
+		each(headers, function(th, col) {
+			th.className = "sortable";
+			th.tabIndex = 0;
+			function sort() {
+				var dir = th.getAttribute("aria-sort") === "ascending" ? -1 : 1;
+				each(headers, function(h) { h.removeAttribute("aria-sort"); });
+				th.setAttribute("aria-sort", dir > 0 ? "ascending" : "descending");
+				rows.sort(function(a, b) {
+					return dir * compare(key(a.cells[col]), key(b.cells[col])) || a.index - b.index;
+				});
+				apply();
+			}
+			th.addEventListener("click", sort);
+			th.addEventListener("keydown", function(e) {
+				if (e.key === "Enter" || e.key === " ") { e.preventDefault(); sort(); }
+			});
+		});
+		render();
+	});
+})();
+</script>
 </body>
 </html>
 `
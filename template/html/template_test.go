@@ -0,0 +1,93 @@
+package html
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestIsNumber(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		typ  []string
+		want bool
+	}{
+		{int64(1), nil, true},
+		{1.5, nil, true},
+		{"1.50", nil, false},
+		{"1.50", []string{"DECIMAL"}, true},
+		{"1.50", []string{"numeric(10,2)"}, true},
+		{"12", []string{"BIGINT"}, true},
+		{"1 day", []string{"INTERVAL"}, false},
+		{"(1,2)", []string{"POINT"}, false},
+		{"abc", []string{"VARCHAR"}, false},
+		{nil, []string{"DECIMAL"}, false},
+		{"", []string{""}, false},
+	}
+	for _, tt := range tests {
+		if got := isNumber(tt.v, tt.typ...); got != tt.want {
+			t.Errorf("isNumber(%#v, %q) = %v; want %v", tt.v, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestURLFuncs(t *testing.T) {
+	tmpl, err := New("urls").Parse(`<a href="{{printf "%s?%s" (urlpath "/:a/:b" "a" .A "b" "x") (query "page" 2 "q" "a b")}}"></a>` +
+		`<a href="{{urlpath "*p" "p" .P}}"></a>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, map[string]string{"A": "a b", "P": "javascript:alert(1)"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<a href="/a%20b/x?page=2&amp;q=a&#43;b"></a><a href="#ZgotmplZ"></a>`
+	if got := buf.String(); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	header := []string{"id", "price", "name", "note"}
+	res := &sql2http.Result{
+		Pattern: "/add/:id",
+		Params:  map[string]interface{}{"id": "1", "name": "<b>"},
+		Request: sql2http.Request{URL: &url.URL{Path: "/add/1"}},
+		Queries: []sql2http.Query{{
+			Params: []string{"id", "name", "price"},
+			Types:  []string{"", "", "decimal"},
+		}},
+		Tables: sql2http.Tables{{
+			Name:   "added",
+			Header: header,
+			Types:  []string{"INTEGER", "DECIMAL", "VARCHAR", "TEXT"},
+			Rows: []sql2http.Row{{Header: header, Values: []interface{}{
+				int64(1), "12.50", "<b>", nil,
+			}}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := DefaultTemplate.Execute(&buf, res); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<form action="/add/1" method="GET">`,
+		`<input name="name" type="text" value="&lt;b&gt;">`,
+		`<input name="price" type="number" step="any">`,
+		`<td class="num">1</td>`,
+		`<td class="num">12.50</td>`,
+		`<td>&lt;b&gt;</td>`,
+		`<td class="null">NULL</td>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
@@ -0,0 +1,371 @@
+// Package ics implements an iCalendar (RFC 5545) template, writing one
+// event (VEVENT) per row of a result table.
+package ics
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".ics"
+	ContentType = "text/calendar; charset=utf-8"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Columns maps the result columns to the event properties. Empty
+// values default to the lowercase property name (e.g. "dtstart").
+type Columns struct {
+	Start       string
+	End         string
+	Summary     string
+	Description string
+	Location    string
+	UID         string
+}
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer by writing the rows of a table as calendar
+// events.
+//
+// Date-times are written in UTC. Values of columns with a DATE
+// database type, or date strings without time, are written as dates
+// (all-day events). The end of an event is written with the value type
+// of its start, as required by RFC 5545: the date of the end time of
+// an all-day event, or midnight of the end date of a timed event.
+//
+// The UID of an event must not change when the event is edited, so it is
+// either read from the uid column, or else derived from the table name
+// and the values of the Key columns, e.g. the primary key of the events.
+type Template struct {
+	Columns Columns
+
+	// Table is the name of the query whose rows are the events. If
+	// empty, the first query is used.
+	Table string
+
+	// Key are the columns identifying an event, for the rows without
+	// uid value. They must not be NULL.
+	Key []string
+
+	// Name is the calendar name shown by calendar applications. If
+	// empty, the request path is used.
+	Name string
+
+	// Location is the time zone of date-times stored without zone:
+	// strings, and time.Time values in UTC read from columns without
+	// time zone (drivers such as sqlite3 or mysql return those in UTC).
+	// If nil, such values are taken as UTC.
+	Location *time.Location
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are:
+//
+//     dtstart, dtend, summary, description, location, uid: column names
+//     table:    name of the events query
+//     key:      comma-separated key columns, for rows without uid
+//     name:     calendar name
+//     timezone: time zone of date-times without zone (e.g. Europe/Zurich)
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		switch k {
+		case "dtstart":
+			c.Columns.Start = v
+		case "dtend":
+			c.Columns.End = v
+		case "summary":
+			c.Columns.Summary = v
+		case "description":
+			c.Columns.Description = v
+		case "location":
+			c.Columns.Location = v
+		case "uid":
+			c.Columns.UID = v
+		case "table":
+			c.Table = v
+		case "key":
+			c.Key = nil
+			for _, k := range strings.Split(v, ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					c.Key = append(c.Key, k)
+				}
+			}
+		case "name":
+			c.Name = v
+		case "timezone":
+			loc, err := time.LoadLocation(v)
+			if err != nil {
+				return nil, fmt.Errorf("option timezone: %v", err)
+			}
+			c.Location = loc
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return &c, nil
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/ics: only *sql2http.Result can be passed as data")
+	}
+	var tbl *sql2http.Table
+	for i := range resp.Tables {
+		if t.Table == "" || resp.Tables[i].Name == t.Table {
+			tbl = &resp.Tables[i]
+			break
+		}
+	}
+	if tbl == nil && t.Table != "" {
+		return fmt.Errorf("template/ics: no query named %q", t.Table)
+	}
+	cols := t.Columns
+	def := func(s *string, name string) {
+		if *s == "" {
+			*s = name
+		}
+	}
+	def(&cols.Start, "dtstart")
+	def(&cols.End, "dtend")
+	def(&cols.Summary, "summary")
+	def(&cols.Description, "description")
+	def(&cols.Location, "location")
+	def(&cols.UID, "uid")
+
+	name := t.Name
+	if name == "" && resp.Request.URL != nil {
+		name = resp.Request.URL.Path
+	}
+	w := &writer{w: bufio.NewWriter(wr)}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//sql2http//sql2http "+resp.Version+"//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if name != "" {
+		w.line("X-WR-CALNAME", Escape(name))
+	}
+	stamp := resp.Time.UTC().Format(utcLayout)
+	if tbl != nil {
+		dateOnly := func(col string) bool {
+			for i, h := range tbl.Header {
+				if h == col && i < len(tbl.Types) {
+					return strings.ToUpper(tbl.Types[i]) == "DATE"
+				}
+			}
+			return false
+		}
+		zoned := func(col string) bool {
+			for i, h := range tbl.Header {
+				if h == col && i < len(tbl.Types) {
+					typ := strings.ToUpper(tbl.Types[i])
+					return strings.Contains(typ, "TZ") || strings.Contains(typ, "ZONE") || strings.Contains(typ, "OFFSET")
+				}
+			}
+			return false
+		}
+		for i, row := range tbl.Rows {
+			start := row.Get(cols.Start)
+			if start == nil {
+				return fmt.Errorf("template/ics: row %d: no %s value", i+1, cols.Start)
+			}
+			tm, isDate, err := t.date(start, dateOnly(cols.Start), zoned(cols.Start))
+			if err != nil {
+				return fmt.Errorf("template/ics: row %d: %s: %v", i+1, cols.Start, err)
+			}
+			dtstart := format(tm, isDate)
+			uid := text(row.Get(cols.UID))
+			if uid == "" && len(t.Key) == 0 {
+				return fmt.Errorf("template/ics: row %d: no %s value nor key columns", i+1, cols.UID)
+			}
+			if uid == "" {
+				// derive a stable identifier from the row key
+				h := sha1.New()
+				fmt.Fprintf(h, "%q", tbl.Name)
+				for _, k := range t.Key {
+					v := row.Get(k)
+					if v == nil {
+						return fmt.Errorf("template/ics: row %d: no %s value", i+1, k)
+					}
+					fmt.Fprintf(h, " %q=%q", k, text(v))
+				}
+				uid = hex.EncodeToString(h.Sum(nil))
+				if resp.Request.Host != "" {
+					uid += "@" + resp.Request.Host
+				}
+			}
+			w.line("BEGIN", "VEVENT")
+			w.line("UID", Escape(uid))
+			w.line("DTSTAMP", stamp)
+			w.line("DTSTART"+dtstart.param, dtstart.value)
+			if end := row.Get(cols.End); end != nil {
+				tm, _, err := t.date(end, dateOnly(cols.End), zoned(cols.End))
+				if err != nil {
+					return fmt.Errorf("template/ics: row %d: %s: %v", i+1, cols.End, err)
+				}
+				dtend := format(tm, isDate)
+				w.line("DTEND"+dtend.param, dtend.value)
+			}
+			if s := text(row.Get(cols.Summary)); s != "" {
+				w.line("SUMMARY", Escape(s))
+			}
+			if s := text(row.Get(cols.Description)); s != "" {
+				w.line("DESCRIPTION", Escape(s))
+			}
+			if s := text(row.Get(cols.Location)); s != "" {
+				w.line("LOCATION", Escape(s))
+			}
+			w.line("END", "VEVENT")
+		}
+	}
+	w.line("END", "VCALENDAR")
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+const (
+	utcLayout  = "20060102T150405Z"
+	dateLayout = "20060102"
+)
+
+// dateValue is a DATE or DATE-TIME property value, with its parameter.
+type dateValue struct {
+	param string // ";VALUE=DATE" for dates; empty for date-times
+	value string
+}
+
+func (d dateValue) String() string { return d.param + ":" + d.value }
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+}
+
+// date returns the time of v, and whether it is a DATE: if dateOnly is
+// set, or if v is a string without time, which is then taken at
+// midnight in t.Location. If zoned is not set, time.Time values in UTC
+// are taken as wall clock times in t.Location.
+func (t *Template) date(v interface{}, dateOnly, zoned bool) (time.Time, bool, error) {
+	loc := t.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var tm time.Time
+	switch v := v.(type) {
+	case time.Time:
+		tm = v
+		if !zoned && tm.Location() == time.UTC && loc != time.UTC {
+			tm = time.Date(tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), loc)
+		}
+	case string:
+		if d, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+			return d, true, nil
+		}
+		var err error
+		for _, layout := range timeLayouts {
+			if tm, err = time.ParseInLocation(layout, v, loc); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q", v)
+		}
+	default:
+		return time.Time{}, false, fmt.Errorf("invalid date %v", v)
+	}
+	return tm, dateOnly, nil
+}
+
+// format returns the DATE value of tm if isDate is set, else its
+// DATE-TIME value in UTC.
+func format(tm time.Time, isDate bool) dateValue {
+	if isDate {
+		return dateValue{";VALUE=DATE", tm.Format(dateLayout)}
+	}
+	return dateValue{"", tm.UTC().Format(utcLayout)}
+}
+
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// Escape escapes s as an iCalendar TEXT value.
+func Escape(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return textEscaper.Replace(s)
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// writer writes content lines, keeping the first write error.
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line writes the content line "name:value", folded as required.
+func (w *writer) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.WriteString(Fold(name + ":" + value))
+}
+
+// maxLine is the maximum length of a content line, in octets, excluding
+// the line break.
+const maxLine = 75
+
+// Fold returns the content line s, terminated by CRLF, and folded so
+// that no line is longer than 75 octets. UTF-8 sequences are never
+// split.
+func Fold(s string) string {
+	var b strings.Builder
+	limit := maxLine
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+		limit = maxLine - 1 // the leading space counts
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestFold(t *testing.T) {
+	in := "DESCRIPTION:" + strings.Repeat("é", 100)
+	out := Fold(in)
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Fatalf("missing CRLF terminator: %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	for i, l := range lines {
+		if len(l) > maxLine {
+			t.Errorf("line %d is %d octets long", i, len(l))
+		}
+		if i > 0 && l[0] != ' ' {
+			t.Errorf("line %d does not start with a space", i)
+		}
+	}
+	unfolded := strings.Replace(strings.TrimSuffix(out, "\r\n"), "\r\n ", "", -1)
+	if unfolded != in {
+		t.Errorf("unfolded %q; want %q", unfolded, in)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := Escape("a;b,c\\d\r\ne")
+	want := `a\;b\,c\\d\ne`
+	if got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"summary", "dtstart", "dtend"}
+	row := func(v ...interface{}) sql2http.Row { return sql2http.Row{Header: header, Values: v} }
+	resp := &sql2http.Result{
+		Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Tables: sql2http.Tables{{
+			Header: header,
+			Rows: []sql2http.Row{
+				// all-day events
+				row("holiday", "2020-03-01", "2020-03-03"),
+				row("trip", "2020-04-01", "2020-04-03 18:00"),
+				// timed events, in UTC+01:00
+				row("meeting", "2020-03-01 10:00", "2020-03-01 11:30"),
+				row("conference", "2020-05-01 09:00", "2020-05-03"),
+				row("call", time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC), nil),
+			},
+		}},
+	}
+	tmpl := &Template{Location: time.FixedZone("CET", 3600), Key: []string{"dtstart"}}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, resp); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range strings.Split(buf.String(), "\r\n") {
+		if strings.HasPrefix(l, "SUMMARY") || strings.HasPrefix(l, "DTSTART") || strings.HasPrefix(l, "DTEND") {
+			got = append(got, l)
+		}
+	}
+	want := []string{
+		"DTSTART;VALUE=DATE:20200301", "DTEND;VALUE=DATE:20200303", "SUMMARY:holiday",
+		"DTSTART;VALUE=DATE:20200401", "DTEND;VALUE=DATE:20200403", "SUMMARY:trip",
+		"DTSTART:20200301T090000Z", "DTEND:20200301T103000Z", "SUMMARY:meeting",
+		"DTSTART:20200501T080000Z", "DTEND:20200502T230000Z", "SUMMARY:conference",
+		"DTSTART:20200601T070000Z", "SUMMARY:call",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestExecuteDateColumn(t *testing.T) {
+	header := []string{"dtstart", "dtend"}
+	resp := &sql2http.Result{
+		Tables: sql2http.Tables{{
+			Header: header,
+			Types:  []string{"DATE", "TIMESTAMP"},
+			Rows: []sql2http.Row{{Header: header, Values: []interface{}{
+				time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC),
+			}}},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := (&Template{Key: []string{"dtstart"}}).Execute(&buf, resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\r\nDTSTART;VALUE=DATE:20200301\r\n", "\r\nDTEND;VALUE=DATE:20200302\r\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestUID(t *testing.T) {
+	header := []string{"id", "uid", "summary", "dtstart"}
+	resp := func(values ...interface{}) *sql2http.Result {
+		return &sql2http.Result{Tables: sql2http.Tables{{
+			Name:   "events",
+			Header: header,
+			Rows:   []sql2http.Row{{Header: header, Values: values}},
+		}}}
+	}
+	uid := func(tmpl *Template, resp *sql2http.Result) string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range strings.Split(buf.String(), "\r\n") {
+			if strings.HasPrefix(l, "UID:") {
+				return l[len("UID:"):]
+			}
+		}
+		t.Fatalf("no UID in:\n%s", buf.String())
+		return ""
+	}
+
+	tmpl := &Template{Key: []string{"id"}}
+	if got := uid(tmpl, resp(int64(1), "event-1@example.com", "Meeting", "2020-03-01")); got != "event-1@example.com" {
+		t.Errorf("UID %q; want the uid column", got)
+	}
+	a := uid(tmpl, resp(int64(1), nil, "Meeting", "2020-03-01"))
+	if b := uid(tmpl, resp(int64(1), nil, "Renamed", "2020-03-02")); a != b {
+		t.Errorf("UID changed with the event: %q, %q", a, b)
+	}
+	if b := uid(tmpl, resp(int64(2), nil, "Meeting", "2020-03-01")); a == b {
+		t.Errorf("same UID %q for different keys", a)
+	}
+
+	for _, tmpl := range []*Template{{}, {Key: []string{"uid"}}} {
+		if err := tmpl.Execute(&bytes.Buffer{}, resp(int64(1), nil, "Meeting", "2020-03-01")); err == nil {
+			t.Errorf("key %q: no error without uid", tmpl.Key)
+		}
+	}
+}
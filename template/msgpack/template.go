@@ -0,0 +1,182 @@
+// Package msgpack implements a MessagePack template, encoding the result
+// like template/json, with native types.
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/encode"
+)
+
+const (
+	Ext         = ".msgpack"
+	ContentType = "application/msgpack"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Template implements interface sql2http.Template by writing the full
+// Result in MessagePack, with the shape of the output of template/json
+// (see package internal/encode): integers, floats, strings, bin for the
+// binary values (e.g. BLOB columns), and the timestamp extension type
+// (-1) for date/times.
+type Template struct{}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/msgpack: only *sql2http.Result can be passed as data")
+	}
+	e := &encoder{bufio.NewWriter(wr)}
+	if err := encode.Value(e, resp); err != nil {
+		return fmt.Errorf("template/msgpack: %v", err)
+	}
+	return e.w.Flush()
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+// encoder implements interface encode.Encoder. The write errors are
+// kept by w, and returned by its Flush method.
+type encoder struct {
+	w *bufio.Writer
+}
+
+// size writes the header of a value of length n: the fix format
+// fix|n if n < fixMax, else the 8-bit (if code8 is not zero), 16-bit
+// or 32-bit format.
+func (e *encoder) size(n int, fix byte, fixMax int, code8, code16, code32 byte) {
+	var b [5]byte
+	switch {
+	case n < fixMax:
+		e.w.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		b[0], b[1] = code8, byte(n)
+		e.w.Write(b[:2])
+	case n <= math.MaxUint16:
+		b[0] = code16
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		e.w.Write(b[:3])
+	default:
+		b[0] = code32
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		e.w.Write(b[:5])
+	}
+}
+
+func (e *encoder) Nil() { e.w.WriteByte(0xc0) }
+
+func (e *encoder) Bool(b bool) {
+	if b {
+		e.w.WriteByte(0xc3)
+	} else {
+		e.w.WriteByte(0xc2)
+	}
+}
+
+func (e *encoder) Int(i int64) {
+	var b [9]byte
+	switch {
+	case i >= 0:
+		e.Uint(uint64(i))
+	case i >= -32:
+		e.w.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		b[0], b[1] = 0xd0, byte(i)
+		e.w.Write(b[:2])
+	case i >= math.MinInt16:
+		b[0] = 0xd1
+		binary.BigEndian.PutUint16(b[1:], uint16(i))
+		e.w.Write(b[:3])
+	case i >= math.MinInt32:
+		b[0] = 0xd2
+		binary.BigEndian.PutUint32(b[1:], uint32(i))
+		e.w.Write(b[:5])
+	default:
+		b[0] = 0xd3
+		binary.BigEndian.PutUint64(b[1:], uint64(i))
+		e.w.Write(b[:9])
+	}
+}
+
+func (e *encoder) Uint(u uint64) {
+	var b [9]byte
+	switch {
+	case u < 128:
+		e.w.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		b[0], b[1] = 0xcc, byte(u)
+		e.w.Write(b[:2])
+	case u <= math.MaxUint16:
+		b[0] = 0xcd
+		binary.BigEndian.PutUint16(b[1:], uint16(u))
+		e.w.Write(b[:3])
+	case u <= math.MaxUint32:
+		b[0] = 0xce
+		binary.BigEndian.PutUint32(b[1:], uint32(u))
+		e.w.Write(b[:5])
+	default:
+		b[0] = 0xcf
+		binary.BigEndian.PutUint64(b[1:], u)
+		e.w.Write(b[:9])
+	}
+}
+
+// Float writes f in single precision if it is exact, else in double
+// precision.
+func (e *encoder) Float(f float64) {
+	var b [9]byte
+	if f32 := float32(f); float64(f32) == f {
+		b[0] = 0xca
+		binary.BigEndian.PutUint32(b[1:], math.Float32bits(f32))
+		e.w.Write(b[:5])
+		return
+	}
+	b[0] = 0xcb
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+	e.w.Write(b[:])
+}
+
+func (e *encoder) String(s string) {
+	e.size(len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	e.w.WriteString(s)
+}
+
+func (e *encoder) Bytes(b []byte) {
+	e.size(len(b), 0, 0, 0xc4, 0xc5, 0xc6)
+	e.w.Write(b)
+}
+
+// Time writes t with the timestamp extension type, in its 32, 64 or 96
+// bits format.
+func (e *encoder) Time(t time.Time) {
+	var b [15]byte
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case nsec == 0 && sec >= 0 && sec <= math.MaxUint32:
+		b[0], b[1] = 0xd6, 0xff
+		binary.BigEndian.PutUint32(b[2:], uint32(sec))
+		e.w.Write(b[:6])
+	case sec >= 0 && sec>>34 == 0:
+		b[0], b[1] = 0xd7, 0xff
+		binary.BigEndian.PutUint64(b[2:], nsec<<34|uint64(sec))
+		e.w.Write(b[:10])
+	default:
+		b[0], b[1], b[2] = 0xc7, 12, 0xff
+		binary.BigEndian.PutUint32(b[3:], uint32(nsec))
+		binary.BigEndian.PutUint64(b[7:], uint64(sec))
+		e.w.Write(b[:15])
+	}
+}
+
+func (e *encoder) Array(n int) { e.size(n, 0x90, 16, 0, 0xdc, 0xdd) }
+
+func (e *encoder) Map(n int) { e.size(n, 0x80, 16, 0, 0xde, 0xdf) }
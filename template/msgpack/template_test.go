@@ -0,0 +1,50 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		write func(e *encoder)
+		want  string
+	}{
+		{func(e *encoder) { e.Int(0) }, "00"},
+		{func(e *encoder) { e.Int(127) }, "7f"},
+		{func(e *encoder) { e.Int(128) }, "cc80"},
+		{func(e *encoder) { e.Int(65536) }, "ce00010000"},
+		{func(e *encoder) { e.Uint(1 << 32) }, "cf0000000100000000"},
+		{func(e *encoder) { e.Int(-1) }, "ff"},
+		{func(e *encoder) { e.Int(-32) }, "e0"},
+		{func(e *encoder) { e.Int(-33) }, "d0df"},
+		{func(e *encoder) { e.Int(-129) }, "d1ff7f"},
+		{func(e *encoder) { e.Int(-1 << 40) }, "d3ffffff0000000000"},
+		{func(e *encoder) { e.Float(0.5) }, "ca3f000000"},
+		{func(e *encoder) { e.Float(1.1) }, "cb3ff199999999999a"},
+		{func(e *encoder) { e.Bool(false) }, "c2"},
+		{func(e *encoder) { e.Nil() }, "c0"},
+		{func(e *encoder) { e.String("ab") }, "a26162"},
+		{func(e *encoder) { e.String(strings.Repeat("a", 32)) }, "d920" + strings.Repeat("61", 32)},
+		{func(e *encoder) { e.Bytes([]byte{1, 2}) }, "c4020102"},
+		{func(e *encoder) { e.Array(2); e.Nil(); e.Bool(true) }, "92c0c3"},
+		{func(e *encoder) { e.Array(16) }, "dc0010"},
+		{func(e *encoder) { e.Map(1); e.String("a"); e.Int(1) }, "81a16101"},
+		{func(e *encoder) { e.Time(time.Unix(1, 0)) }, "d6ff00000001"},
+		{func(e *encoder) { e.Time(time.Unix(1, 1)) }, "d7ff0000000400000001"},
+		{func(e *encoder) { e.Time(time.Unix(-1, 0)) }, "c70cff00000000ffffffffffffffff"},
+	}
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		e := &encoder{bufio.NewWriter(buf)}
+		test.write(e)
+		e.w.Flush()
+		if got := hex.EncodeToString(buf.Bytes()); got != test.want {
+			t.Errorf("got %s; want %s", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ods
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".ods"
+	ContentType = "application/vnd.oasis.opendocument.spreadsheet"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Template implements interface sql2http.Template by writing an
+// OpenDocument spreadsheet, with one sheet per SQL query result set.
+//
+// Numeric, boolean and time.Time values are written with their
+// respective OpenDocument value types; all other values are written as
+// strings. NULL values are written as empty cells.
+type Template struct{}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/ods: only *sql2http.Result can be passed as data")
+	}
+	z := zip.NewWriter(wr)
+	// The mimetype file must be the first entry, and stored uncompressed.
+	f, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, ContentType); err != nil {
+		return err
+	}
+	f, err = z.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, manifest); err != nil {
+		return err
+	}
+	f, err = z.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeContent(f, resp.Tables); err != nil {
+		return fmt.Errorf("template/ods: %v", err)
+	}
+	return z.Close()
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+const manifest = xml.Header + `<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="` + ContentType + `"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+const contentHead = xml.Header + `<office:document-content` +
+	` xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+	` xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"` +
+	` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"` +
+	` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+	` xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0"` +
+	` xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0"` +
+	` office:version="1.2">` +
+	`<office:automatic-styles>` +
+	`<number:date-style style:name="N1">` +
+	`<number:year number:style="long"/><number:text>-</number:text>` +
+	`<number:month number:style="long"/><number:text>-</number:text>` +
+	`<number:day number:style="long"/><number:text> </number:text>` +
+	`<number:hours number:style="long"/><number:text>:</number:text>` +
+	`<number:minutes number:style="long"/><number:text>:</number:text>` +
+	`<number:seconds number:style="long"/>` +
+	`</number:date-style>` +
+	`<style:style style:name="header" style:family="table-cell"><style:text-properties fo:font-weight="bold"/></style:style>` +
+	`<style:style style:name="datetime" style:family="table-cell" style:data-style-name="N1"/>` +
+	`</office:automatic-styles>` +
+	`<office:body><office:spreadsheet>`
+
+const contentTail = `</office:spreadsheet></office:body></office:document-content>`
+
+func writeContent(w io.Writer, tables sql2http.Tables) error {
+	if len(tables) == 0 {
+		// a spreadsheet needs at least one table to be valid
+		tables = sql2http.Tables{{}}
+	}
+	cw := &contentWriter{w: w}
+	cw.str(contentHead)
+	for i, name := range tables.SheetNames() {
+		tbl := tables[i]
+		cw.str(`<table:table table:name="`)
+		cw.escape(name)
+		cw.str(`">`)
+		if n := len(tbl.Header); n > 0 {
+			cw.str(`<table:table-column table:number-columns-repeated="` + strconv.Itoa(n) + `"/>`)
+		}
+		cw.str(`<table:table-header-rows><table:table-row>`)
+		for _, h := range tbl.Header {
+			cw.str(`<table:table-cell table:style-name="header" office:value-type="string"><text:p>`)
+			cw.escape(h)
+			cw.str(`</text:p></table:table-cell>`)
+		}
+		if len(tbl.Header) == 0 {
+			cw.str(`<table:table-cell/>`)
+		}
+		cw.str(`</table:table-row></table:table-header-rows>`)
+		for _, row := range tbl.Rows {
+			cw.str(`<table:table-row>`)
+			for _, v := range row.Values {
+				cw.cell(v)
+			}
+			cw.str(`</table:table-row>`)
+		}
+		cw.str(`</table:table>`)
+	}
+	cw.str(contentTail)
+	return cw.err
+}
+
+// contentWriter writes the content.xml document, keeping the first
+// write error.
+type contentWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *contentWriter) str(s string) {
+	if cw.err != nil {
+		return
+	}
+	_, cw.err = io.WriteString(cw.w, s)
+}
+
+func (cw *contentWriter) escape(s string) {
+	if cw.err != nil {
+		return
+	}
+	cw.err = xml.EscapeText(cw.w, []byte(s))
+}
+
+func (cw *contentWriter) typed(typ, attr, val string) {
+	cw.str(`<table:table-cell office:value-type="` + typ + `" ` + attr + `="` + val + `"/>`)
+}
+
+func (cw *contentWriter) cell(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		cw.str(`<table:table-cell/>`)
+	case int64:
+		cw.typed("float", "office:value", strconv.FormatInt(v, 10))
+	case int:
+		cw.typed("float", "office:value", strconv.Itoa(v))
+	case int32:
+		cw.typed("float", "office:value", strconv.FormatInt(int64(v), 10))
+	case uint64:
+		cw.typed("float", "office:value", strconv.FormatUint(v, 10))
+	case float64:
+		cw.float(v, 64)
+	case float32:
+		cw.float(float64(v), 32)
+	case bool:
+		cw.typed("boolean", "office:boolean-value", strconv.FormatBool(v))
+	case time.Time:
+		cw.str(`<table:table-cell table:style-name="datetime" office:value-type="date" office:date-value="` +
+			v.Format("2006-01-02T15:04:05") + `"/>`)
+	case string:
+		cw.string(v)
+	case []byte:
+		cw.string(string(v))
+	default:
+		cw.string(fmt.Sprint(v))
+	}
+}
+
+func (cw *contentWriter) float(f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		cw.string(strconv.FormatFloat(f, 'g', -1, bits))
+		return
+	}
+	cw.typed("float", "office:value", strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+func (cw *contentWriter) string(s string) {
+	cw.str(`<table:table-cell office:value-type="string"><text:p>`)
+	cw.escape(s)
+	cw.str(`</text:p></table:table-cell>`)
+}
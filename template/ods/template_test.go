@@ -0,0 +1,116 @@
+package ods
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+type content struct {
+	Tables []struct {
+		Name   string `xml:"urn:oasis:names:tc:opendocument:xmlns:table:1.0 name,attr"`
+		Header row    `xml:"table-header-rows>table-row"`
+		Rows   []row  `xml:"urn:oasis:names:tc:opendocument:xmlns:table:1.0 table-row"`
+	} `xml:"body>spreadsheet>table"`
+}
+
+type row struct {
+	Cells []struct {
+		Type    string `xml:"urn:oasis:names:tc:opendocument:xmlns:office:1.0 value-type,attr"`
+		Value   string `xml:"urn:oasis:names:tc:opendocument:xmlns:office:1.0 value,attr"`
+		Bool    string `xml:"urn:oasis:names:tc:opendocument:xmlns:office:1.0 boolean-value,attr"`
+		Date    string `xml:"urn:oasis:names:tc:opendocument:xmlns:office:1.0 date-value,attr"`
+		Content string `xml:"urn:oasis:names:tc:opendocument:xmlns:text:1.0 p"`
+	} `xml:"urn:oasis:names:tc:opendocument:xmlns:table:1.0 table-cell"`
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"id", "name", "price", "ok", "at", "note"}
+	tables := sql2http.Tables{
+		{
+			Name:   "sales/2020",
+			Header: header,
+			Rows: []sql2http.Row{{Header: header, Values: []interface{}{
+				int64(1), `<a & "b">`, 2.5, true, time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC), nil,
+			}}},
+		},
+		{Name: "Sales/2020", Header: []string{"x"}},
+		{Name: ""},
+	}
+	var buf bytes.Buffer
+	if err := (&Template{}).Execute(&buf, &sql2http.Result{Tables: tables}); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := z.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Errorf("first entry %q (method %d); want stored mimetype", f.Name, f.Method)
+	}
+	var doc content
+	for _, f := range z.File {
+		if f.Name != "content.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte(`<text:p>&lt;a &amp; &#34;b&#34;&gt;</text:p>`)) {
+			t.Errorf("content.xml: unescaped string cell:\n%s", b)
+		}
+		if err := xml.Unmarshal(b, &doc); err != nil {
+			t.Fatalf("content.xml: %v\n%s", err, b)
+		}
+	}
+
+	names := tables.SheetNames()
+	if len(doc.Tables) != len(names) {
+		t.Fatalf("%d tables; want %d", len(doc.Tables), len(names))
+	}
+	for i, name := range names {
+		if doc.Tables[i].Name != name {
+			t.Errorf("table %d named %q; want %q", i, doc.Tables[i].Name, name)
+		}
+	}
+
+	for i, h := range header {
+		if c := doc.Tables[0].Header.Cells[i]; c.Type != "string" || c.Content != h {
+			t.Errorf("header %d: %+v", i, c)
+		}
+	}
+	rows := doc.Tables[0].Rows
+	if len(rows) != 1 {
+		t.Fatalf("%d rows; want 1", len(rows))
+	}
+	cells := rows[0].Cells
+	if len(cells) != len(header) {
+		t.Fatalf("%d cells; want %d", len(cells), len(header))
+	}
+	checks := []struct {
+		typ, got, want string
+	}{
+		{"float", cells[0].Value, "1"},
+		{"string", cells[1].Content, `<a & "b">`},
+		{"float", cells[2].Value, "2.5"},
+		{"boolean", cells[3].Bool, "true"},
+		{"date", cells[4].Date, "2020-03-01T12:30:00"},
+		{"", cells[5].Content, ""},
+	}
+	for i, c := range checks {
+		if cells[i].Type != c.typ || c.got != c.want {
+			t.Errorf("cell %d: type %q value %q; want %q %q", i, cells[i].Type, c.got, c.typ, c.want)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Package office implements sql2http.Template with word processing
+// documents (e.g. letters or delivery notes made with Word or
+// LibreOffice Writer) whose placeholders are filled from the
+// sql2http.Result:
+//
+//     ${:name}         the request parameter name
+//     ${query.column}  the column of the first row of the table of query
+//
+// A table row of the document holding placeholders of a query is
+// repeated for each row of its table, its placeholders being filled
+// from that row. For example a delivery note can have a table with a
+// header row, and a row holding ${items.name} and ${items.quantity}:
+// the latter is written once per row of the query "items" (and removed
+// if it has no rows).
+//
+// Placeholders of unknown queries or columns are left as is. NULL
+// values are written as empty strings, times as "2006-01-02 15:04:05"
+// (or "2006-01-02" at midnight), and line breaks of the values are kept.
+//
+// The placeholders can span several formatting runs (e.g. after a
+// spelling correction), in which case the value takes the format of
+// the start of the placeholder.
+//
+// Office Open XML (.docx) and OpenDocument (.odt) documents are
+// supported. Their body, headers and footers are filled.
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
+)
+
+// File extensions of the supported documents.
+const (
+	DOCX = ".docx"
+	ODT  = ".odt"
+)
+
+// format describes the XML of a document format.
+type format struct {
+	contentType string
+	parts       *regexp.Regexp // the parts holding text to fill
+	paragraphs  []string       // the paragraph elements
+	text        string         // the element holding the text, or "" for any
+	row         string         // the table row element
+	lineBreak   func(leaf *node, lines []string)
+}
+
+var formats = map[string]*format{
+	DOCX: {
+		contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		parts:       regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`),
+		paragraphs:  []string{"w:p"},
+		text:        "w:t",
+		row:         "w:tr",
+		lineBreak: func(leaf *node, lines []string) {
+			// <w:t>a</w:t><w:br/><w:t>b</w:t> in the run
+			t := leaf.parent
+			var with []*node
+			for i, l := range lines {
+				if i > 0 {
+					with = append(with, element("w:br"))
+				}
+				c := t.clone(nil)
+				c.children[0].setText(l)
+				with = append(with, c)
+			}
+			t.parent.replace(t, with...)
+		},
+	},
+	ODT: {
+		contentType: "application/vnd.oasis.opendocument.text",
+		parts:       regexp.MustCompile(`^(content|styles)\.xml$`),
+		paragraphs:  []string{"text:p", "text:h"},
+		row:         "table:table-row",
+		lineBreak: func(leaf *node, lines []string) {
+			var with []*node
+			for i, l := range lines {
+				if i > 0 {
+					with = append(with, element("text:line-break"))
+				}
+				with = append(with, &node{tok: leaf.tok})
+				with[len(with)-1].setText(l)
+			}
+			leaf.parent.replace(leaf, with...)
+		},
+	},
+}
+
+// Document implements interface sql2http.Template by filling the
+// placeholders of a document file.
+type Document struct {
+	format *format
+	parts  []part // the zip archive entries, in order
+
+	pages tree.Files // the pages of a tree, see ParseTree
+}
+
+type part struct {
+	header zip.FileHeader
+	data   []byte
+	root   *node // the parsed XML of the parts to fill
+}
+
+// ParseTree walks recursively the files starting at the given directory,
+// and reads each file ending with the given extension (DOCX or ODT) as
+// a Document named by its relative path without extension (see package
+// git.sr.ht/~detaoin/sql2http/internal/tree).
+// The returned document is the first file; the others are returned by
+// its Lookup method.
+func ParseTree(dir, ext string) (*Document, error) {
+	pages, first, err := tree.ParseFiles(dir, ext, func(path string) (interface{}, error) {
+		return ParseFile(path)
+	})
+	if err != nil || first == "" {
+		return nil, err
+	}
+	t := pages[first].(*Document)
+	t.pages = pages
+	return t, nil
+}
+
+// Lookup returns the document of the tree of doc with the given name, or
+// nil.
+func (doc *Document) Lookup(name string) *Document {
+	if doc == nil {
+		return nil
+	}
+	t, _ := doc.pages[name].(*Document)
+	return t
+}
+
+// ParseFile reads the document file at path, whose format is given by
+// its extension.
+func ParseFile(path string) (*Document, error) {
+	ext := strings.ToLower(path[strings.LastIndexByte(path, '.')+1:])
+	f, ok := formats["."+ext]
+	if !ok {
+		return nil, fmt.Errorf("template/office: %s: unknown document format", path)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(f, b)
+	if err != nil {
+		return nil, fmt.Errorf("template/office: %s: %v", path, err)
+	}
+	return doc, nil
+}
+
+func parseDocument(f *format, b []byte) (*Document, error) {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{format: f}
+	for _, zf := range z.File {
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		p := part{header: zf.FileHeader, data: data}
+		if f.parts.MatchString(zf.Name) {
+			if p.root, err = parseXML(data); err != nil {
+				return nil, fmt.Errorf("%s: %v", zf.Name, err)
+			}
+		}
+		doc.parts = append(doc.parts, p)
+	}
+	return doc, nil
+}
+
+// Execute implements interface sql2http.Template.
+func (doc *Document) Execute(w io.Writer, data interface{}) error {
+	res, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/office: only *sql2http.Results can be passed as data")
+	}
+	z := zip.NewWriter(w)
+	for _, p := range doc.parts {
+		b := p.data
+		if p.root != nil {
+			root := p.root.clone(nil)
+			f := &filler{format: doc.format, res: res}
+			f.fill(root, nil)
+			var buf bytes.Buffer
+			root.write(&buf)
+			b = buf.Bytes()
+		}
+		fw, err := z.CreateHeader(&zip.FileHeader{
+			Name:     p.header.Name,
+			Method:   p.header.Method,
+			Modified: p.header.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(b); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// ContentType implements interface sql2http.Template.
+func (doc *Document) ContentType() string {
+	return doc.format.contentType
+}
+
+// placeholderRE matches the placeholders, e.g. ${query.column}.
+var placeholderRE = regexp.MustCompile(`\$\{\s*([^{}]*?)\s*\}`)
+
+// filler fills the placeholders of a document.
+type filler struct {
+	format *format
+	res    *sql2http.Result
+}
+
+// rows gives the current row of the repeated tables, by query name.
+type rows map[string]int
+
+// fill fills the paragraphs under n, repeating the table rows.
+func (f *filler) fill(n *node, cur rows) {
+	for i := 0; i < len(n.children); i++ {
+		c := n.children[i]
+		name := c.name()
+		if name == f.format.row {
+			if tbl := f.repeated(c, cur); tbl != nil {
+				clones := make([]*node, len(tbl.Rows))
+				for j := range tbl.Rows {
+					clones[j] = c.clone(n)
+					r := rows{tbl.Name: j}
+					for k, v := range cur {
+						r[k] = v
+					}
+					f.fill(clones[j], r)
+				}
+				n.replace(c, clones...)
+				i += len(clones) - 1
+				continue
+			}
+		}
+		if f.isParagraph(name) {
+			f.paragraph(c, cur)
+		}
+		f.fill(c, cur)
+	}
+}
+
+func (f *filler) isParagraph(name string) bool {
+	for _, p := range f.format.paragraphs {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// repeated returns the table the row element n is repeated for: the
+// one of its first placeholder of a query not already repeated, or nil.
+func (f *filler) repeated(n *node, cur rows) *sql2http.Table {
+	var text strings.Builder
+	var walk func(*node)
+	walk = func(n *node) {
+		if s, ok := n.text(); ok && f.isText(n) {
+			text.WriteString(s)
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(n)
+	for _, m := range placeholderRE.FindAllStringSubmatch(text.String(), -1) {
+		i := strings.IndexByte(m[1], '.')
+		if i <= 0 {
+			continue
+		}
+		if _, ok := cur[m[1][:i]]; ok {
+			continue
+		}
+		for j := range f.res.Tables {
+			if f.res.Tables[j].Name == m[1][:i] {
+				return &f.res.Tables[j]
+			}
+		}
+	}
+	return nil
+}
+
+// isText reports whether the character data n is text of the document.
+func (f *filler) isText(n *node) bool {
+	return f.format.text == "" || n.parent != nil && n.parent.name() == f.format.text
+}
+
+// paragraph fills the placeholders of the paragraph p, which may span
+// several text nodes. The nested paragraphs (e.g. of notes) are left to
+// fill.
+func (f *filler) paragraph(p *node, cur rows) {
+	var leaves []*node
+	var walk func(*node)
+	walk = func(n *node) {
+		for _, c := range n.children {
+			if f.isParagraph(c.name()) {
+				continue
+			}
+			if _, ok := c.text(); ok && f.isText(c) {
+				leaves = append(leaves, c)
+			}
+			walk(c)
+		}
+	}
+	walk(p)
+	var text strings.Builder
+	starts := make([]int, len(leaves)) // offset of each leaf in text
+	for i, l := range leaves {
+		starts[i] = text.Len()
+		s, _ := l.text()
+		text.WriteString(s)
+	}
+	matches := placeholderRE.FindAllStringSubmatchIndex(text.String(), -1)
+	broken := make(map[*node]bool)
+	// from the last one, so that the offsets of the previous ones hold
+	for k := len(matches) - 1; k >= 0; k-- {
+		m := matches[k]
+		value, ok := f.value(text.String()[m[2]:m[3]], cur)
+		if !ok {
+			continue
+		}
+		first, last := leafAt(starts, m[0]), leafAt(starts, m[1]-1)
+		for i := first; i <= last; i++ {
+			s, _ := leaves[i].text()
+			from, to := 0, len(s)
+			if i == first {
+				from = m[0] - starts[i]
+			}
+			if i == last {
+				to = m[1] - starts[i]
+			}
+			v := ""
+			if i == first {
+				v = value
+			}
+			leaves[i].setText(s[:from] + v + s[to:])
+			if f.format.text != "" {
+				leaves[i].parent.setAttr("xml", "space", "preserve")
+			}
+		}
+		if strings.Contains(value, "\n") {
+			broken[leaves[first]] = true
+		}
+	}
+	for _, l := range leaves {
+		if broken[l] {
+			s, _ := l.text()
+			f.format.lineBreak(l, strings.Split(s, "\n"))
+		}
+	}
+}
+
+// leafAt returns the index of the leaf holding the text offset i.
+func leafAt(starts []int, i int) int {
+	j := len(starts) - 1
+	for j > 0 && starts[j] > i {
+		j--
+	}
+	return j
+}
+
+// value returns the value of the placeholder expression, and whether
+// it is known.
+func (f *filler) value(expr string, cur rows) (string, bool) {
+	if strings.HasPrefix(expr, ":") {
+		return text(f.res.Params[expr[1:]]), true
+	}
+	i := strings.IndexByte(expr, '.')
+	if i <= 0 {
+		return "", false
+	}
+	q, col := expr[:i], expr[i+1:]
+	for _, tbl := range f.res.Tables {
+		if tbl.Name != q {
+			continue
+		}
+		for _, h := range tbl.Header {
+			if h != col {
+				continue
+			}
+			r := cur[q]
+			if r >= len(tbl.Rows) {
+				return "", true
+			}
+			return text(tbl.Rows[r].Get(col)), true
+		}
+	}
+	return "", false
+}
+
+// text returns the text of the value v.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.Replace(v, "\r\n", "\n", -1)
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,205 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// zipParts returns the zip archive of the given parts, the first one
+// stored uncompressed.
+func zipParts(t *testing.T, parts [][2]string) []byte {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for i, p := range parts {
+		method := zip.Deflate
+		if i == 0 {
+			method = zip.Store
+		}
+		f, err := z.CreateHeader(&zip.FileHeader{Name: p[0], Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(p[1]))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// execute executes the document b of format f, and returns the
+// content of its parts.
+func execute(t *testing.T, f *format, b []byte) ([]*zip.File, map[string]string) {
+	doc, err := parseDocument(f, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []string{"name", "qty"}
+	customer := []string{"name", "address", "since"}
+	res := &sql2http.Result{
+		Params: map[string]interface{}{"id": "42"},
+		Tables: sql2http.Tables{
+			{Name: "customer", Header: customer, Rows: []sql2http.Row{
+				{Header: customer, Values: []interface{}{"Ann & Bob", "1 Road\nTown", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}},
+			}},
+			{Name: "items", Header: items, Rows: []sql2http.Row{
+				{Header: items, Values: []interface{}{"nut", int64(10)}},
+				{Header: items, Values: []interface{}{"bolt", nil}},
+			}},
+		},
+	}
+	buf := &bytes.Buffer{}
+	if err := doc.Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(b)
+	}
+	return z.File, parts
+}
+
+func TestDOCX(t *testing.T) {
+	b := zipParts(t, [][2]string{
+		{"[Content_Types].xml", `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:r><w:t>Order ${:id} for ${cust</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>omer.name}, ${unknown.x}</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>${customer.address}</w:t></w:r></w:p>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Item</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>${items.name}</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>${items.qty} (${customer.since})</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`</w:body></w:document>`},
+		{"word/footer1.xml", `<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:p><w:r><w:t xml:space="preserve">Page ${:id}</w:t></w:r></w:p></w:ftr>`},
+		{"word/styles.xml", `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:t>${:id}</w:t></w:styles>`},
+	})
+	files, parts := execute(t, formats[DOCX], b)
+	if files[0].Name != "[Content_Types].xml" || files[0].Method != zip.Store {
+		t.Errorf("first entry: %s, method %d", files[0].Name, files[0].Method)
+	}
+	for name, wants := range map[string][]string{
+		"word/document.xml": {
+			`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<w:document xmlns:w=`,
+			`<w:r><w:t xml:space="preserve">Order 42 for Ann &amp; Bob</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">, ${unknown.x}</w:t></w:r>`,
+			`<w:r><w:t xml:space="preserve">1 Road</w:t><w:br/><w:t xml:space="preserve">Town</w:t></w:r>`,
+			`<w:tr><w:tc><w:p><w:r><w:t>Item</w:t></w:r></w:p></w:tc></w:tr>`,
+			`<w:t xml:space="preserve">nut</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t xml:space="preserve">10 (2020-03-01)</w:t>`,
+			`<w:t xml:space="preserve">bolt</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t xml:space="preserve"> (2020-03-01)</w:t>`,
+		},
+		"word/footer1.xml": {`<w:t xml:space="preserve">Page 42</w:t>`},
+		"word/styles.xml":  {`<w:t>${:id}</w:t>`},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(parts[name], want) {
+				t.Errorf("%s does not contain %s:\n%s", name, want, parts[name])
+			}
+		}
+	}
+	if n := strings.Count(parts["word/document.xml"], "<w:tr>"); n != 3 {
+		t.Errorf("%d table rows; want 3", n)
+	}
+}
+
+func TestODT(t *testing.T) {
+	b := zipParts(t, [][2]string{
+		{"mimetype", "application/vnd.oasis.opendocument.text"},
+		{"content.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"><office:body><office:text>` +
+			`<text:p>Dear <text:span text:style-name="T1">${customer</text:span>.name},</text:p>` +
+			`<text:p>${customer.address}</text:p>` +
+			`<table:table><table:table-row><table:table-cell><text:p>${items.name}: ${items.qty}</text:p></table:table-cell></table:table-row></table:table>` +
+			`</office:text></office:body></office:document-content>`},
+	})
+	files, parts := execute(t, formats[ODT], b)
+	if files[0].Name != "mimetype" || files[0].Method != zip.Store {
+		t.Errorf("first entry: %s, method %d", files[0].Name, files[0].Method)
+	}
+	for _, want := range []string{
+		`<text:p>Dear <text:span text:style-name="T1">Ann &amp; Bob</text:span>,</text:p>`,
+		`<text:p>1 Road<text:line-break/>Town</text:p>`,
+		`<table:table-row><table:table-cell><text:p>nut: 10</text:p></table:table-cell></table:table-row><table:table-row><table:table-cell><text:p>bolt: </text:p></table:table-cell></table:table-row>`,
+	} {
+		if !strings.Contains(parts["content.xml"], want) {
+			t.Errorf("content.xml does not contain %s:\n%s", want, parts["content.xml"])
+		}
+	}
+}
+
+func TestWriteInvalidChars(t *testing.T) {
+	p := &node{
+		tok: xml.StartElement{
+			Name: xml.Name{Space: "w", Local: "p"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "a"}, Value: "x\x01y"}},
+		},
+		children: []*node{{tok: xml.CharData("a\x00b\x08c\x0bd\x0ce\x1ff\tg\nh\ri\ufffej€")}},
+	}
+	var buf bytes.Buffer
+	p.write(&buf)
+	want := "<w:p a=\"x�y\">a�b�c�d�e�f\tg\nh&#xD;i�j€</w:p>"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Errorf("invalid XML: %v", err)
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := zipParts(t, [][2]string{
+		{"[Content_Types].xml", `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`},
+		{"word/document.xml", `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body/></w:document>`},
+	})
+	files := map[string][]byte{
+		"letter.docx":        b,
+		"~$letter.docx":      []byte("lock file of an open document"),
+		"sub/_default.docx":  b,
+		"sub/letter.docx~":   []byte("backup"),
+		".git/x/letter.docx": []byte("not a document"),
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := ParseTree(dir, DOCX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/letter", "/sub/_default"} {
+		if doc.Lookup(name) == nil {
+			t.Errorf("no document %s", name)
+		}
+	}
+	if doc.Lookup("/other") != nil {
+		t.Error("document /other found")
+	}
+}
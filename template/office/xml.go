@@ -0,0 +1,185 @@
+package office
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// node is an XML node. The names keep their prefix as written (e.g.
+// "w:p" has Space "w"), so that the document is written back with its
+// namespace prefixes, which encoding/xml does not preserve.
+type node struct {
+	tok      xml.Token // xml.StartElement, or any other token; nil for the root
+	children []*node   // of elements
+	parent   *node
+}
+
+// parseXML returns the root of the XML document b.
+func parseXML(b []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	root := &node{}
+	cur := root
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			n := &node{tok: t.Copy(), parent: cur}
+			cur.children = append(cur.children, n)
+			cur = n
+		case xml.EndElement:
+			if cur == root || cur.name() != qname(t.Name) {
+				return nil, fmt.Errorf("unexpected end element %s", qname(t.Name))
+			}
+			cur = cur.parent
+		default:
+			cur.children = append(cur.children, &node{tok: xml.CopyToken(t), parent: cur})
+		}
+	}
+	if cur != root {
+		return nil, fmt.Errorf("unclosed element %s", cur.name())
+	}
+	return root, nil
+}
+
+func qname(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// name returns the qualified name of the element n, or "".
+func (n *node) name() string {
+	if t, ok := n.tok.(xml.StartElement); ok {
+		return qname(t.Name)
+	}
+	return ""
+}
+
+// text returns the character data of n, if it is character data.
+func (n *node) text() (string, bool) {
+	t, ok := n.tok.(xml.CharData)
+	return string(t), ok
+}
+
+func (n *node) setText(s string) {
+	n.tok = xml.CharData(s)
+}
+
+// setAttr sets the attribute of the element n.
+func (n *node) setAttr(space, local, value string) {
+	t := n.tok.(xml.StartElement)
+	for i, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			t.Attr[i].Value = value
+			return
+		}
+	}
+	t.Attr = append(t.Attr, xml.Attr{Name: xml.Name{Space: space, Local: local}, Value: value})
+	n.tok = t
+}
+
+// clone returns a deep copy of n, with parent p.
+func (n *node) clone(p *node) *node {
+	c := &node{tok: xml.CopyToken(n.tok), parent: p}
+	for _, child := range n.children {
+		c.children = append(c.children, child.clone(c))
+	}
+	return c
+}
+
+// replace replaces the child old of n by the nodes with.
+func (n *node) replace(old *node, with ...*node) {
+	for i, c := range n.children {
+		if c != old {
+			continue
+		}
+		children := append([]*node{}, n.children[:i]...)
+		for _, w := range with {
+			w.parent = n
+			children = append(children, w)
+		}
+		n.children = append(children, n.children[i+1:]...)
+		return
+	}
+}
+
+// element returns a new element node of the given qualified name.
+func element(name string) *node {
+	var n xml.Name
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		n.Space, n.Local = name[:i], name[i+1:]
+	} else {
+		n.Local = name
+	}
+	return &node{tok: xml.StartElement{Name: n}}
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+		"\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+)
+
+// xmlChars returns s with the characters which are not allowed in XML
+// 1.0 documents (e.g. most control characters) replaced by U+FFFD, as
+// xml.EscapeText does.
+func xmlChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r',
+			r >= 0x20 && r <= 0xD7FF,
+			r >= 0xE000 && r <= 0xFFFD,
+			r >= 0x10000 && r <= 0x10FFFF:
+			return r
+		}
+		return '\uFFFD'
+	}, s)
+}
+
+// write writes n as XML to w.
+func (n *node) write(w *bytes.Buffer) {
+	switch t := n.tok.(type) {
+	case xml.StartElement:
+		w.WriteString("<" + qname(t.Name))
+		for _, a := range t.Attr {
+			w.WriteString(" " + qname(a.Name) + `="`)
+			attrEscaper.WriteString(w, xmlChars(a.Value))
+			w.WriteString(`"`)
+		}
+		if len(n.children) == 0 {
+			w.WriteString("/>")
+			return
+		}
+		w.WriteString(">")
+		for _, c := range n.children {
+			c.write(w)
+		}
+		w.WriteString("</" + qname(t.Name) + ">")
+		return
+	case xml.CharData:
+		textEscaper.WriteString(w, xmlChars(string(t)))
+	case xml.Comment:
+		w.WriteString("<!--" + string(t) + "-->")
+	case xml.ProcInst:
+		w.WriteString("<?" + t.Target)
+		if len(t.Inst) > 0 {
+			w.WriteString(" " + string(t.Inst))
+		}
+		w.WriteString("?>")
+	case xml.Directive:
+		w.WriteString("<!" + string(t) + ">")
+	}
+	for _, c := range n.children {
+		c.write(w)
+	}
+}
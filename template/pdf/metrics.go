@@ -0,0 +1,108 @@
+package pdf
+
+// The widths of the glyphs of the standard Helvetica fonts, in 1/1000 of
+// the font size, from their Adobe font metrics (AFM), for the printable
+// ASCII characters (32 to 126).
+var (
+	helvetica = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+	}
+	helveticaBold = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// winAnsi maps the runes of the WinAnsiEncoding (the encoding of the
+// fonts) outside of ASCII and Latin-1 to their code.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// wideGlyphs are the widths of the non-ASCII glyphs which differ from
+// the one of their base letter (see baseLetters) or from 556, for the
+// regular and bold fonts.
+var wideGlyphs = map[byte][2]int{
+	0x82: {222, 278}, 0x84: {333, 500}, 0x85: {1000, 1000}, 0x89: {1000, 1000},
+	0x8b: {333, 333}, 0x8c: {1000, 1000}, 0x91: {222, 278}, 0x92: {222, 278},
+	0x93: {333, 500}, 0x94: {333, 500}, 0x95: {350, 350}, 0x97: {1000, 1000},
+	0x98: {333, 333}, 0x88: {333, 333}, 0x99: {1000, 1000}, 0x9b: {333, 333},
+	0x9c: {944, 944}, 0xa0: {278, 278}, 0xa1: {333, 333}, 0xa6: {260, 280},
+	0xa9: {737, 737}, 0xab: {556, 556}, 0xad: {333, 333}, 0xae: {737, 737},
+	0xb0: {400, 400}, 0xb1: {584, 584}, 0xb2: {333, 333}, 0xb3: {333, 333},
+	0xb4: {333, 333}, 0xb7: {278, 278}, 0xb9: {333, 333}, 0xbc: {834, 834},
+	0xbd: {834, 834}, 0xbe: {834, 834}, 0xbf: {611, 611}, 0xc6: {1000, 1000},
+	0xd7: {584, 584}, 0xd0: {722, 722}, 0xde: {667, 667}, 0xdf: {611, 611},
+	0xe6: {889, 889}, 0xf0: {556, 611}, 0xf7: {584, 584}, 0xf8: {611, 611},
+	0xfe: {556, 611}, 0xec: {278, 278}, 0xed: {278, 278}, 0xee: {278, 278},
+	0xef: {278, 278},
+}
+
+// baseLetters are the base letters of the accented Latin-1 letters,
+// from 0xc0, which have their width.
+const baseLetters = "AAAAAA_CEEEEIIII_NOOOOO_OUUUUY__aaaaaa_ceeeeiiii_nooooo_ouuuuy_y"
+
+// encode returns the WinAnsiEncoding of s, with '?' for the runes which
+// cannot be encoded.
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b = append(b, ' ')
+		case r >= 32 && r < 127 || r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		case r < 32 || r >= 127 && r < 0xa0:
+			// control characters
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// glyphWidth returns the width of the WinAnsi character c, in 1/1000
+// of the font size.
+func glyphWidth(c byte, bold bool) int {
+	widths := &helvetica
+	i := 0
+	if bold {
+		widths, i = &helveticaBold, 1
+	}
+	if c >= 32 && c < 127 {
+		return widths[c-32]
+	}
+	if w, ok := wideGlyphs[c]; ok {
+		return w[i]
+	}
+	if c >= 0xc0 {
+		if base := baseLetters[c-0xc0]; base != '_' {
+			return widths[base-32]
+		}
+	}
+	return 556
+}
+
+// textWidth returns the width of the encoded text b, in points, with the
+// given font size.
+func textWidth(b []byte, size float64, bold bool) float64 {
+	w := 0
+	for _, c := range b {
+		w += glyphWidth(c, bold)
+	}
+	return float64(w) * size / 1000
+}
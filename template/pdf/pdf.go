@@ -0,0 +1,133 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// document is a PDF document being laid out, page after page, with the
+// fonts Helvetica (F1) and Helvetica-Bold (F2).
+type document struct {
+	width, height float64
+	pages         []*bytes.Buffer // the content streams
+	page          *bytes.Buffer   // the current page
+}
+
+func (d *document) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// num formats the number n for the content streams.
+func num(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// text draws the encoded text b, its baseline starting at (x, y) from
+// the top left corner of the page.
+func (d *document) text(x, y float64, b []byte, size float64, bold bool) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT /%s %s Tf %s %s Td ", font, num(size), num(x), num(d.height-y))
+	d.page.Write(literal(b))
+	d.page.WriteString(" Tj ET\n")
+}
+
+// rect fills the rectangle of top left corner (x, y) with the given
+// gray level (0 is black, 1 white).
+func (d *document) rect(x, y, w, h, gray float64) {
+	fmt.Fprintf(d.page, "%s g %s %s %s %s re f 0 g\n", num(gray), num(x), num(d.height-y-h), num(w), num(h))
+}
+
+// line draws a horizontal line of width w at (x, y), with the given
+// thickness and gray level.
+func (d *document) line(x, y, w, thickness, gray float64) {
+	fmt.Fprintf(d.page, "%s G %s w %s %s m %s %s l S 0 G\n", num(gray), num(thickness),
+		num(x), num(d.height-y), num(x+w), num(d.height-y))
+}
+
+// literal returns the PDF literal string of b.
+func literal(b []byte) []byte {
+	s := make([]byte, 0, len(b)+2)
+	s = append(s, '(')
+	for _, c := range b {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			s = append(s, '\\', c)
+		case c < 32 || c > 126:
+			s = append(s, fmt.Sprintf("\\%03o", c)...)
+		default:
+			s = append(s, c)
+		}
+	}
+	return append(s, ')')
+}
+
+// writeTo writes the PDF file of the document, with the given document
+// information.
+func (d *document) writeTo(wr io.Writer, title, producer string, created time.Time) error {
+	w := &countWriter{w: bufio.NewWriter(wr)}
+	var offsets []int // of the objects, from object 1
+	obj := func(format string, args ...interface{}) {
+		offsets = append(offsets, w.n)
+		fmt.Fprintf(w, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(w, format, args...)
+		io.WriteString(w, "\nendobj\n")
+	}
+	io.WriteString(w, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catalog, 2: pages, 3 and 4: fonts, 5: information, then a
+	// page and its content stream per page
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids bytes.Buffer
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", 6+2*i)
+	}
+	obj("<< /Type /Pages /Kids [ %s] /Count %d /MediaBox [0 0 %s %s] >>", kids.String(), len(d.pages), num(d.width), num(d.height))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj("<< /Title %s /Producer %s /CreationDate (D:%s) >>", literal(encode(title)), literal(encode(producer)), created.UTC().Format("20060102150405Z"))
+	for i, p := range d.pages {
+		obj("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", 7+2*i)
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.Bytes())
+		zw.Close()
+		obj("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes())
+	}
+
+	xref := w.n
+	fmt.Fprintf(w, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(w, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(w, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// countWriter counts the bytes written to w, and keeps the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += n
+	w.err = err
+	return n, err
+}
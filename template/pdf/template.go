@@ -0,0 +1,489 @@
+// Package pdf implements a PDF template, laying out the result tables
+// as paginated tables, without external programs (unlike the
+// LaTeX-based template/tex).
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".pdf"
+	ContentType = "application/pdf"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// PageSizes are the known page sizes, in points (1/72 inch), portrait.
+var PageSizes = map[string][2]float64{
+	"a3":     {841.89, 1190.55},
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// Defaults of the Template fields.
+const (
+	DefaultSize     = "a4"
+	DefaultFontSize = 9
+)
+
+// Layout, in points.
+const (
+	margin      = 36
+	padding     = 3    // of the table cells
+	lineSpacing = 1.25 // line height, relative to the font size
+	titleSize   = 14
+	headingSize = 11
+	footerSize  = 8
+)
+
+// Template implements interfaces sql2http.Template and
+// sql2http.Configurer by laying out the result tables in a PDF
+// document, titled after the request URL like tex.DefaultTeX.
+//
+// The tables span the width of the page: the columns wider than their
+// share of the page are narrowed, and their cells wrapped. The header
+// row of a table is repeated on each of its pages. Numbers are aligned
+// right, and NULL values are empty cells.
+//
+// The text is written with the standard Helvetica font, which every PDF
+// reader provides: the characters outside of the Windows-1252 character
+// set are replaced by '?'.
+//
+// The following request options (see sql2http.Result.Option) are
+// recognized, prefixed with "_pdf.":
+//
+//     size:        page size (see PageSizes), e.g. "letter"
+//     orientation: "portrait" or "landscape"
+type Template struct {
+	// Size is the page size, one of PageSizes. If empty, DefaultSize
+	// is used.
+	Size string
+
+	// Landscape sets the landscape orientation of the pages.
+	Landscape bool
+
+	// FontSize is the font size of the tables, in points. If zero,
+	// DefaultFontSize is used.
+	FontSize float64
+}
+
+// Configure implements interface sql2http.Configurer. The recognized
+// options are:
+//
+//     size:        page size (see PageSizes)
+//     orientation: "portrait" or "landscape"
+//     fontsize:    font size of the tables, in points
+func (t *Template) Configure(options map[string]string) (sql2http.Template, error) {
+	c := *t
+	for k, v := range options {
+		switch k {
+		case "size":
+			if _, ok := PageSizes[strings.ToLower(v)]; !ok {
+				return nil, fmt.Errorf("unknown page size %q", v)
+			}
+			c.Size = strings.ToLower(v)
+		case "orientation":
+			landscape, err := parseOrientation(v)
+			if err != nil {
+				return nil, err
+			}
+			c.Landscape = landscape
+		case "fontsize":
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 {
+				return nil, fmt.Errorf("invalid font size %q", v)
+			}
+			c.FontSize = f
+		default:
+			return nil, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	return &c, nil
+}
+
+func parseOrientation(s string) (landscape bool, err error) {
+	switch strings.ToLower(s) {
+	case "portrait":
+		return false, nil
+	case "landscape":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown orientation %q", s)
+}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/pdf: only *sql2http.Result can be passed as data")
+	}
+	size, landscape := t.Size, t.Landscape
+	if size == "" {
+		size = DefaultSize
+	}
+	if s := resp.Option("pdf", "size"); s != "" {
+		size = strings.ToLower(s)
+	}
+	dim, ok := PageSizes[size]
+	if !ok {
+		return fmt.Errorf("template/pdf: unknown page size %q", size)
+	}
+	if s := resp.Option("pdf", "orientation"); s != "" {
+		var err error
+		if landscape, err = parseOrientation(s); err != nil {
+			return fmt.Errorf("template/pdf: %v", err)
+		}
+	}
+	if landscape {
+		dim[0], dim[1] = dim[1], dim[0]
+	}
+	fontSize := t.FontSize
+	if fontSize <= 0 {
+		fontSize = DefaultFontSize
+	}
+
+	l := &layout{document: &document{width: dim[0], height: dim[1]}, size: fontSize}
+	l.newPage()
+	title := "Results"
+	if resp.Request.URL != nil {
+		title += " for " + resp.Request.URL.EscapedPath()
+	}
+	l.heading(title, titleSize)
+	for _, tbl := range resp.Tables {
+		heading := "Table"
+		if tbl.Name != "" {
+			heading += " " + tbl.Name
+		}
+		l.heading(heading, headingSize)
+		l.table(tbl)
+	}
+	if len(resp.Tables) == 0 {
+		l.heading("No data available.", l.size)
+	}
+	for i, p := range l.pages {
+		l.page = p
+		n := encode(fmt.Sprintf("%d / %d", i+1, len(l.pages)))
+		l.text((l.width-textWidth(n, footerSize, false))/2, l.height-margin/2, n, footerSize, false)
+	}
+	return l.writeTo(wr, title, "sql2http "+resp.Version, resp.Time)
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+// layout lays out the blocks of a document from the top of the pages.
+type layout struct {
+	*document
+	size float64 // font size of the tables
+	y    float64 // top of the free space of the page
+}
+
+func (l *layout) newPage() {
+	l.document.newPage()
+	l.y = margin
+}
+
+// bottom returns the bottom of the space of the pages.
+func (l *layout) bottom() float64 {
+	return l.height - margin
+}
+
+// heading writes the bold text s, wrapped to the page width.
+func (l *layout) heading(s string, size float64) {
+	lines := wrap(s, l.width-2*margin, size, true)
+	lh := size * lineSpacing
+	// keep the heading with a few lines of the following table
+	if l.y+float64(len(lines))*lh+4*l.size*lineSpacing > l.bottom() && l.y > margin {
+		l.newPage()
+	}
+	for _, line := range lines {
+		l.text(margin, l.y+size, line, size, true)
+		l.y += lh
+	}
+	l.y += size / 2
+}
+
+// table writes tbl, repeating its header on each page.
+func (l *layout) table(tbl sql2http.Table) {
+	if len(tbl.Header) == 0 {
+		return
+	}
+	cells := make([][]string, len(tbl.Rows))
+	numeric := make([]bool, len(tbl.Header))
+	for i, row := range tbl.Rows {
+		cells[i] = make([]string, len(tbl.Header))
+		for j, v := range row.Values {
+			if j < len(tbl.Header) {
+				cells[i][j] = text(v)
+				numeric[j] = numeric[j] || isNumber(v)
+			}
+		}
+	}
+
+	natural := make([]float64, len(tbl.Header))
+	measure := func(j int, s string, bold bool) {
+		for _, line := range strings.Split(s, "\n") {
+			if w := textWidth(encode(line), l.size, bold) + 2*padding; w > natural[j] {
+				natural[j] = w
+			}
+		}
+	}
+	for j, h := range tbl.Header {
+		measure(j, h, true)
+	}
+	for _, row := range cells {
+		for j, s := range row {
+			measure(j, s, false)
+		}
+	}
+	widths := fitWidths(natural, l.width-2*margin, 4*l.size)
+
+	wrapRow := func(row []string, bold bool) [][][]byte {
+		lines := make([][][]byte, len(row))
+		for j, s := range row {
+			lines[j] = wrap(s, widths[j]-2*padding, l.size, bold)
+		}
+		return lines
+	}
+	header := wrapRow(tbl.Header, true)
+	lh := l.size * lineSpacing
+	drawHeader := func() {
+		h := float64(maxLines(header))*lh + 2*padding
+		l.rect(margin, l.y, sum(widths), h, 0.85)
+		l.row(header, widths, nil, maxLines(header), true)
+	}
+
+	if l.y+float64(maxLines(header)+1)*lh+4*padding > l.bottom() {
+		l.newPage()
+	}
+	drawHeader()
+	fresh := true // whether only the header is on the page
+	for _, row := range cells {
+		rest := wrapRow(row, false)
+		for n := maxLines(rest); n > 0; n = maxLines(rest) {
+			avail := int((l.bottom() - l.y - 2*padding) / lh)
+			if n > avail {
+				if !fresh {
+					l.newPage()
+					drawHeader()
+					fresh = true
+					continue
+				}
+				// the row does not fit in a page: split it
+				if avail < 1 {
+					avail = 1
+				}
+				n = avail
+			}
+			l.row(rest, widths, numeric, n, false)
+			for j := range rest {
+				if len(rest[j]) > n {
+					rest[j] = rest[j][n:]
+				} else {
+					rest[j] = nil
+				}
+			}
+			fresh = false
+		}
+	}
+	l.y += l.size
+}
+
+// row draws the first n lines of the cells of a row, and a line below.
+func (l *layout) row(cells [][][]byte, widths []float64, right []bool, n int, bold bool) {
+	lh := l.size * lineSpacing
+	x := float64(margin)
+	for j, lines := range cells {
+		for k, line := range lines {
+			if k == n {
+				break
+			}
+			lx := x + padding
+			if right != nil && right[j] {
+				lx = x + widths[j] - padding - textWidth(line, l.size, bold)
+			}
+			l.text(lx, l.y+padding+float64(k)*lh+l.size, line, l.size, bold)
+		}
+		x += widths[j]
+	}
+	l.y += float64(n)*lh + 2*padding
+	l.line(margin, l.y, sum(widths), 0.5, 0.6)
+}
+
+// fitWidths returns the widths of the columns of given natural widths
+// fitting in width: the columns narrower than an equal share of the
+// width keep their width, the others share the remaining width in
+// proportion of their natural width (but no narrower than min). If the
+// minimum widths overflow width, the wider columns are narrowed down to
+// min, then all the columns in proportion.
+func fitWidths(natural []float64, width, min float64) []float64 {
+	widths := append([]float64{}, natural...)
+	if sum(natural) <= width {
+		return widths
+	}
+	fixed := make([]bool, len(natural))
+	for {
+		rest, wide, n := width, 0.0, 0
+		for i, w := range natural {
+			if fixed[i] {
+				rest -= w
+			} else {
+				wide += w
+				n++
+			}
+		}
+		changed := false
+		for i, w := range natural {
+			if !fixed[i] && w <= rest/float64(n) {
+				fixed[i], changed = true, true
+			}
+		}
+		if changed {
+			continue
+		}
+		for i, w := range natural {
+			if !fixed[i] {
+				widths[i] = rest * w / wide
+				if widths[i] < min {
+					widths[i] = min
+				}
+			}
+		}
+		over := sum(widths) - width
+		if over <= 0 {
+			return widths
+		}
+		shrinkable := 0.0
+		for _, w := range widths {
+			if w > min {
+				shrinkable += w - min
+			}
+		}
+		for i, w := range widths {
+			if w > min && shrinkable > over {
+				widths[i] -= over * (w - min) / shrinkable
+			} else if w > min {
+				widths[i] = min
+			}
+		}
+		if total := sum(widths); total > width {
+			for i := range widths {
+				widths[i] *= width / total
+			}
+		}
+		return widths
+	}
+}
+
+// wrap returns the encoded lines of s, wrapped to the given width: at
+// the spaces, or within the words wider than width.
+func wrap(s string, width, size float64, bold bool) [][]byte {
+	var lines [][]byte
+	for _, para := range strings.Split(s, "\n") {
+		b := encode(para)
+		for {
+			if textWidth(b, size, bold) <= width {
+				lines = append(lines, b)
+				break
+			}
+			// the longest prefix fitting width, at least one character
+			end, w := 1, float64(glyphWidth(b[0], bold))*size/1000
+			for end < len(b) {
+				w += float64(glyphWidth(b[end], bold)) * size / 1000
+				if w > width {
+					break
+				}
+				end++
+			}
+			if end < len(b) {
+				// break at the last space, if any, the one after
+				// the prefix included
+				if i := lastSpace(b[:end+1]); i > 0 {
+					end = i
+				}
+			}
+			lines = append(lines, b[:end])
+			b = b[end:]
+			for len(b) > 0 && b[0] == ' ' {
+				b = b[1:]
+			}
+			if len(b) == 0 {
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func lastSpace(b []byte) int {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] == ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+func maxLines(cells [][][]byte) int {
+	n := 0
+	for _, c := range cells {
+		if len(c) > n {
+			n = len(c)
+		}
+	}
+	return n
+}
+
+func sum(f []float64) float64 {
+	s := 0.0
+	for _, v := range f {
+		s += v
+	}
+	return s
+}
+
+// text returns the text of the value v of a cell.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.Replace(v, "\r\n", "\n", -1)
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+// isNumber reports whether v is a number.
+func isNumber(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
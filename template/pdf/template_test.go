@@ -0,0 +1,159 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestWrap(t *testing.T) {
+	if len(baseLetters) != 64 {
+		t.Fatalf("len(baseLetters) = %d", len(baseLetters))
+	}
+	tests := []struct {
+		s     string
+		width float64
+		want  []string
+	}{
+		{"", 100, []string{""}},
+		{"a b c", 100, []string{"a b c"}},
+		// "abc d" is wider than 20pt at 10pt
+		{"abc def ghi", 20, []string{"abc", "def", "ghi"}},
+		{"abcdefgh", 20, []string{"abc", "defg", "h"}},
+		{"ab\ncd", 100, []string{"ab", "cd"}},
+		{"café €", 100, []string{"caf\xe9 \x80"}},
+		{"日本", 100, []string{"??"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, l := range wrap(test.s, test.width, 10, false) {
+			got = append(got, string(l))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("wrap(%q, %v) = %q; want %q", test.s, test.width, got, test.want)
+		}
+	}
+}
+
+func TestFitWidths(t *testing.T) {
+	got := fitWidths([]float64{50, 400, 200}, 450, 20)
+	want := []float64{50, 200, 200}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fitWidths = %v; want %v", got, want)
+	}
+	got = fitWidths([]float64{50, 400, 300}, 450, 20)
+	want = []float64{50, 400 * 400 / 700., 300 * 400 / 700.}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fitWidths = %v; want %v", got, want)
+	}
+	if got := fitWidths([]float64{50, 60}, 450, 20); fmt.Sprint(got) != "[50 60]" {
+		t.Errorf("fitWidths = %v; want [50 60]", got)
+	}
+
+	// the minimum widths overflow: the wide columns give way
+	natural := []float64{100, 100, 500, 500, 500, 500}
+	for _, width := range []float64{450, 200, 100} {
+		got := fitWidths(natural, width, 60)
+		if total := sum(got); math.Abs(total-width) > 1e-9 {
+			t.Errorf("fitWidths(%v) = %v, total %v", width, got, total)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i] < got[i-1]-1e-9 {
+				t.Errorf("fitWidths(%v) = %v: wider column narrowed more", width, got)
+				break
+			}
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"id", "comment"}
+	tbl := sql2http.Table{Name: "notes", Header: header}
+	for i := 0; i < 200; i++ {
+		tbl.Rows = append(tbl.Rows, sql2http.Row{Header: header, Values: []interface{}{
+			int64(i), strings.Repeat("word (x) ", i%30),
+		}})
+	}
+	u, _ := url.Parse("/notes/list?_pdf.orientation=landscape")
+	res := &sql2http.Result{
+		Tables:  sql2http.Tables{tbl},
+		Request: sql2http.Request{URL: u},
+		// a parameter of the page, which is not an option
+		Params: map[string]interface{}{"size": "3"},
+		Time:   time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	buf := &bytes.Buffer{}
+	if err := (&Template{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// the cross-reference table
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(b)
+	if m == nil {
+		t.Fatalf("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d points to %q", xref, b[xref:xref+10])
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(b[xref:], -1)
+	for i, o := range offsets {
+		n, _ := strconv.Atoi(string(o[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(b[n:], []byte(want)) {
+			t.Errorf("object %d at %d: %q", i+1, n, b[n:n+10])
+		}
+	}
+	if !bytes.Contains(b, []byte("/MediaBox [0 0 841.89 595.28]")) {
+		t.Errorf("no landscape A4 media box")
+	}
+	if !bytes.Contains(b, []byte("/Title (Results for /notes/list)")) {
+		t.Errorf("no title")
+	}
+
+	// the pages
+	streams := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindAllSubmatchIndex(b, -1)
+	pages := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(b)
+	if pages == nil || string(pages[1]) != strconv.Itoa(len(streams)) || len(streams) < 3 {
+		t.Fatalf("%d streams, pages %q", len(streams), pages)
+	}
+	ids := make(map[string]bool)
+	for i, s := range streams {
+		n, _ := strconv.Atoi(string(b[s[2]:s[3]]))
+		r, err := zlib.NewReader(bytes.NewReader(b[s[1] : s[1]+n]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(content, []byte("(comment) Tj")) {
+			t.Errorf("page %d has no header", i+1)
+		}
+		if !bytes.Contains(content, []byte(fmt.Sprintf("(%d / %d) Tj", i+1, len(streams)))) {
+			t.Errorf("page %d has no page number", i+1)
+		}
+		if !bytes.Contains(content, []byte(`(word \(x\) word`)) {
+			t.Errorf("page %d: no escaped text", i+1)
+		}
+		for _, id := range regexp.MustCompile(`Td \((\d+)\) Tj`).FindAllSubmatch(content, -1) {
+			ids[string(id[1])] = true
+		}
+	}
+	for i := 0; i < 200; i++ {
+		if !ids[strconv.Itoa(i)] {
+			t.Errorf("row %d missing", i)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package sql
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+const (
+	Ext         = ".sql"
+	ContentType = "application/sql"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+}
+
+// Template implements interface sql2http.Template by writing a SQL
+// script which recreates the query results: a CREATE TABLE statement
+// per result set, followed by the INSERT statements of its rows.
+//
+// The column types are inferred from the database type names reported
+// by the driver (Table.Types), falling back to the Go type of the
+// values.
+//
+// The following request options (see sql2http.Result.Option) are
+// recognized, prefixed with "_sql.":
+//
+//     dialect: target SQL dialect (default Template.Dialect, or the
+//              dialect of the queried database)
+//     batch:   maximum number of rows per INSERT statement (default
+//              Template.Batch)
+type Template struct {
+	// Dialect is the name of the target SQL dialect: "standard", or
+	// the name or an alias of a driver known to package sql2http (see
+	// sql2http.Drivers), e.g. "sqlite3" or "postgresql". If empty, the
+	// dialect of the queried database is used.
+	Dialect string
+
+	// Batch is the maximum number of rows per INSERT statement.
+	// If zero, DefaultBatch is used.
+	Batch int
+}
+
+// DefaultBatch is the default number of rows per INSERT statement.
+const DefaultBatch = 100
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/sql: only *sql2http.Result can be passed as data")
+	}
+	name, explicit := resp.Driver, false
+	if t.Dialect != "" {
+		name, explicit = t.Dialect, true
+	}
+	if s := resp.Option("sql", "dialect"); s != "" {
+		name, explicit = s, true
+	}
+	d := dialectOf(strings.ToLower(name))
+	if d == nil {
+		if explicit {
+			return fmt.Errorf("template/sql: unknown dialect %q", name)
+		}
+		d = standard
+	}
+	batch := t.Batch
+	if s := resp.Option("sql", "batch"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("template/sql: invalid batch size %q", s)
+		}
+		batch = n
+	}
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+	if d.maxBatch > 0 && batch > d.maxBatch {
+		batch = d.maxBatch
+	}
+
+	w := bufio.NewWriter(wr)
+	fmt.Fprintf(w, "-- generated by sql2http %s (%s dialect) on %s\n",
+		resp.Version, d.name, resp.Time.Format(time.RFC3339))
+	if d.begin != "" {
+		fmt.Fprintf(w, "%s;\n", d.begin)
+	}
+	for i, tbl := range resp.Tables {
+		name := tbl.Name
+		if name == "" {
+			name = "result" + strconv.Itoa(i+1)
+		}
+		writeTable(w, d, name, tbl, batch)
+	}
+	if d.commit != "" {
+		fmt.Fprintf(w, "%s;\n", d.commit)
+	}
+	return w.Flush()
+}
+
+func (t *Template) ContentType() string { return ContentType }
+
+func writeTable(w *bufio.Writer, d *dialect, name string, tbl sql2http.Table, batch int) {
+	kinds := columnKinds(tbl)
+	cols := make([]string, len(tbl.Header))
+	for i, h := range tbl.Header {
+		cols[i] = d.ident(h)
+	}
+	table := d.ident(name)
+	if len(cols) == 0 { // CREATE TABLE needs at least one column
+		fmt.Fprintf(w, "\n-- %s skipped: no columns\n", table)
+		return
+	}
+
+	fmt.Fprintf(w, "\nCREATE TABLE %s (", table)
+	for i := range cols {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		fmt.Fprintf(w, "\n\t%s %s", cols[i], d.types[kinds[i]])
+	}
+	w.WriteString("\n);\n")
+
+	insert := "INSERT INTO " + table + " (" + strings.Join(cols, ", ") + ") VALUES"
+	for i, row := range tbl.Rows {
+		if i%batch == 0 {
+			w.WriteString(insert)
+		} else {
+			w.WriteString(",")
+		}
+		w.WriteString("\n\t(")
+		for j, v := range row.Values {
+			if j > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(d.literal(v, kinds[j]))
+		}
+		w.WriteString(")")
+		if i%batch == batch-1 || i == len(tbl.Rows)-1 {
+			w.WriteString(";\n")
+		}
+	}
+}
+
+// kind is the generic type of a column, mapped to a type name by each
+// dialect.
+type kind int
+
+const (
+	kindText kind = iota
+	kindInteger
+	kindFloat
+	kindNumeric
+	kindBool
+	kindBlob
+	kindTimestamp
+	kindDate
+	kindTime
+)
+
+// columnKinds infers the kind of each column of tbl from its database
+// type name, or if unknown from the first non-NULL value of the column.
+func columnKinds(tbl sql2http.Table) []kind {
+	kinds := make([]kind, len(tbl.Header))
+	for i := range kinds {
+		if i < len(tbl.Types) && tbl.Types[i] != "" {
+			kinds[i] = kindOfType(tbl.Types[i])
+			continue
+		}
+		for _, row := range tbl.Rows {
+			if v := row.Values[i]; v != nil {
+				kinds[i] = kindOfValue(v)
+				break
+			}
+		}
+	}
+	return kinds
+}
+
+func kindOfType(typ string) kind {
+	t := strings.ToUpper(typ)
+	has := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(t, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("BLOB", "BYTEA", "BINARY", "RAW", "IMAGE"):
+		return kindBlob
+	case has("BOOL") || t == "BIT":
+		return kindBool
+	case has("TIMESTAMP", "DATETIME"):
+		return kindTimestamp
+	case has("DATE"):
+		return kindDate
+	case has("INTERVAL", "POINT"):
+		return kindText
+	case has("TIME"):
+		return kindTime
+	case has("INT", "SERIAL"):
+		return kindInteger
+	case has("FLOAT", "DOUBLE", "REAL"):
+		return kindFloat
+	case has("DEC", "NUMERIC", "NUMBER", "MONEY"):
+		return kindNumeric
+	}
+	return kindText
+}
+
+func kindOfValue(v interface{}) kind {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return kindInteger
+	case float32, float64:
+		return kindFloat
+	case bool:
+		return kindBool
+	case []byte:
+		return kindBlob
+	case time.Time:
+		return kindTimestamp
+	}
+	return kindText
+}
+
+// dialect describes how a SQL database engine spells types and
+// literals. The dialects are looked up by their database/sql driver
+// name with dialectOf.
+type dialect struct {
+	name       string
+	quote      [2]string // identifier quotes
+	bareIdents bool      // identifiers cannot be quoted
+	bools      [2]string // false, true literals
+	backslash  bool      // backslashes in strings must be escaped
+	nstring    bool      // prefix string literals with N
+	goStrings  bool      // string literals use the Go syntax
+	blob       func([]byte) string
+	timeFormat string
+	timeFunc   string // if non-empty, wraps time literals: fn('...')
+	types      map[kind]string
+	begin      string
+	commit     string
+	maxBatch   int // maximum rows per INSERT; 0 if unlimited
+}
+
+func hexBlob(prefix, suffix string) func([]byte) string {
+	return func(b []byte) string {
+		return prefix + hex.EncodeToString(b) + suffix
+	}
+}
+
+var standard = &dialect{
+	name:       "standard",
+	quote:      [2]string{`"`, `"`},
+	bools:      [2]string{"FALSE", "TRUE"},
+	blob:       hexBlob("X'", "'"),
+	timeFormat: "2006-01-02 15:04:05.999999999",
+	types: map[kind]string{
+		kindText:      "VARCHAR",
+		kindInteger:   "BIGINT",
+		kindFloat:     "DOUBLE PRECISION",
+		kindNumeric:   "NUMERIC",
+		kindBool:      "BOOLEAN",
+		kindBlob:      "BLOB",
+		kindTimestamp: "TIMESTAMP",
+		kindDate:      "DATE",
+		kindTime:      "TIME",
+	},
+	begin:  "BEGIN TRANSACTION",
+	commit: "COMMIT",
+}
+
+var sqlite = &dialect{
+	name:       "sqlite3",
+	quote:      [2]string{`"`, `"`},
+	bools:      [2]string{"0", "1"},
+	blob:       hexBlob("X'", "'"),
+	timeFormat: "2006-01-02 15:04:05.999999999-07:00",
+	types: map[kind]string{
+		kindText:      "TEXT",
+		kindInteger:   "INTEGER",
+		kindFloat:     "REAL",
+		kindNumeric:   "NUMERIC",
+		kindBool:      "BOOLEAN",
+		kindBlob:      "BLOB",
+		kindTimestamp: "DATETIME",
+		kindDate:      "DATE",
+		kindTime:      "TEXT",
+	},
+	begin:  "BEGIN TRANSACTION",
+	commit: "COMMIT",
+}
+
+var postgres = &dialect{
+	name:       "postgres",
+	quote:      [2]string{`"`, `"`},
+	bools:      [2]string{"FALSE", "TRUE"},
+	blob:       hexBlob(`'\x`, "'::bytea"),
+	timeFormat: "2006-01-02 15:04:05.999999999-07:00",
+	types: map[kind]string{
+		kindText:      "TEXT",
+		kindInteger:   "BIGINT",
+		kindFloat:     "DOUBLE PRECISION",
+		kindNumeric:   "NUMERIC",
+		kindBool:      "BOOLEAN",
+		kindBlob:      "BYTEA",
+		kindTimestamp: "TIMESTAMP WITH TIME ZONE",
+		kindDate:      "DATE",
+		kindTime:      "TIME",
+	},
+	begin:  "BEGIN",
+	commit: "COMMIT",
+}
+
+var mysql = &dialect{
+	name:       "mysql",
+	quote:      [2]string{"`", "`"},
+	bools:      [2]string{"FALSE", "TRUE"},
+	backslash:  true,
+	blob:       hexBlob("X'", "'"),
+	timeFormat: "2006-01-02 15:04:05.999999",
+	types: map[kind]string{
+		kindText:      "LONGTEXT",
+		kindInteger:   "BIGINT",
+		kindFloat:     "DOUBLE",
+		kindNumeric:   "DECIMAL(65,30)",
+		kindBool:      "BOOLEAN",
+		kindBlob:      "LONGBLOB",
+		kindTimestamp: "DATETIME(6)",
+		kindDate:      "DATE",
+		kindTime:      "TIME(6)",
+	},
+	begin:  "START TRANSACTION",
+	commit: "COMMIT",
+}
+
+var sqlserver = &dialect{
+	name:       "sqlserver",
+	quote:      [2]string{"[", "]"},
+	bools:      [2]string{"0", "1"},
+	nstring:    true,
+	blob:       hexBlob("0x", ""),
+	timeFormat: "2006-01-02T15:04:05.9999999",
+	types: map[kind]string{
+		kindText:      "NVARCHAR(MAX)",
+		kindInteger:   "BIGINT",
+		kindFloat:     "FLOAT",
+		kindNumeric:   "DECIMAL(38,10)",
+		kindBool:      "BIT",
+		kindBlob:      "VARBINARY(MAX)",
+		kindTimestamp: "DATETIME2",
+		kindDate:      "DATE",
+		kindTime:      "TIME",
+	},
+	begin:    "BEGIN TRANSACTION",
+	commit:   "COMMIT",
+	maxBatch: 1000,
+}
+
+var oracle = &dialect{
+	name:       "oci8",
+	quote:      [2]string{`"`, `"`},
+	bools:      [2]string{"0", "1"},
+	blob:       hexBlob("HEXTORAW('", "')"),
+	timeFormat: "2006-01-02 15:04:05.999999999",
+	timeFunc:   "TIMESTAMP ",
+	types: map[kind]string{
+		kindText:      "CLOB",
+		kindInteger:   "NUMBER(19)",
+		kindFloat:     "BINARY_DOUBLE",
+		kindNumeric:   "NUMBER",
+		kindBool:      "NUMBER(1)",
+		kindBlob:      "BLOB",
+		kindTimestamp: "TIMESTAMP",
+		kindDate:      "DATE",
+		kindTime:      "TIMESTAMP",
+	},
+	maxBatch: 1, // no multi-row VALUES
+}
+
+var ql = &dialect{
+	name:       "ql",
+	bareIdents: true,
+	bools:      [2]string{"false", "true"},
+	goStrings:  true,
+	blob: func(b []byte) string {
+		return "blob(" + strconv.Quote(string(b)) + ")"
+	},
+	timeFormat: time.RFC3339Nano,
+	timeFunc:   "parseTime(\"" + time.RFC3339Nano + "\", ",
+	types: map[kind]string{
+		kindText:      "string",
+		kindInteger:   "int64",
+		kindFloat:     "float64",
+		kindNumeric:   "float64",
+		kindBool:      "bool",
+		kindBlob:      "blob",
+		kindTimestamp: "time",
+		kindDate:      "time",
+		kindTime:      "time",
+	},
+	begin:  "BEGIN TRANSACTION",
+	commit: "COMMIT",
+}
+
+// dialects are the dialects of the drivers known to package sql2http,
+// by driver name.
+var dialects = map[string]*dialect{
+	"sqlite3":   sqlite,
+	"postgres":  postgres,
+	"mysql":     mysql,
+	"sqlserver": sqlserver,
+	"oci8":      oracle,
+	"ql":        ql,
+}
+
+// dialectOf returns the dialect of name, "standard" or the name or an
+// alias of a driver known to package sql2http (see
+// sql2http.LookupDriver). It returns nil if the name is unknown.
+func dialectOf(name string) *dialect {
+	if name == standard.name {
+		return standard
+	}
+	drv, ok := sql2http.LookupDriver(name)
+	if !ok {
+		return nil
+	}
+	if d := dialects[drv.Name]; d != nil {
+		return d
+	}
+	return standard
+}
+
+func (d *dialect) ident(s string) string {
+	if d.bareIdents {
+		return strings.Map(func(r rune) rune {
+			if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+				return r
+			}
+			return '_'
+		}, s)
+	}
+	return d.quote[0] + strings.Replace(s, d.quote[1], d.quote[1]+d.quote[1], -1) + d.quote[1]
+}
+
+func (d *dialect) string(s string) string {
+	if d.goStrings {
+		return strconv.Quote(s)
+	}
+	if d.backslash {
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+	s = "'" + strings.Replace(s, "'", "''", -1) + "'"
+	if d.nstring {
+		s = "N" + s
+	}
+	return s
+}
+
+func (d *dialect) time(t time.Time, k kind) string {
+	layout := d.timeFormat
+	switch {
+	case d.goStrings:
+	case k == kindDate:
+		layout = "2006-01-02"
+	case k == kindTime:
+		layout = "15:04:05.999999"
+	}
+	s := t.Format(layout)
+	switch {
+	case d.goStrings:
+		return d.timeFunc + strconv.Quote(s) + ")"
+	case d.timeFunc != "" && k == kindDate:
+		return "DATE '" + s + "'"
+	case d.timeFunc != "":
+		return d.timeFunc + "'" + s + "'"
+	}
+	return "'" + s + "'"
+}
+
+// literal returns the SQL literal of value v, stored in a column of
+// kind k.
+func (d *dialect) literal(v interface{}, k kind) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return d.float(v, 64)
+	case float32:
+		return d.float(float64(v), 32)
+	case bool:
+		if v {
+			return d.bools[1]
+		}
+		return d.bools[0]
+	case []byte:
+		return d.blob(v)
+	case time.Time:
+		return d.time(v, k)
+	case string:
+		switch k {
+		case kindInteger, kindFloat, kindNumeric:
+			// some drivers (e.g. mysql) return numbers as text
+			if decimalRE.MatchString(v) {
+				return v
+			}
+		case kindBlob:
+			return d.blob([]byte(v))
+		}
+		return d.string(v)
+	}
+	return d.string(fmt.Sprint(v))
+}
+
+// decimalRE matches the numbers which can be written as such in all the
+// dialects; ParseFloat also accepts e.g. "Inf", "0x1p-2" or "1_000".
+var decimalRE = regexp.MustCompile(`^[-+]?\d+(\.\d*)?([eE][-+]?\d+)?$`)
+
+func (d *dialect) float(f float64, bits int) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return d.string(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if d.goStrings && !strings.ContainsAny(s, ".eE") {
+		s += ".0" // keep the value a float64 constant for ql
+	}
+	return s
+}
@@ -0,0 +1,144 @@
+package sql
+
+import (
+	"bytes"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestLiteral(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		d    *dialect
+		v    interface{}
+		k    kind
+		want string
+	}{
+		{standard, nil, kindText, "NULL"},
+		{standard, int64(-42), kindInteger, "-42"},
+		{standard, 1.5, kindFloat, "1.5"},
+		{standard, math.Inf(1), kindFloat, "'+Inf'"},
+		{standard, true, kindBool, "TRUE"},
+		{standard, "it's", kindText, "'it''s'"},
+		{standard, []byte{0xca, 0xfe}, kindBlob, "X'cafe'"},
+		{standard, ts, kindTimestamp, "'2020-03-01 12:30:00'"},
+		{standard, ts, kindDate, "'2020-03-01'"},
+
+		// numbers as text are kept only if they are plain decimals
+		{standard, "12.50", kindNumeric, "12.50"},
+		{standard, "-1e10", kindNumeric, "-1e10"},
+		{standard, "+3.", kindNumeric, "+3."},
+		{standard, "Inf", kindFloat, "'Inf'"},
+		{standard, "NaN", kindFloat, "'NaN'"},
+		{standard, "0x1p-2", kindNumeric, "'0x1p-2'"},
+		{standard, "1_000", kindInteger, "'1_000'"},
+		{standard, ".5", kindNumeric, "'.5'"},
+		{standard, "1); DROP TABLE t; --", kindInteger, "'1); DROP TABLE t; --'"},
+
+		{sqlite, true, kindBool, "1"},
+		{sqlite, ts, kindTimestamp, "'2020-03-01 12:30:00+00:00'"},
+		{postgres, []byte{0xca, 0xfe}, kindBlob, `'\xcafe'::bytea`},
+		{mysql, `a\b`, kindText, `'a\\b'`},
+		{sqlserver, "é", kindText, "N'é'"},
+		{sqlserver, []byte{0xca, 0xfe}, kindBlob, "0xcafe"},
+		{oracle, ts, kindTimestamp, "TIMESTAMP '2020-03-01 12:30:00'"},
+		{oracle, ts, kindDate, "DATE '2020-03-01'"},
+		{ql, "a\"b", kindText, `"a\"b"`},
+		{ql, 2.0, kindFloat, "2.0"},
+		{ql, []byte("x"), kindBlob, `blob("x")`},
+	}
+	for _, tt := range tests {
+		if got := tt.d.literal(tt.v, tt.k); got != tt.want {
+			t.Errorf("%s: literal(%#v, %d) = %s; want %s", tt.d.name, tt.v, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	tbl := sql2http.Table{
+		Name:   "t",
+		Header: []string{"id", "name"},
+		Types:  []string{"INTEGER", "VARCHAR"},
+		Rows:   []sql2http.Row{{Values: []interface{}{int64(1), "a"}}},
+	}
+	tests := []struct {
+		dialect string
+		want    string
+	}{
+		{"", "CREATE TABLE \"t\" (\n\t\"id\" BIGINT,\n\t\"name\" VARCHAR\n);\n"},
+		{"sqlite", "CREATE TABLE \"t\" (\n\t\"id\" INTEGER,\n\t\"name\" TEXT\n);\n"},
+		{"postgresql", "CREATE TABLE \"t\" (\n\t\"id\" BIGINT,\n\t\"name\" TEXT\n);\n"},
+		{"mysql", "CREATE TABLE `t` (\n\t`id` BIGINT,\n\t`name` LONGTEXT\n);\n"},
+		{"mssql", "CREATE TABLE [t] (\n\t[id] BIGINT,\n\t[name] NVARCHAR(MAX)\n);\n"},
+		{"oracle", "CREATE TABLE \"t\" (\n\t\"id\" NUMBER(19),\n\t\"name\" CLOB\n);\n"},
+		{"ql", "CREATE TABLE t (\n\tid int64,\n\tname string\n);\n"},
+	}
+	for _, tt := range tests {
+		resp := &sql2http.Result{
+			Tables:  sql2http.Tables{tbl},
+			Request: sql2http.Request{URL: &url.URL{RawQuery: "_sql.dialect=" + tt.dialect}},
+			// a parameter of the page, which is not an option
+			Params: map[string]interface{}{"dialect": "db2"},
+		}
+		var buf bytes.Buffer
+		if err := (&Template{}).Execute(&buf, resp); err != nil {
+			t.Errorf("%q: %v", tt.dialect, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%q: missing %q in:\n%s", tt.dialect, tt.want, buf.String())
+		}
+	}
+}
+
+func TestNoColumns(t *testing.T) {
+	resp := &sql2http.Result{Tables: sql2http.Tables{{Name: "empty"}}}
+	var buf bytes.Buffer
+	if err := (&Template{}).Execute(&buf, resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "CREATE TABLE") {
+		t.Errorf("table without columns created:\n%s", buf.String())
+	}
+}
+
+func TestUnknownDialect(t *testing.T) {
+	resp := &sql2http.Result{Request: sql2http.Request{URL: &url.URL{RawQuery: "_sql.dialect=db2"}}}
+	if err := (&Template{}).Execute(&bytes.Buffer{}, resp); err == nil {
+		t.Error("no error for an unknown dialect")
+	}
+	resp = &sql2http.Result{Driver: "db2", Request: sql2http.Request{URL: &url.URL{RawQuery: "_sql.batch=0"}}}
+	if err := (&Template{}).Execute(&bytes.Buffer{}, resp); err == nil {
+		t.Error("no error for an invalid batch size")
+	}
+	resp = &sql2http.Result{Driver: "db2"}
+	if err := (&Template{}).Execute(&bytes.Buffer{}, resp); err != nil {
+		t.Errorf("unknown driver: %v", err)
+	}
+}
+
+func TestDialects(t *testing.T) {
+	for _, drv := range sql2http.Drivers() {
+		if dialects[drv.Name] == nil {
+			t.Errorf("no dialect for driver %s", drv.Name)
+		}
+		for _, alias := range drv.Aliases {
+			if dialectOf(alias) != dialects[drv.Name] {
+				t.Errorf("alias %s: not the dialect of %s", alias, drv.Name)
+			}
+		}
+	}
+	for name := range dialects {
+		if _, ok := sql2http.LookupDriver(name); !ok {
+			t.Errorf("dialect of unknown driver %s", name)
+		}
+	}
+	if dialectOf("standard") != standard {
+		t.Error("no standard dialect")
+	}
+}
@@ -2,16 +2,12 @@ package tex
 
 import (
 	"fmt"
-	"io/ioutil"
-	"log"
-	"os"
-	gopath "path"
-	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
 
 	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
 )
 
 func init() {
@@ -29,25 +25,38 @@ const (
 // to escape strings in (La)TeX documents.
 type Template struct {
 	*template.Template
+
+	contentType string               // overrides ContentType if not empty
+	pages       map[string]*Template // the pages of a tree, see ParseTree
 }
 
 // ContentType implements interface sql2http.Template.
-// It returns the constant string ContentType.
-func (t *Template) ContentType() string { return ContentType }
+// It returns the constant string ContentType, unless the template file
+// overrides it (see ParseTree).
+func (t *Template) ContentType() string {
+	if t.contentType != "" {
+		return t.contentType
+	}
+	return ContentType
+}
 
 // Lookup returns the template associated with t with given name. This
-// method is particularly useful with ParseTree.
+// method is particularly useful with ParseTree, in which case the name
+// is the one of a page.
 //
 // If no such template exists, nil is returned.
 func (t *Template) Lookup(name string) *Template {
 	if t == nil {
 		return nil
 	}
+	if t.pages != nil {
+		return t.pages[name]
+	}
 	tmpl := t.Template.Lookup(name)
 	if tmpl == nil {
 		return nil
 	}
-	return &Template{Template: tmpl}
+	return &Template{Template: tmpl, contentType: t.contentType}
 }
 
 // New wraps the standard library text/template.New.
@@ -63,41 +72,40 @@ func New(name string) *Template {
 // ParseTree creates a new Template, walks recursively the files starting
 // at the given directory, and for each file ending with ".tex" parses
 // the template definition under the relative file name.
-// The returned template is the first matching file.
+// The returned template is the first matching file; the others are
+// returned by its Lookup method.
+//
+// Like for the html templates, the files under _partials/ define
+// templates shared by all pages, and the ones under _layouts/ are
+// layouts pages can extend (see package
+// git.sr.ht/~detaoin/sql2http/internal/tree), e.g.:
+//
+//     ((/* layout: letter */))
+//     ((define "body"))Dear customer, ...((end))
+//
+// A file may also override its content type with a leading directive:
+//
+//     ((/* content-type: text/plain; charset=utf-8 */))
 func ParseTree(dir string) (*Template, error) {
+	tr, err := tree.Read(dir, Ext, "((", "))")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := tr.Parse(namespace{New("").Template}, Ext)
+	if err != nil {
+		return nil, err
+	}
 	var t *Template
-	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if fi.IsDir() || filepath.Ext(path) != Ext {
-			return nil
-		}
-		name, err := filepath.Rel(dir, path)
-		if err != nil {
-			return err
-		}
-		name = strings.TrimSuffix(name, Ext)
-		name = gopath.Clean("/" + filepath.ToSlash(name))
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		s := string(b)
+	pages := make(map[string]*Template)
+	for _, p := range parsed {
+		tmpl := p.Namespace.(namespace).Lookup(p.Main)
+		page := &Template{Template: tmpl, contentType: p.Directives[tree.ContentType], pages: pages}
+		pages[p.Name] = page
 		if t == nil {
-			t = New(name)
+			t = page
 		}
-		var tmpl *template.Template
-		if name == t.Name() {
-			tmpl = t.Template
-		} else {
-			tmpl = t.New(name)
-		}
-		log.Println("found template", name, Ext)
-		_, err = tmpl.Parse(s)
-		return err
-	})
-	return t, err
+	}
+	return t, nil
 }
 
 func Escape(v interface{}) string {
@@ -137,12 +145,31 @@ func EscapeString(s string) string {
 	return s
 }
 
-var templateFuncs = template.FuncMap{
-	"tex": Escape,
-}
+// templateFuncs are sql2http.TemplateFuncs, with tex replaced by Escape.
+var templateFuncs = func() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, fn := range sql2http.TemplateFuncs {
+		funcs[name] = fn
+	}
+	funcs["tex"] = Escape
+	return funcs
+}()
 
 var DefaultTemplate = must(New("_default.tex").Parse(DefaultTeX))
 
+// namespace implements interface tree.Namespace.
+type namespace struct{ *template.Template }
+
+func (ns namespace) Parse(name, text string) error {
+	_, err := ns.New(name).Parse(text)
+	return err
+}
+
+func (ns namespace) Clone() (tree.Namespace, error) {
+	t, err := ns.Template.Clone()
+	return namespace{t}, err
+}
+
 func must(t *template.Template, err error) *Template {
 	if err != nil {
 		panic(err)
@@ -0,0 +1,120 @@
+// Package text implements sql2http.Template with the standard library
+// text/template package, for any output format without specific
+// escaping needs: JSON, XML, CSV, YAML, SVG, plain text, ...
+//
+// Unlike the other template packages, it registers no default
+// template: the templates are parsed from files, see ParseTree.
+package text
+
+import (
+	"mime"
+	"text/template"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
+)
+
+// DefaultContentType is the content type of templates whose file
+// extension has no known MIME type.
+const DefaultContentType = "text/plain; charset=utf-8"
+
+// Template extends the standard text/template.Template to implement
+// interface sql2http.Template (with ContentType method).
+type Template struct {
+	*template.Template
+
+	contentType string
+	pages       map[string]*Template // the pages of a tree, see ParseTree
+}
+
+// ContentType implements interface sql2http.Template.
+func (t *Template) ContentType() string {
+	if t.contentType != "" {
+		return t.contentType
+	}
+	return DefaultContentType
+}
+
+// Lookup returns the template associated with t with given name. This
+// method is particularly useful with ParseTree, in which case the name
+// is the one of a page.
+//
+// If no such template exists, nil is returned.
+func (t *Template) Lookup(name string) *Template {
+	if t == nil {
+		return nil
+	}
+	if t.pages != nil {
+		return t.pages[name]
+	}
+	tmpl := t.Template.Lookup(name)
+	if tmpl == nil {
+		return nil
+	}
+	return &Template{Template: tmpl, contentType: t.contentType}
+}
+
+// New wraps the standard library text/template.New, adding
+// sql2http.TemplateFuncs to the template functions. The returned
+// template has the given content type.
+func New(name, contentType string) *Template {
+	return &Template{
+		Template:    template.New(name).Funcs(sql2http.TemplateFuncs),
+		contentType: contentType,
+	}
+}
+
+// ParseTree creates a new Template, walks recursively the files starting
+// at the given directory, and for each file ending with the given
+// extension (e.g. ".json") parses the template definition under the
+// relative file name.
+// The returned template is the first matching file; the others are
+// returned by its Lookup method.
+//
+// Like for the html templates, the files under _partials/ define
+// templates shared by all pages, and the ones under _layouts/ are
+// layouts pages can extend (see package
+// git.sr.ht/~detaoin/sql2http/internal/tree).
+//
+// The content type of the templates is given by mime.TypeByExtension,
+// unless the file overrides it with a leading directive, e.g.:
+//
+//     {{/* content-type: application/xml */}}
+func ParseTree(dir, ext string) (*Template, error) {
+	tr, err := tree.Read(dir, ext, "{{", "}}")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := tr.Parse(namespace{New("", "").Template}, ext)
+	if err != nil {
+		return nil, err
+	}
+	var t *Template
+	pages := make(map[string]*Template)
+	for _, p := range parsed {
+		tmpl := p.Namespace.(namespace).Lookup(p.Main)
+		ct := p.Directives[tree.ContentType]
+		if ct == "" {
+			ct = mime.TypeByExtension(ext)
+		}
+		page := &Template{Template: tmpl, contentType: ct, pages: pages}
+		pages[p.Name] = page
+		if t == nil {
+			t = page
+		}
+	}
+	return t, nil
+}
+
+// namespace implements interface tree.Namespace.
+type namespace struct{ *template.Template }
+
+func (ns namespace) Parse(name, text string) error {
+	_, err := ns.New(name).Parse(text)
+	return err
+}
+
+func (ns namespace) Clone() (tree.Namespace, error) {
+	t, err := ns.Template.Clone()
+	return namespace{t}, err
+}
@@ -5,7 +5,6 @@ import (
 	"io"
 
 	"git.sr.ht/~detaoin/sql2http"
-	"github.com/tealeg/xlsx"
 )
 
 const Ext = ".xlsx"
@@ -14,41 +13,59 @@ func init() {
 	sql2http.DefaultTemplateSet.Register(Ext, &XLSXTemplate{})
 }
 
-// XLSXTemplate implements interface Template by writing with csv.Encode the
-// SQL query rows to the io.Writer. Each individual SQL query result set is
-// separated by an empty line.
-type XLSXTemplate struct {}
+// Number formats of the cells.
+const (
+	DateFormat     = "yyyy-mm-dd"
+	DateTimeFormat = "yyyy-mm-dd hh:mm:ss"
+)
+
+// Column widths, in characters.
+const (
+	minColWidth = 8
+	maxColWidth = 60
+)
+
+// XLSXTemplate implements interfaces sql2http.Template and
+// sql2http.StreamTemplate by writing an Excel workbook, with one sheet
+// per SQL query result set.
+//
+// The workbook is written while the rows are read from the database:
+// only the first rows of each table are buffered, to estimate the column
+// widths. The strings are written inline. The rows of a table exceeding
+// the capacity of a sheet (1048576 rows) continue in another sheet.
+//
+// The header row of each sheet is bold, frozen, and has an auto-filter.
+// Numeric, boolean and time.Time values are written with their
+// respective cell types; time.Time values of DATE columns as dates.
+// Strings of DECIMAL or NUMERIC columns (as returned by some drivers)
+// are written as numbers with as many decimals. All other values are
+// written as strings, and NULL values as empty cells.
+//
+// The sheets are named after the queries, see sql2http.Tables.SheetNames.
+type XLSXTemplate struct{}
 
 func (t *XLSXTemplate) Execute(wr io.Writer, data interface{}) error {
 	resp, ok := data.(*sql2http.Result)
 	if !ok {
 		return fmt.Errorf("template/xlsx: only *sql2http.Results can be passed as data")
 	}
-	out := xlsx.NewFile()
-	for _, tbl := range resp.Tables {
-		name := tbl.Name
-		if name == "" {
-			name = "default"
-		}
-		if len(name) > 30 {
-			name = name[:27] + "..."
-		}
-		sh, err := out.AddSheet(name)
-		if err != nil {
-			return fmt.Errorf("template/xlsx: error creating new sheet: %v", err)
-		}
-		n := sh.AddRow().WriteSlice(&tbl.Header, -1)
-		if n != len(tbl.Header) {
-			return fmt.Errorf("template/xlsx[%s]: write header row fail (wrote only %d/%d values)", name, n, len(tbl.Header))
-		}
-		for i, row := range tbl.Rows {
-			n := sh.AddRow().WriteSlice(&row.Values, -1)
-			if n != len(row.Values) {
-				return fmt.Errorf("template/xlsx[%s:%d]: write data row fail (wrote only %d/%d values)", name, i, n, len(row.Values))
-			}
+	return t.ExecuteStream(wr, resp, resp.Tables.Stream())
+}
+
+func (t *XLSXTemplate) ExecuteStream(wr io.Writer, data *sql2http.Result, tables *sql2http.TableStream) error {
+	wb := newWorkbook(wr)
+	for tables.NextTable() {
+		if err := wb.writeTable(tables); err != nil {
+			return fmt.Errorf("template/xlsx: %v", err)
 		}
 	}
-	return out.Write(wr)
+	if err := tables.Err(); err != nil {
+		return err
+	}
+	if err := wb.close(); err != nil {
+		return fmt.Errorf("template/xlsx: %v", err)
+	}
+	return nil
 }
 
 func (t *XLSXTemplate) ContentType() string {
@@ -0,0 +1,765 @@
+package sql2http
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"git.sr.ht/~detaoin/sql2http/internal/tree"
+)
+
+// Workbook implements interface sql2http.Template by filling a copy of
+// a workbook file (e.g. made with a spreadsheet application) with the
+// rows of the queries, keeping all its other sheets, styles, charts and
+// formulas.
+//
+// The rows of a query are written:
+//
+//   - from the cell of the defined name (see "Name Manager" in Excel)
+//     named like the query, if any. If the name refers to a range of
+//     several rows, its first row is a header, and the rows are written
+//     below. The name is then resized to the written rows (and the
+//     header), so that formulas, charts and pivot tables using it cover
+//     all the rows.
+//   - else in the sheet named like the query, after its last row having
+//     values (e.g. a formatted header). If the sheet has no values, the
+//     column names are written first.
+//
+// The names are compared case-insensitively. Queries with no such
+// defined name or sheet are not written.
+//
+// The written rows replace the cells in their way: they are not
+// inserted. The cells of the first written row give their style to all
+// the rows of their column, and its height and style to the rows: for
+// example, a template can format the first data row with a date format
+// and a bold font. Dates and decimals written in cells without style
+// get the number formats of XLSXTemplate.
+//
+// As the cached values of the formulas are outdated, the workbook is
+// recalculated when opened, and its pivot tables refreshed.
+//
+// Unlike XLSXTemplate, the rows are first read in memory.
+//
+// The parts are edited as text, not through a full XML parser: the
+// SpreadsheetML elements are expected unprefixed, or else with a single
+// prefix bound on the root element of their part (as written by the
+// Open XML SDK), which is then removed. Other prefixes, e.g. declared on
+// inner elements, are not understood.
+type Workbook struct {
+	parts []part // the zip archive entries, in order
+
+	workbook  string               // path of the workbook part, e.g. "xl/workbook.xml"
+	rels      string               // path of the workbook relationships part
+	styles    string               // path of the styles part
+	calcChain string               // path of the calculation chain part, if any
+	sheets    map[string]sheetPart // the worksheets, by lowercase name
+	names     []definedName        // the defined names, in order
+
+	firstStyle  int // the number of cell styles
+	firstNumFmt int // the first free custom number format id
+
+	pages tree.Files // the pages of a tree, see ParseTree
+}
+
+type part struct {
+	header zip.FileHeader
+	data   []byte
+}
+
+type sheetPart struct {
+	name string
+	path string
+}
+
+type definedName struct {
+	Name string `xml:"name,attr"`
+	Ref  string `xml:",chardata"`
+}
+
+type relationship struct {
+	ID         string `xml:"Id,attr"`
+	Type       string `xml:"Type,attr"`
+	Target     string `xml:"Target,attr"`
+	TargetMode string `xml:"TargetMode,attr"`
+}
+
+// ParseTree walks recursively the files starting at the given directory,
+// and reads each file ending with Ext as a Workbook named by its
+// relative path without extension (see package
+// git.sr.ht/~detaoin/sql2http/internal/tree).
+// The returned workbook is the first file; the others are returned by
+// its Lookup method.
+func ParseTree(dir string) (*Workbook, error) {
+	pages, first, err := tree.ParseFiles(dir, Ext, func(path string) (interface{}, error) {
+		return ParseFile(path)
+	})
+	if err != nil || first == "" {
+		return nil, err
+	}
+	t := pages[first].(*Workbook)
+	t.pages = pages
+	return t, nil
+}
+
+// Lookup returns the workbook of the tree of wb with the given name, or
+// nil.
+func (wb *Workbook) Lookup(name string) *Workbook {
+	if wb == nil {
+		return nil
+	}
+	t, _ := wb.pages[name].(*Workbook)
+	return t
+}
+
+// ParseFile reads the workbook file at path.
+func ParseFile(path string) (*Workbook, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	wb, err := parseWorkbook(b)
+	if err != nil {
+		return nil, fmt.Errorf("template/xlsx: %s: %v", path, err)
+	}
+	return wb, nil
+}
+
+func parseWorkbook(b []byte) (*Workbook, error) {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	wb := &Workbook{sheets: make(map[string]sheetPart)}
+	files := make(map[string][]byte)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(f.Name, ".xml") {
+			data = unprefixMain(data)
+		}
+		wb.parts = append(wb.parts, part{f.FileHeader, data})
+		files[f.Name] = data
+	}
+
+	rels, err := readRels(files, "_rels/.rels")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rels {
+		if strings.HasSuffix(r.Type, "/officeDocument") {
+			wb.workbook = partPath("", r.Target)
+		}
+	}
+	if files[wb.workbook] == nil {
+		return nil, fmt.Errorf("no workbook")
+	}
+	var doc struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+		Names []definedName `xml:"definedNames>definedName"`
+	}
+	if err := xml.Unmarshal(files[wb.workbook], &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", wb.workbook, err)
+	}
+	wb.names = doc.Names
+
+	dir := path.Dir(wb.workbook)
+	wb.rels = path.Join(dir, "_rels", path.Base(wb.workbook)+".rels")
+	if rels, err = readRels(files, wb.rels); err != nil {
+		return nil, err
+	}
+	worksheets := make(map[string]string)
+	for _, r := range rels {
+		if r.TargetMode == "External" {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(r.Type, "/worksheet"):
+			worksheets[r.ID] = partPath(dir, r.Target)
+		case strings.HasSuffix(r.Type, "/styles"):
+			wb.styles = partPath(dir, r.Target)
+		case strings.HasSuffix(r.Type, "/calcChain"):
+			wb.calcChain = partPath(dir, r.Target)
+		}
+	}
+	for _, s := range doc.Sheets {
+		if p, ok := worksheets[s.ID]; ok && files[p] != nil {
+			wb.sheets[strings.ToLower(s.Name)] = sheetPart{s.Name, p}
+		}
+	}
+	if files[wb.styles] == nil {
+		return nil, fmt.Errorf("no styles")
+	}
+	wb.firstStyle, wb.firstNumFmt = styleCounts(files[wb.styles])
+	return wb, nil
+}
+
+// mainNS is the namespace of the SpreadsheetML parts.
+const mainNS = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+
+var rootRE = regexp.MustCompile(`^<([A-Za-z_][\w.-]*):[A-Za-z_][\w.-]*([^>]*)>`)
+
+// unprefixMain returns the XML part b with the elements of mainNS
+// unprefixed, if its root element has a prefix bound to mainNS, which is
+// made the default namespace instead: e.g. the parts written by the Open
+// XML SDK, whose elements are named x:worksheet, x:row, etc. The parts
+// are edited as text (see Execute), expecting unprefixed elements.
+func unprefixMain(b []byte) []byte {
+	i := 0
+	for { // skip the XML declaration, comments and doctype
+		j := bytes.IndexByte(b[i:], '<')
+		if j < 0 || i+j+1 >= len(b) {
+			return b
+		}
+		i += j
+		if c := b[i+1]; c != '?' && c != '!' {
+			break
+		}
+		i++
+	}
+	m := rootRE.FindSubmatchIndex(b[i:])
+	if m == nil {
+		return b
+	}
+	prefix := string(b[i+m[2] : i+m[3]])
+	a := attrs(string(b[i+m[4] : i+m[5]]))
+	if _, ok := a["xmlns"]; ok || a["xmlns:"+prefix] != mainNS {
+		return b
+	}
+	out := append([]byte{}, b[:i+m[4]]...)
+	out = append(out, ` xmlns="`+mainNS+`"`...)
+	out = append(out, b[i+m[4]:]...)
+	out = bytes.Replace(out, []byte("<"+prefix+":"), []byte("<"), -1)
+	return bytes.Replace(out, []byte("</"+prefix+":"), []byte("</"), -1)
+}
+
+// readRels reads the relationships part of the given path.
+func readRels(files map[string][]byte, name string) ([]relationship, error) {
+	b, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	var doc struct {
+		Rels []relationship `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return doc.Rels, nil
+}
+
+// partPath returns the path of the relationship target relative to dir.
+func partPath(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return target[1:]
+	}
+	return path.Join(dir, target)
+}
+
+var (
+	cellXfsRE = regexp.MustCompile(`(?s)<cellXfs\b[^>]*>(.*?)</cellXfs>`)
+	numFmtsRE = regexp.MustCompile(`(?s)<numFmts\b[^>]*>(.*?)</numFmts>`)
+	xfRE      = regexp.MustCompile(`<xf\b`)
+	numFmtRE  = regexp.MustCompile(`numFmtId\s*=\s*["'](\d+)["']`)
+)
+
+// styleCounts returns the number of cell styles of the styles part b,
+// and the first free custom number format id.
+func styleCounts(b []byte) (styles, numFmt int) {
+	if m := cellXfsRE.FindSubmatch(b); m != nil {
+		styles = len(xfRE.FindAll(m[1], -1))
+	}
+	numFmt = 164
+	if m := numFmtsRE.FindSubmatch(b); m != nil {
+		for _, id := range numFmtRE.FindAllSubmatch(m[1], -1) {
+			if n, _ := strconv.Atoi(string(id[1])); n >= numFmt {
+				numFmt = n + 1
+			}
+		}
+	}
+	return styles, numFmt
+}
+
+// fill is a table to be written in a sheet.
+type fill struct {
+	tbl      *sql2http.Table
+	row, col int  // the first cell, or row -1 after the last row with values
+	name     int  // index of the defined name, or -1
+	top      int  // the first row of the defined name
+	width    int  // the columns of the defined name
+	header   bool // whether the column names are written
+	rows     int  // the written rows, once filled
+}
+
+// Execute implements interface sql2http.Template.
+func (wb *Workbook) Execute(w io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/xlsx: only *sql2http.Results can be passed as data")
+	}
+	fills := make(map[string][]*fill) // by sheet part
+	for i := range resp.Tables {
+		tbl := &resp.Tables[i]
+		if n := wb.definedName(tbl.Name); n >= 0 {
+			sheet, ref, ok := parseRef(wb.names[n].Ref)
+			sp, found := wb.sheets[strings.ToLower(sheet)]
+			if !ok || !found {
+				return fmt.Errorf("template/xlsx: defined name %q: unsupported reference %q", wb.names[n].Name, wb.names[n].Ref)
+			}
+			f := &fill{tbl: tbl, row: ref[1], col: ref[0], name: n, top: ref[1], width: ref[2] - ref[0] + 1}
+			if ref[3] > ref[1] {
+				f.row++
+			}
+			fills[sp.path] = append(fills[sp.path], f)
+			continue
+		}
+		if sp, ok := wb.sheets[strings.ToLower(tbl.Name)]; ok {
+			fills[sp.path] = append(fills[sp.path], &fill{tbl: tbl, row: -1, name: -1})
+		}
+	}
+
+	out := &workbook{firstStyle: wb.firstStyle}
+	filled := make(map[string][]byte)
+	names := make(map[int]string)
+	for p, fs := range fills {
+		b, err := fillSheet(out, wb.part(p), fs)
+		if err != nil {
+			return fmt.Errorf("template/xlsx: %s: %v", p, err)
+		}
+		filled[p] = b
+		for _, f := range fs {
+			if f.name < 0 {
+				continue
+			}
+			sheet, _, _ := parseRef(wb.names[f.name].Ref)
+			width := len(f.tbl.Header)
+			if f.width > width {
+				width = f.width
+			}
+			last := f.row + f.rows - 1
+			if last < f.row {
+				last = f.row
+			}
+			names[f.name] = absoluteRef(wb.sheets[strings.ToLower(sheet)].name,
+				colName(f.col)+strconv.Itoa(f.top+1)+":"+colName(f.col+width-1)+strconv.Itoa(last+1))
+		}
+	}
+
+	z := zip.NewWriter(w)
+	for _, p := range wb.parts {
+		name, b := p.header.Name, p.data
+		if len(fills) > 0 {
+			switch {
+			case filled[name] != nil:
+				b = filled[name]
+			case name == wb.calcChain:
+				// refers to formulas which may be overwritten
+				continue
+			case name == wb.workbook:
+				b = recalcWorkbook(b, names)
+			case name == wb.rels:
+				b = calcChainRelRE.ReplaceAll(b, nil)
+			case name == "[Content_Types].xml" && wb.calcChain != "":
+				b = overrideRE.ReplaceAllFunc(b, func(m []byte) []byte {
+					if attrs(string(m))["PartName"] == "/"+wb.calcChain {
+						return nil
+					}
+					return m
+				})
+			case name == wb.styles:
+				b = addStyles(b, out.formats, wb.firstNumFmt)
+			case pivotCacheRE.MatchString(name):
+				b, _ = setAttr(b, pivotCacheDefRE, "refreshOnLoad", "1")
+			}
+		}
+		fw, err := z.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   p.header.Method,
+			Modified: p.header.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(b); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// ContentType implements interface sql2http.Template.
+func (wb *Workbook) ContentType() string {
+	return (&XLSXTemplate{}).ContentType()
+}
+
+// part returns the content of the zip entry of the given name.
+func (wb *Workbook) part(name string) []byte {
+	for _, p := range wb.parts {
+		if p.header.Name == name {
+			return p.data
+		}
+	}
+	return nil
+}
+
+// definedName returns the index of the defined name name, or -1.
+func (wb *Workbook) definedName(name string) int {
+	for i, n := range wb.names {
+		if strings.EqualFold(n.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+var (
+	cellRefRE = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]+)$`)
+)
+
+// parseRef parses the reference of a defined name to a cell or a range
+// of cells, e.g. 'Sheet 1'!$B$2:$D$10, and returns its sheet name and
+// zero based first column, first row, last column and last row.
+func parseRef(s string) (sheet string, ref [4]int, ok bool) {
+	s = strings.TrimSpace(s)
+	i := strings.LastIndexByte(s, '!')
+	if i < 0 {
+		return "", ref, false
+	}
+	sheet = s[:i]
+	if len(sheet) > 1 && sheet[0] == '\'' && sheet[len(sheet)-1] == '\'' {
+		sheet = strings.Replace(sheet[1:len(sheet)-1], "''", "'", -1)
+	}
+	cells := strings.Split(s[i+1:], ":")
+	if len(cells) > 2 {
+		return "", ref, false
+	}
+	for j, c := range cells {
+		m := cellRefRE.FindStringSubmatch(c)
+		if m == nil {
+			return "", ref, false
+		}
+		col := 0
+		for _, r := range strings.ToUpper(m[1]) {
+			col = col*26 + int(r-'A') + 1
+		}
+		row, _ := strconv.Atoi(m[2])
+		if row < 1 {
+			return "", ref, false
+		}
+		ref[2*j], ref[2*j+1] = col-1, row-1
+	}
+	if len(cells) == 1 {
+		ref[2], ref[3] = ref[0], ref[1]
+	}
+	return sheet, ref, ref[2] >= ref[0] && ref[3] >= ref[1]
+}
+
+var (
+	sheetDataRE = regexp.MustCompile(`(?s)<sheetData\b[^>]*?(?:/>|>(.*?)</sheetData>)`)
+	rowRE       = regexp.MustCompile(`(?s)<row\b([^>]*?)(?:/>|>(.*?)</row>)`)
+	cellRE      = regexp.MustCompile(`(?s)<c\b([^>]*?)(?:/>|>(.*?)</c>)`)
+	attrRE      = regexp.MustCompile(`(?:^|\s)([\w:]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	rowAttrRE   = regexp.MustCompile(`\s(?:r|spans)\s*=\s*(?:"[^"]*"|'[^']*')`)
+	valueRE     = regexp.MustCompile(`<(?:v|f|is)\b`)
+	dimensionRE = regexp.MustCompile(`<dimension\b[^>]*?/>`)
+)
+
+// xrow is a row of a worksheet.
+type xrow struct {
+	attrs   string // attributes but r and spans
+	raw     string // the row XML, if unchanged
+	cells   map[int]xcell
+	changed bool
+}
+
+// xcell is a cell of a worksheet.
+type xcell struct {
+	raw   string
+	style int
+	value bool // whether the cell has a value or formula
+}
+
+// attrs returns the attributes of the start tag attributes s, quoted
+// either way. Entities are not decoded.
+func attrs(s string) map[string]string {
+	m := make(map[string]string)
+	for _, a := range attrRE.FindAllStringSubmatch(s, -1) {
+		m[a[1]] = a[2] + a[3]
+	}
+	return m
+}
+
+// fillSheet returns the worksheet XML b with the tables of fills
+// written in it, and sets their written rows.
+func fillSheet(out *workbook, b []byte, fills []*fill) ([]byte, error) {
+	loc := sheetDataRE.FindSubmatchIndex(b)
+	if loc == nil {
+		return nil, fmt.Errorf("no sheet data")
+	}
+	rows := make(map[int]*xrow) // by zero based number
+	last := -1                  // the last row with values
+	if loc[2] >= 0 {
+		num := -1
+		for _, m := range rowRE.FindAllStringSubmatch(string(b[loc[2]:loc[3]]), -1) {
+			a := attrs(m[1])
+			if n, err := strconv.Atoi(a["r"]); err == nil {
+				num = n - 1
+			} else {
+				num++
+			}
+			r := &xrow{attrs: rowAttrRE.ReplaceAllString(m[1], ""), raw: m[0], cells: make(map[int]xcell)}
+			col := -1
+			for _, c := range cellRE.FindAllStringSubmatch(m[2], -1) {
+				a := attrs(c[1])
+				if _, ref, ok := parseRef("!" + a["r"]); ok {
+					col = ref[0]
+				} else {
+					col++
+				}
+				s, _ := strconv.Atoi(a["s"])
+				cell := xcell{raw: c[0], style: s, value: valueRE.MatchString(c[2])}
+				if cell.value {
+					last = num
+				}
+				r.cells[col] = cell
+			}
+			rows[num] = r
+		}
+	}
+
+	var buf bytes.Buffer
+	sh := &sheet{wb: out, w: bufio.NewWriter(&buf)}
+	for _, f := range fills {
+		if f.row < 0 {
+			f.row, f.col = last+1, 0
+			f.header = last < 0
+		}
+		anchor := rows[f.row]
+		rowAttrs := ""
+		styles := make([]int, len(f.tbl.Header))
+		if anchor != nil {
+			rowAttrs = anchor.attrs
+			for i := range styles {
+				styles[i] = anchor.cells[f.col+i].style
+			}
+		}
+		types := make([]string, len(f.tbl.Header))
+		for i := range types {
+			if i < len(f.tbl.Types) {
+				types[i] = strings.ToUpper(f.tbl.Types[i])
+			}
+		}
+		write := func(values []interface{}) {
+			num := f.row + f.rows
+			r := rows[num]
+			if r == nil {
+				r = &xrow{attrs: rowAttrs, cells: make(map[int]xcell)}
+				rows[num] = r
+			}
+			r.changed = true
+			sh.rows = num
+			for i, v := range values {
+				if i >= len(styles) {
+					break
+				}
+				col := f.col + i
+				if v == nil && styles[i] == styleDefault {
+					delete(r.cells, col)
+					continue
+				}
+				if v == nil {
+					sh.str(`<c r="` + sh.ref(col) + `" s="` + strconv.Itoa(styles[i]) + `"/>`)
+				} else {
+					sh.value(col, v, types[i], styles[i])
+				}
+				sh.w.Flush()
+				r.cells[col] = xcell{raw: buf.String(), style: styles[i], value: true}
+				buf.Reset()
+			}
+			f.rows++
+		}
+		if f.header {
+			header := make([]interface{}, len(f.tbl.Header))
+			for i, h := range f.tbl.Header {
+				header[i] = h
+			}
+			write(header)
+		}
+		for _, row := range f.tbl.Rows {
+			write(row.Values)
+		}
+		if sh.err != nil {
+			return nil, sh.err
+		}
+	}
+
+	nums := make([]int, 0, len(rows))
+	for n := range rows {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	var data strings.Builder
+	data.WriteString(`<sheetData>`)
+	minCol, maxCol := -1, -1
+	for _, n := range nums {
+		r := rows[n]
+		cols := make([]int, 0, len(r.cells))
+		for c := range r.cells {
+			cols = append(cols, c)
+		}
+		sort.Ints(cols)
+		if len(cols) > 0 {
+			if minCol < 0 || cols[0] < minCol {
+				minCol = cols[0]
+			}
+			if cols[len(cols)-1] > maxCol {
+				maxCol = cols[len(cols)-1]
+			}
+		}
+		if !r.changed {
+			data.WriteString(r.raw)
+			continue
+		}
+		data.WriteString(`<row r="` + strconv.Itoa(n+1) + `"` + r.attrs + `>`)
+		for _, c := range cols {
+			data.WriteString(r.cells[c].raw)
+		}
+		data.WriteString(`</row>`)
+	}
+	data.WriteString(`</sheetData>`)
+
+	res := append(append(append([]byte{}, b[:loc[0]]...), data.String()...), b[loc[1]:]...)
+	if len(nums) > 0 && minCol >= 0 {
+		dim := `<dimension ref="` + colName(minCol) + strconv.Itoa(nums[0]+1) + ":" + colName(maxCol) + strconv.Itoa(nums[len(nums)-1]+1) + `"/>`
+		res = dimensionRE.ReplaceAllLiteral(res, []byte(dim))
+	}
+	return res, nil
+}
+
+var (
+	definedNameRE   = regexp.MustCompile(`(?s)<definedName\b([^>]*?)\s*(?:/>|>.*?</definedName>)`) // empty or not
+	calcPrRE        = regexp.MustCompile(`<calcPr\b[^>]*>`)
+	calcPrBeforeRE  = regexp.MustCompile(`</sheets>|</functionGroups>|</externalReferences>|</definedNames>`)
+	calcChainRelRE  = regexp.MustCompile(`<Relationship\b[^>]*Type\s*=\s*(?:"[^"]*/calcChain"|'[^']*/calcChain')[^>]*/>`)
+	overrideRE      = regexp.MustCompile(`<Override\b[^>]*/>`)
+	pivotCacheRE    = regexp.MustCompile(`pivotCacheDefinition\d*\.xml$`)
+	pivotCacheDefRE = regexp.MustCompile(`<pivotCacheDefinition\b[^>]*>`)
+)
+
+// setAttr returns b with the attribute name set to value in the first
+// start tag matched by re, and whether there is one.
+func setAttr(b []byte, re *regexp.Regexp, name, value string) ([]byte, bool) {
+	loc := re.FindIndex(b)
+	if loc == nil {
+		return b, false
+	}
+	tag := attrRE.ReplaceAllStringFunc(string(b[loc[0]:loc[1]]), func(a string) string {
+		if attrRE.FindStringSubmatch(a)[1] == name {
+			return ""
+		}
+		return a
+	})
+	i := strings.IndexAny(tag, " \t\r\n/>")
+	tag = tag[:i] + " " + name + `="` + value + `"` + tag[i:]
+	return append(append(append([]byte{}, b[:loc[0]]...), tag...), b[loc[1]:]...), true
+}
+
+// recalcWorkbook returns the workbook part b with the defined names of
+// the given indexes set to new references, and set to be recalculated
+// when opened.
+func recalcWorkbook(b []byte, names map[int]string) []byte {
+	i := 0
+	b = definedNameRE.ReplaceAllFunc(b, func(m []byte) []byte {
+		ref, ok := names[i]
+		i++
+		if !ok {
+			return m
+		}
+		attrs := definedNameRE.FindSubmatch(m)[1]
+		var elem bytes.Buffer
+		elem.WriteString("<definedName")
+		elem.Write(attrs)
+		elem.WriteString(">")
+		xml.EscapeText(&elem, []byte(ref))
+		elem.WriteString("</definedName>")
+		return elem.Bytes()
+	})
+	if b, ok := setAttr(b, calcPrRE, "fullCalcOnLoad", "1"); ok {
+		return b
+	}
+	ends := calcPrBeforeRE.FindAllIndex(b, -1)
+	if ends == nil {
+		return b
+	}
+	at := ends[len(ends)-1][1]
+	return append(append(append([]byte{}, b[:at]...), `<calcPr fullCalcOnLoad="1"/>`...), b[at:]...)
+}
+
+var (
+	numFmtsEndRE   = regexp.MustCompile(`</numFmts>`)
+	emptyNumFmtsRE = regexp.MustCompile(`<numFmts\b[^>]*/>`)
+	numFmtElemRE   = regexp.MustCompile(`<numFmt\b`)
+	cellXfsEndRE   = regexp.MustCompile(`</cellXfs>`)
+	styleSheetRE   = regexp.MustCompile(`<styleSheet\b[^>]*>`)
+	numFmtsStartRE = regexp.MustCompile(`<numFmts\b[^>]*>`)
+	cellXfsStartRE = regexp.MustCompile(`<cellXfs\b[^>]*>`)
+)
+
+// addStyles returns the styles part b with the cell styles of the number
+// formats appended, from number format id numFmt.
+func addStyles(b []byte, formats []string, numFmt int) []byte {
+	if len(formats) == 0 {
+		return b
+	}
+	var fmts, xfs bytes.Buffer
+	for i, f := range formats {
+		fmt.Fprintf(&fmts, `<numFmt numFmtId="%d" formatCode="`, numFmt+i)
+		xml.EscapeText(&fmts, []byte(f))
+		fmts.WriteString(`"/>`)
+		fmt.Fprintf(&xfs, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, numFmt+i)
+	}
+	insert := func(b []byte, at int, s []byte) []byte {
+		return append(append(append([]byte{}, b[:at]...), s...), b[at:]...)
+	}
+	// recount sets the count attribute of the start tag matched by re to
+	// the number of children of its section.
+	recount := func(b []byte, re, section, child *regexp.Regexp) []byte {
+		m := section.FindSubmatch(b)
+		if m == nil {
+			return b
+		}
+		b, _ = setAttr(b, re, "count", strconv.Itoa(len(child.FindAll(m[1], -1))))
+		return b
+	}
+
+	b = emptyNumFmtsRE.ReplaceAll(b, nil)
+	if loc := numFmtsEndRE.FindIndex(b); loc != nil {
+		b = insert(b, loc[0], fmts.Bytes())
+	} else if loc := styleSheetRE.FindIndex(b); loc != nil {
+		b = insert(b, loc[1], []byte(`<numFmts>`+fmts.String()+`</numFmts>`))
+	}
+	b = recount(b, numFmtsStartRE, numFmtsRE, numFmtElemRE)
+	if loc := cellXfsEndRE.FindIndex(b); loc != nil {
+		b = insert(b, loc[0], xfs.Bytes())
+	}
+	return recount(b, cellXfsStartRE, cellXfsRE, xfRE)
+}
@@ -0,0 +1,277 @@
+package sql2http
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// templateParts is a workbook, as saved by a spreadsheet application:
+// a sheet "Items" with a header row and a formatted first row, and a
+// sheet "Report" with a defined name "totals" and a formula using it.
+var templateParts = map[string]string{
+	"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/><Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/><Override PartName="/xl/calcChain.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.calcChain+xml"/></Types>`,
+	"_rels/.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Items" sheetId="1" r:id="rId1"/><sheet name="Report" sheetId="2" r:id="rId2"/></sheets><definedNames><definedName name="totals">Report!$B$3:$C$4</definedName></definedNames><calcPr calcId="191029"/></workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/><Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/><Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/><Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/calcChain" Target="calcChain.xml"/></Relationships>`,
+	"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="0.0%"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="3" uniqueCount="3"><si><t>Name</t></si><si><t>Ratio</t></si><si><t>Total</t></si></sst>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><dimension ref="A1:B2"/><sheetData><row r="1" spans="1:2"><c r="A1" s="1" t="s"><v>0</v></c><c r="B1" s="1" t="s"><v>1</v></c></row><row r="2" spans="1:2" ht="20" customHeight="1"><c r="B2" s="2"/></row></sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><dimension ref="A1:C3"/><sheetData><row r="1"><c r="A1" t="s"><v>2</v></c><c r="B1"><f>SUM(totals)</f><v>0</v></c></row><row r="3"><c r="B3" s="1" t="s"><v>0</v></c><c r="C3" s="1" t="s"><v>2</v></c></row><row r="4"><c r="B4"><v>9</v></c><c r="E4"><v>7</v></c></row></sheetData></worksheet>`,
+	"xl/calcChain.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<calcChain xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><c r="B1" i="2"/></calcChain>`,
+}
+
+// executeParts returns the parts of the workbook made of parts, executed
+// with the tables items and Totals.
+func executeParts(t *testing.T, parts map[string]string) map[string]string {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for name, content := range parts {
+		f, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wb, err := parseWorkbook(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []string{"name", "ratio", "at"}
+	totals := []string{"name", "total"}
+	res := &sql2http.Result{Tables: sql2http.Tables{
+		{
+			Name:   "items",
+			Header: items,
+			Types:  []string{"TEXT", "REAL", "DATE"},
+			Rows: []sql2http.Row{
+				{Header: items, Values: []interface{}{"a & b", 0.25, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)}},
+				{Header: items, Values: []interface{}{nil, nil, nil}},
+			},
+		},
+		{
+			Name:   "Totals",
+			Header: totals,
+			Rows: []sql2http.Row{
+				{Header: totals, Values: []interface{}{"x", int64(1)}},
+				{Header: totals, Values: []interface{}{"y", int64(2)}},
+				{Header: totals, Values: []interface{}{"z", int64(3)}},
+			},
+		},
+		{Name: "ignored", Header: []string{"n"}},
+	}}
+	buf.Reset()
+	if err := wb.Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[f.Name] = string(b)
+	}
+	return out
+}
+
+// checkParts checks that the parts contain the wanted strings, or not
+// if prefixed with "!".
+func checkParts(t *testing.T, parts map[string]string, wants map[string][]string) {
+	for name, wants := range wants {
+		for _, want := range wants {
+			if strings.HasPrefix(want, "!") {
+				if strings.Contains(parts[name], want[1:]) {
+					t.Errorf("%s contains %s", name, want[1:])
+				}
+			} else if !strings.Contains(parts[name], want) {
+				t.Errorf("%s does not contain %s:\n%s", name, want, parts[name])
+			}
+		}
+	}
+}
+
+func TestWorkbook(t *testing.T) {
+	parts := executeParts(t, templateParts)
+	if _, ok := parts["xl/calcChain.xml"]; ok {
+		t.Error("the calculation chain is kept")
+	}
+	if p := parts["xl/sharedStrings.xml"]; p != templateParts["xl/sharedStrings.xml"] {
+		t.Errorf("sharedStrings.xml changed: %s", p)
+	}
+	checkParts(t, parts, map[string][]string{
+		"[Content_Types].xml":        {`/xl/sharedStrings.xml"`, `!/xl/calcChain.xml`},
+		"xl/_rels/workbook.xml.rels": {`Target="sharedStrings.xml"`, `!calcChain`},
+		"xl/workbook.xml": {
+			`<definedName name="totals">&#39;Report&#39;!$B$3:$C$6</definedName>`,
+			`<calcPr fullCalcOnLoad="1" calcId="191029"/>`,
+		},
+		"xl/styles.xml": {
+			`<numFmts count="2">`,
+			`<numFmt numFmtId="165" formatCode="yyyy-mm-dd"/></numFmts>`,
+			`<cellXfs count="4">`,
+			`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>`,
+		},
+		"xl/worksheets/sheet1.xml": {
+			`<dimension ref="A1:C3"/>`,
+			`<row r="1" spans="1:2"><c r="A1" s="1" t="s"><v>0</v></c>`,
+			`<row r="2" ht="20" customHeight="1"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a &amp; b</t></is></c><c r="B2" s="2"><v>0.25</v></c><c r="C2" s="3"><v>43891</v></c></row>`,
+			`<row r="3" ht="20" customHeight="1"><c r="B3" s="2"/></row>`,
+		},
+		"xl/worksheets/sheet2.xml": {
+			`<c r="B1"><f>SUM(totals)</f><v>0</v></c>`,
+			`<row r="3"><c r="B3" s="1" t="s"><v>0</v></c>`,
+			`<row r="4"><c r="B4" t="inlineStr"><is><t xml:space="preserve">x</t></is></c><c r="C4"><v>1</v></c><c r="E4"><v>7</v></c></row>`,
+			`<row r="6"><c r="B6" t="inlineStr"><is><t xml:space="preserve">z</t></is></c><c r="C6"><v>3</v></c></row>`,
+		},
+	})
+}
+
+// TestPrefixedWorkbook tests a workbook with the elements prefixed and
+// the attributes single-quoted, as written by the Open XML SDK.
+func TestPrefixedWorkbook(t *testing.T) {
+	elemRE := regexp.MustCompile(`<(/?)([A-Za-z]\w*)\b`)
+	prefixed := make(map[string]string)
+	for name, content := range templateParts {
+		if strings.HasPrefix(name, "xl/") && !strings.Contains(name, "_rels") {
+			content = elemRE.ReplaceAllString(content, "<${1}x:$2")
+			content = strings.Replace(content, `xmlns="`, `xmlns:x="`, 1)
+		}
+		prefixed[name] = strings.Replace(content, `"`, `'`, -1)
+	}
+	parts := executeParts(t, prefixed)
+	if _, ok := parts["xl/calcChain.xml"]; ok {
+		t.Error("the calculation chain is kept")
+	}
+	checkParts(t, parts, map[string][]string{
+		"[Content_Types].xml":        {`!/xl/calcChain.xml`},
+		"xl/_rels/workbook.xml.rels": {`!calcChain`},
+		"xl/workbook.xml": {
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:x=`,
+			`<definedName name='totals'>&#39;Report&#39;!$B$3:$C$6</definedName>`,
+			`<calcPr fullCalcOnLoad="1" calcId='191029'/>`,
+		},
+		"xl/styles.xml": {`<numFmt numFmtId="165" formatCode="yyyy-mm-dd"/></numFmts>`},
+		"xl/worksheets/sheet1.xml": {
+			`<row r="2" ht='20' customHeight='1'><c r="A2" t="inlineStr"><is><t xml:space="preserve">a &amp; b</t></is></c>`,
+			`!<x:`,
+		},
+		"xl/worksheets/sheet2.xml": {
+			`<row r="6"><c r="B6" t="inlineStr"><is><t xml:space="preserve">z</t></is></c><c r="C6"><v>3</v></c></row>`,
+		},
+	})
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		s     string
+		sheet string
+		ref   [4]int
+		ok    bool
+	}{
+		{"Data!$B$3", "Data", [4]int{1, 2, 1, 2}, true},
+		{"'It''s data'!$A$1:$AB$10", "It's data", [4]int{0, 0, 27, 9}, true},
+		{"Data!$A:$A", "", [4]int{}, false},
+		{"$A$1", "", [4]int{}, false},
+	}
+	for _, test := range tests {
+		sheet, ref, ok := parseRef(test.s)
+		if ok != test.ok || ok && (sheet != test.sheet || ref != test.ref) {
+			t.Errorf("parseRef(%q) = %q, %v, %v; want %q, %v, %v", test.s, sheet, ref, ok, test.sheet, test.ref, test.ok)
+		}
+	}
+}
+
+func TestRecalcWorkbook(t *testing.T) {
+	in := `<workbook><definedNames>` +
+		`<definedName name="empty"/>` +
+		`<definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1" />` +
+		`<definedName name="totals">Report!$B$3:$C$4</definedName>` +
+		`<definedName name="other">Items!$A$1</definedName>` +
+		`</definedNames><calcPr calcId="191029"/></workbook>`
+	got := string(recalcWorkbook([]byte(in), map[int]string{1: "'A&B'!$A$1:$B$2", 2: "Report!$B$3:$C$9"}))
+	want := `<workbook><definedNames>` +
+		`<definedName name="empty"/>` +
+		`<definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">&#39;A&amp;B&#39;!$A$1:$B$2</definedName>` +
+		`<definedName name="totals">Report!$B$3:$C$9</definedName>` +
+		`<definedName name="other">Items!$A$1</definedName>` +
+		`</definedNames><calcPr fullCalcOnLoad="1" calcId="191029"/></workbook>`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for name, content := range templateParts {
+		f, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"report.xlsx":       buf.Bytes(),
+		"sub/_default.xlsx": buf.Bytes(),
+		"~$report.xlsx":     []byte("lock file of an open workbook"),
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wb, err := ParseTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/report", "/sub/_default"} {
+		if wb.Lookup(name) == nil {
+			t.Errorf("no workbook %s", name)
+		}
+	}
+	if wb.Lookup("/other") != nil {
+		t.Error("workbook /other found")
+	}
+}
@@ -0,0 +1,500 @@
+package sql2http
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+// Limits of the spreadsheet applications.
+const (
+	maxRows   = 1048576 // rows per sheet, including the header
+	maxString = 32767   // characters per cell
+)
+
+// widthRows is the number of rows buffered to estimate the column widths.
+const widthRows = 100
+
+// Cell styles, as indexes of the cellXfs of styles.xml. The styles of
+// the number formats follow.
+const (
+	styleDefault = iota
+	styleHeader
+	styleFormats
+)
+
+const (
+	nsMain = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRel  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// workbook writes an Office Open XML workbook, one sheet after the
+// other, to a zip archive.
+type workbook struct {
+	z       *zip.Writer
+	sheets  sql2http.Tables // only the Name of the sheets, see uniqueName
+	filters []string        // the auto-filter range of each sheet, or ""
+	formats []string        // number formats, in order of first use
+
+	firstStyle int // the cell style of the first number format
+}
+
+func newWorkbook(w io.Writer) *workbook {
+	return &workbook{z: zip.NewWriter(w), firstStyle: styleFormats}
+}
+
+// uniqueName returns the sheet name of the table named name, unique in
+// the workbook.
+func (wb *workbook) uniqueName(name string) string {
+	names := append(wb.sheets, sql2http.Table{Name: name}).SheetNames()
+	return names[len(names)-1]
+}
+
+// style returns the cell style of the number format.
+func (wb *workbook) style(format string) int {
+	for i, f := range wb.formats {
+		if f == format {
+			return wb.firstStyle + i
+		}
+	}
+	wb.formats = append(wb.formats, format)
+	return wb.firstStyle + len(wb.formats) - 1
+}
+
+// writeTable writes the current table of tables, and its rows, in one
+// or more sheets: the rows exceeding a sheet continue in another one.
+func (wb *workbook) writeTable(tables *sql2http.TableStream) error {
+	tbl := tables.Table()
+	types := make([]string, len(tbl.Header))
+	for i := range types {
+		if i < len(tbl.Types) {
+			types[i] = strings.ToUpper(tbl.Types[i])
+		}
+	}
+	var head []sql2http.Row
+	for len(head) < widthRows && tables.NextRow() {
+		head = append(head, tables.Row())
+	}
+	widths := make([]int, len(tbl.Header))
+	for i, h := range tbl.Header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, row := range head {
+		for i, v := range row.Values {
+			if n := cellWidth(v, types[i]); i < len(widths) && n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	sh, err := wb.newSheet(tbl.Name, tbl.Header, widths)
+	if err != nil {
+		return err
+	}
+	for _, row := range head {
+		sh.row(row.Values, types)
+	}
+	for tables.NextRow() {
+		if sh.rows == maxRows {
+			if err := sh.close(); err != nil {
+				return err
+			}
+			if sh, err = wb.newSheet(tbl.Name, tbl.Header, widths); err != nil {
+				return err
+			}
+		}
+		sh.row(tables.Row().Values, types)
+	}
+	return sh.close()
+}
+
+// sheet writes the XML of a worksheet.
+type sheet struct {
+	wb     *workbook
+	w      *bufio.Writer
+	index  int
+	rows   int // written rows, including the header
+	header []string
+	err    error
+}
+
+func (wb *workbook) newSheet(name string, header []string, widths []int) (*sheet, error) {
+	index := len(wb.sheets)
+	wb.sheets = append(wb.sheets, sql2http.Table{Name: wb.uniqueName(name)})
+	wb.filters = append(wb.filters, "")
+	f, err := wb.z.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", index+1))
+	if err != nil {
+		return nil, err
+	}
+	sh := &sheet{wb: wb, w: bufio.NewWriter(f), index: index, header: header}
+	sh.str(xml.Header)
+	sh.str(`<worksheet xmlns="` + nsMain + `" xmlns:r="` + nsRel + `"><sheetViews><sheetView workbookViewId="0"`)
+	if index == 0 {
+		sh.str(` tabSelected="1"`)
+	}
+	sh.str(`>`)
+	if len(header) > 0 {
+		sh.str(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft"/>`)
+	}
+	sh.str(`</sheetView></sheetViews><sheetFormatPr defaultRowHeight="15"/>`)
+	if len(widths) > 0 {
+		sh.str(`<cols>`)
+		for i, w := range widths {
+			w += 2 // margin, and room for the auto-filter button
+			if w < minColWidth {
+				w = minColWidth
+			} else if w > maxColWidth {
+				w = maxColWidth
+			}
+			n := strconv.Itoa(i + 1)
+			sh.str(`<col min="` + n + `" max="` + n + `" width="` + strconv.Itoa(w) + `" customWidth="1"/>`)
+		}
+		sh.str(`</cols>`)
+	}
+	sh.str(`<sheetData>`)
+	if len(header) > 0 {
+		sh.str(`<row r="1">`)
+		for i, h := range header {
+			sh.inlineString(i, h, styleHeader)
+		}
+		sh.str(`</row>`)
+		sh.rows++
+	}
+	return sh, sh.err
+}
+
+func (sh *sheet) str(s string) {
+	if sh.err == nil {
+		_, sh.err = sh.w.WriteString(s)
+	}
+}
+
+func (sh *sheet) escape(s string) {
+	if sh.err == nil {
+		sh.err = xml.EscapeText(sh.w, []byte(s))
+	}
+}
+
+// ref returns the reference of column col of the current row, e.g. "B2".
+func (sh *sheet) ref(col int) string {
+	return colName(col) + strconv.Itoa(sh.rows+1)
+}
+
+// cell starts a cell of column col, with given type and style, without
+// closing its tag.
+func (sh *sheet) cell(col int, typ string, style int) {
+	sh.str(`<c r="` + sh.ref(col) + `"`)
+	if typ != "" {
+		sh.str(` t="` + typ + `"`)
+	}
+	if style != styleDefault {
+		sh.str(` s="` + strconv.Itoa(style) + `"`)
+	}
+	sh.str(`>`)
+}
+
+func (sh *sheet) number(col int, v string, style int) {
+	sh.cell(col, "", style)
+	sh.str(`<v>` + v + `</v></c>`)
+}
+
+func (sh *sheet) inlineString(col int, s string, style int) {
+	if utf8.RuneCountInString(s) > maxString {
+		s = string([]rune(s)[:maxString])
+	}
+	sh.cell(col, "inlineStr", style)
+	sh.str(`<is><t xml:space="preserve">`)
+	sh.escape(s)
+	sh.str(`</t></is></c>`)
+}
+
+// row writes the values of a row, read from columns of the given
+// (uppercase) database types.
+func (sh *sheet) row(values []interface{}, types []string) {
+	sh.str(`<row r="` + strconv.Itoa(sh.rows+1) + `">`)
+	for i, v := range values {
+		var typ string
+		if i < len(types) {
+			typ = types[i]
+		}
+		sh.value(i, v, typ, styleDefault)
+	}
+	sh.str(`</row>`)
+	sh.rows++
+}
+
+// value writes the cell of column col holding v, read from a column of
+// the given (uppercase) database type. The cell has the given style,
+// unless it is styleDefault and v needs a number format (dates and
+// decimals).
+func (sh *sheet) value(col int, v interface{}, typ string, style int) {
+	switch v := v.(type) {
+	case nil:
+		// empty cell
+	case bool:
+		b := "0"
+		if v {
+			b = "1"
+		}
+		sh.cell(col, "b", style)
+		sh.str(`<v>` + b + `</v></c>`)
+	case time.Time:
+		serial, ok := excelTime(v)
+		if !ok {
+			sh.inlineString(col, v.Format("2006-01-02 15:04:05"), style)
+			return
+		}
+		if style == styleDefault {
+			format := DateTimeFormat
+			if typ == "DATE" {
+				format = DateFormat
+			}
+			style = sh.wb.style(format)
+		}
+		sh.number(col, strconv.FormatFloat(serial, 'f', -1, 64), style)
+	case string:
+		if format, ok := decimalFormat(v, typ); ok {
+			f, _ := strconv.ParseFloat(v, 64)
+			if style == styleDefault {
+				style = sh.wb.style(format)
+			}
+			sh.number(col, strconv.FormatFloat(f, 'g', -1, 64), style)
+			return
+		}
+		sh.inlineString(col, v, style)
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			sh.number(col, strconv.FormatInt(rv.Int(), 10), style)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			sh.number(col, strconv.FormatUint(rv.Uint(), 10), style)
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				sh.inlineString(col, fmt.Sprint(v), style)
+				return
+			}
+			sh.number(col, strconv.FormatFloat(f, 'g', -1, 64), style)
+		default:
+			sh.inlineString(col, fmt.Sprint(v), style)
+		}
+	}
+}
+
+// close ends the sheet XML.
+func (sh *sheet) close() error {
+	sh.str(`</sheetData>`)
+	if len(sh.header) > 0 {
+		ref := "A1:" + colName(len(sh.header)-1) + strconv.Itoa(sh.rows)
+		sh.wb.filters[sh.index] = ref
+		sh.str(`<autoFilter ref="` + ref + `"/>`)
+	}
+	sh.str(`</worksheet>`)
+	if sh.err != nil {
+		return sh.err
+	}
+	return sh.w.Flush()
+}
+
+// close writes the workbook parts, and closes the zip archive.
+func (wb *workbook) close() error {
+	if len(wb.sheets) == 0 {
+		// a workbook needs at least one sheet
+		sh, err := wb.newSheet("", nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := sh.close(); err != nil {
+			return err
+		}
+	}
+	var b strings.Builder
+	esc := func(s string) {
+		xml.EscapeText(&b, []byte(s))
+	}
+
+	// [Content_Types].xml
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`</Types>`)
+	if err := wb.file("[Content_Types].xml", b.String()); err != nil {
+		return err
+	}
+
+	b.Reset()
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + nsRel + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`)
+	if err := wb.file("_rels/.rels", b.String()); err != nil {
+		return err
+	}
+
+	// xl/workbook.xml and its relationships
+	b.Reset()
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="` + nsMain + `" xmlns:r="` + nsRel + `">` +
+		`<bookViews><workbookView activeTab="0"/></bookViews><sheets>`)
+	for i, sh := range wb.sheets {
+		b.WriteString(`<sheet name="`)
+		esc(sh.Name)
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets>`)
+	defined := false
+	for i, ref := range wb.filters {
+		if ref == "" {
+			continue
+		}
+		if !defined {
+			b.WriteString(`<definedNames>`)
+			defined = true
+		}
+		fmt.Fprintf(&b, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">`, i)
+		esc(absoluteRef(wb.sheets[i].Name, ref))
+		b.WriteString(`</definedName>`)
+	}
+	if defined {
+		b.WriteString(`</definedNames>`)
+	}
+	b.WriteString(`</workbook>`)
+	if err := wb.file("xl/workbook.xml", b.String()); err != nil {
+		return err
+	}
+	b.Reset()
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, nsRel, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(wb.sheets)+1, nsRel)
+	b.WriteString(`</Relationships>`)
+	if err := wb.file("xl/_rels/workbook.xml.rels", b.String()); err != nil {
+		return err
+	}
+
+	// xl/styles.xml
+	b.Reset()
+	b.WriteString(xml.Header)
+	b.WriteString(`<styleSheet xmlns="` + nsMain + `">`)
+	if len(wb.formats) > 0 {
+		fmt.Fprintf(&b, `<numFmts count="%d">`, len(wb.formats))
+		for i, f := range wb.formats {
+			fmt.Fprintf(&b, `<numFmt numFmtId="%d" formatCode="`, 164+i)
+			esc(f)
+			b.WriteString(`"/>`)
+		}
+		b.WriteString(`</numFmts>`)
+	}
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&b, `<cellXfs count="%d">`, styleFormats+len(wb.formats))
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	for i := range wb.formats {
+		fmt.Fprintf(&b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, 164+i)
+	}
+	b.WriteString(`</cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`)
+	if err := wb.file("xl/styles.xml", b.String()); err != nil {
+		return err
+	}
+	return wb.z.Close()
+}
+
+func (wb *workbook) file(name, content string) error {
+	f, err := wb.z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, content)
+	return err
+}
+
+// colName returns the name of the column of index i, e.g. "A" for 0,
+// "AA" for 26.
+func colName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// absoluteRef returns the absolute reference of the range ref (e.g.
+// "A1:D5") of the named sheet, e.g. 'name'!$A$1:$D$5.
+func absoluteRef(sheet, ref string) string {
+	abs := func(cell string) string {
+		i := strings.IndexAny(cell, "0123456789")
+		return "$" + cell[:i] + "$" + cell[i:]
+	}
+	parts := strings.SplitN(ref, ":", 2)
+	return "'" + strings.Replace(sheet, "'", "''", -1) + "'!" + abs(parts[0]) + ":" + abs(parts[1])
+}
+
+// excelTime returns the serial date-time of the wall clock time of t,
+// and whether it can be represented (dates from 1900).
+func excelTime(t time.Time) (float64, bool) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	// days since 1899-12-30, the epoch of the 1900 date system
+	serial := float64(wall.Unix())/86400 + 25569 + float64(wall.Nanosecond())/8.64e13
+	return serial, serial >= 1 && t.Year() <= 9999
+}
+
+// decimalFormat returns the number format of the string s of a column of
+// the given database type, and whether s is to be written as a number:
+// strings of DECIMAL or NUMERIC columns, as returned by some drivers.
+func decimalFormat(s, typ string) (string, bool) {
+	if typ != "DECIMAL" && typ != "NUMERIC" && typ != "MONEY" {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	format := "#,##0"
+	if i := strings.IndexByte(s, '.'); i >= 0 && i < len(s)-1 {
+		format += "." + strings.Repeat("0", len(s)-i-1)
+	}
+	return format, true
+}
+
+// cellWidth returns the estimated width, in characters, of the value v
+// of a column of the given database type.
+func cellWidth(v interface{}, typ string) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 5
+	case time.Time:
+		if typ == "DATE" {
+			return len(DateFormat)
+		}
+		return len(DateTimeFormat)
+	case string:
+		if _, ok := decimalFormat(v, typ); ok {
+			return len(v) + len(v)/3
+		}
+		return utf8.RuneCountInString(v)
+	}
+	return len(fmt.Sprint(v))
+}
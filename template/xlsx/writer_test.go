@@ -0,0 +1,173 @@
+package sql2http
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+)
+
+func TestColName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA", 16383: "XFD"}
+	for i, want := range tests {
+		if got := colName(i); got != want {
+			t.Errorf("colName(%d) = %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	header := []string{"id", "name", "price", "at", "ok"}
+	res := &sql2http.Result{Tables: sql2http.Tables{
+		{
+			Name:   "a/b",
+			Header: header,
+			Types:  []string{"INTEGER", "TEXT", "NUMERIC", "DATE", "BOOLEAN"},
+			Rows: []sql2http.Row{
+				{Header: header, Values: []interface{}{int64(1), "x < y & \x01", "12.50", time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), true}},
+				{Header: header, Values: []interface{}{int64(2), nil, nil, nil, false}},
+			},
+		},
+		{Name: "a:b", Header: []string{"n"}},
+	}}
+	buf := &bytes.Buffer{}
+	if err := (&XLSXTemplate{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(bytes.NewReader(b))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = string(b)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	wb := parts["xl/workbook.xml"]
+	if !strings.Contains(wb, `<sheet name="a_b" sheetId="1"`) || !strings.Contains(wb, `<sheet name="a_b (2)" sheetId="2"`) {
+		t.Errorf("sheet names: %s", wb)
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A2"><v>1</v></c>`,
+		`<t xml:space="preserve">x &lt; y &amp; ` + "�" + `</t>`,
+		`<c r="C2" s="2"><v>12.5</v></c>`,
+		`<c r="D2" s="3"><v>43891</v></c>`,
+		`<c r="E2" t="b"><v>1</v></c>`,
+		`<row r="3"><c r="A3"><v>2</v></c><c r="E3" t="b"><v>0</v></c></row>`,
+		`<autoFilter ref="A1:E3"/>`,
+		`state="frozen"`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet1.xml does not contain %s", want)
+		}
+	}
+	styles := parts["xl/styles.xml"]
+	if !strings.Contains(styles, `formatCode="#,##0.00"`) || !strings.Contains(styles, `formatCode="yyyy-mm-dd"`) {
+		t.Errorf("number formats: %s", styles)
+	}
+}
+
+func TestValue(t *testing.T) {
+	date := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    interface{}
+		typ  string
+		want string
+	}{
+		{nil, "", ``},
+		{true, "BOOLEAN", `<c r="A1" t="b"><v>1</v></c>`},
+		{int64(-3), "INTEGER", `<c r="A1"><v>-3</v></c>`},
+		{uint8(7), "", `<c r="A1"><v>7</v></c>`},
+		{2.5, "REAL", `<c r="A1"><v>2.5</v></c>`},
+		{math.NaN(), "REAL", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">NaN</t></is></c>`},
+		{"12.50", "DECIMAL", `<c r="A1" s="2"><v>12.5</v></c>`},
+		{"3", "NUMERIC", `<c r="A1" s="3"><v>3</v></c>`},
+		{"12.50", "TEXT", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">12.50</t></is></c>`},
+		{"n/a", "DECIMAL", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">n/a</t></is></c>`},
+		{date, "DATE", `<c r="A1" s="4"><v>43891</v></c>`},
+		{date.Add(18 * time.Hour), "TIMESTAMP", `<c r="A1" s="5"><v>43891.75</v></c>`},
+		{time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC), "DATE", `<c r="A1" t="inlineStr"><is><t xml:space="preserve">1800-01-01 00:00:00</t></is></c>`},
+	}
+	wb := newWorkbook(ioutil.Discard)
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		sh := &sheet{wb: wb, w: bufio.NewWriter(&buf)}
+		sh.value(0, tt.v, tt.typ, styleDefault)
+		sh.w.Flush()
+		if got := buf.String(); got != tt.want {
+			t.Errorf("value(%#v, %s) = %s; want %s", tt.v, tt.typ, got, tt.want)
+		}
+	}
+	want := []string{"#,##0.00", "#,##0", DateFormat, DateTimeFormat}
+	if strings.Join(wb.formats, " ") != strings.Join(want, " ") {
+		t.Errorf("formats %q; want %q", wb.formats, want)
+	}
+}
+
+func TestCellWidth(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		typ  string
+		want int
+	}{
+		{nil, "", 0},
+		{true, "", 5},
+		{"héllo", "TEXT", 5},
+		{"1234567.89", "DECIMAL", 13},
+		{time.Time{}, "DATE", len(DateFormat)},
+		{time.Time{}, "DATETIME", len(DateTimeFormat)},
+		{int64(-12345), "", 6},
+	}
+	for _, tt := range tests {
+		if got := cellWidth(tt.v, tt.typ); got != tt.want {
+			t.Errorf("cellWidth(%#v, %s) = %d; want %d", tt.v, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	wb := newWorkbook(ioutil.Discard)
+	var got []string
+	for _, name := range []string{"sales", "Sales", "", "a[1]", strings.Repeat("x", 40)} {
+		n := wb.uniqueName(name)
+		wb.sheets = append(wb.sheets, sql2http.Table{Name: n})
+		got = append(got, n)
+	}
+	want := []string{"sales", "Sales (2)", "default", "a_1_", strings.Repeat("x", 31)}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("names %q; want %q", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package yaml implements a YAML template, writing the rows of the
+// result tables as lists of maps, in column order.
+package yaml
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	Ext         = ".yaml"
+	ContentType = "application/yaml; charset=utf-8"
+)
+
+func init() {
+	sql2http.DefaultTemplateSet.Register(Ext, &Template{})
+	sql2http.DefaultTemplateSet.Register(".yml", &Template{})
+}
+
+// Template implements interface sql2http.Template by writing a YAML
+// mapping of the query names to the list of their rows, each row a
+// mapping of the column names to the values, in the order of the
+// columns. For example:
+//
+//     users:
+//     - id: 1
+//       name: Ann
+//       created: 2020-03-01T12:00:00Z
+//       note: null
+//       address: |
+//         1 Main Street
+//         Springfield
+//
+// NULL values are written as null, times as timestamps, strings of
+// several lines as literal blocks, and strings which are not valid
+// UTF-8 as !!binary. Strings which would read as another type (e.g.
+// "yes" or "2020-03-01") are quoted.
+//
+// Empty query and column names default to "default" and "column", and
+// duplicates get a " (n)" suffix, as mapping keys must be unique.
+type Template struct{}
+
+func (t *Template) Execute(wr io.Writer, data interface{}) error {
+	resp, ok := data.(*sql2http.Result)
+	if !ok {
+		return fmt.Errorf("template/yaml: only *sql2http.Result can be passed as data")
+	}
+	names := make([]string, len(resp.Tables))
+	for i, tbl := range resp.Tables {
+		names[i] = tbl.Name
+	}
+	names = uniqueKeys(names, "default")
+	doc := make(yaml.MapSlice, len(resp.Tables))
+	for i, tbl := range resp.Tables {
+		keys := uniqueKeys(tbl.Header, "column")
+		rows := make([]yaml.MapSlice, len(tbl.Rows))
+		for j, row := range tbl.Rows {
+			rows[j] = make(yaml.MapSlice, len(row.Values))
+			for k, v := range row.Values {
+				rows[j][k] = yaml.MapItem{Key: keys[k], Value: v}
+			}
+		}
+		doc[i] = yaml.MapItem{Key: names[i], Value: rows}
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("template/yaml: %v", err)
+	}
+	_, err = wr.Write(b)
+	return err
+}
+
+// uniqueKeys returns names, empty ones replaced by def, and duplicates
+// with a " (n)" suffix.
+func uniqueKeys(names []string, def string) []string {
+	keys := make([]string, len(names))
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if name == "" {
+			name = def
+		}
+		key := name
+		for n := 2; seen[key]; n++ {
+			key = name + " (" + strconv.Itoa(n) + ")"
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+func (t *Template) ContentType() string { return ContentType }
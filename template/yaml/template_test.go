@@ -0,0 +1,82 @@
+package yaml
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"git.sr.ht/~detaoin/sql2http"
+	"gopkg.in/yaml.v2"
+)
+
+func TestExecute(t *testing.T) {
+	header := []string{"name", "id", "note", "created", "flag"}
+	res := &sql2http.Result{Tables: sql2http.Tables{
+		{Name: "users", Header: header, Rows: []sql2http.Row{
+			{Header: header, Values: []interface{}{"Ann", int64(1), "1 Main Street\nSpringfield\n", time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), "yes"}},
+			{Header: header, Values: []interface{}{"Bob", int64(2), nil, nil, "no"}},
+		}},
+		{Name: "empty", Header: []string{"n"}},
+	}}
+	buf := &bytes.Buffer{}
+	if err := (&Template{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	want := `users:
+- name: Ann
+  id: 1
+  note: |
+    1 Main Street
+    Springfield
+  created: 2020-03-01T12:00:00Z
+  flag: "yes"
+- name: Bob
+  id: 2
+  note: null
+  created: null
+  flag: "no"
+empty: []
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	row := doc[0].Value.([]interface{})[0].(yaml.MapSlice)
+	for i, item := range row {
+		if item.Key != header[i] {
+			t.Errorf("column %d read back as %v", i, item.Key)
+		}
+	}
+}
+
+func TestUniqueKeys(t *testing.T) {
+	header := []string{"n", "", "n", "n (2)"}
+	res := &sql2http.Result{Tables: sql2http.Tables{
+		{Name: "t", Header: header, Rows: []sql2http.Row{{Header: header, Values: []interface{}{1, 2, 3, 4}}}},
+		{Name: "t"},
+		{Name: ""},
+	}}
+	buf := &bytes.Buffer{}
+	if err := (&Template{}).Execute(buf, res); err != nil {
+		t.Fatal(err)
+	}
+	want := `t:
+- "n": 1
+  column: 2
+  n (2): 3
+  n (2) (2): 4
+t (2): []
+default: []
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	var doc map[string]interface{}
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &doc); err != nil {
+		t.Errorf("output read back: %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package sql2http
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -25,6 +27,28 @@ type Template interface {
 	ContentType() string
 }
 
+// Configurer is implemented by Templates accepting per-page options,
+// for example the mapping of result columns to output fields.
+//
+// Configure returns a new Template using the given options, leaving the
+// receiver unchanged. An error is returned for unknown or invalid
+// options.
+type Configurer interface {
+	Configure(options map[string]string) (Template, error)
+}
+
+// HeaderTemplate is implemented by Templates setting response headers
+// which depend on the request, for example Content-Disposition to
+// download the response as a file.
+type HeaderTemplate interface {
+	Template
+
+	// SetHeader sets the headers of the response to data, before its
+	// body is written. It is called after the Content-Type header is
+	// set to the value of ContentType, which it may change.
+	SetHeader(h http.Header, data *Result)
+}
+
 // TemplateSet represents a set of templates, stored by file extension.
 type TemplateSet struct {
 	m sync.RWMutex
@@ -41,7 +65,7 @@ func (ts *TemplateSet) Register(ext string, t Template) {
 }
 
 func (ts *TemplateSet) Get(ext string) Template {
-	if ts == nil || ts.t == nil {
+	if ts == nil {
 		return nil
 	}
 	ts.m.RLock()
@@ -50,6 +74,35 @@ func (ts *TemplateSet) Get(ext string) Template {
 	return t
 }
 
+// Swap replaces all the templates of ts by the ones of from. Concurrent
+// calls to Get see either all the previous templates, or all the new
+// ones.
+//
+// This allows to update the templates of registered pages, e.g. when
+// the template files change.
+func (ts *TemplateSet) Swap(from *TemplateSet) {
+	from = from.Clone()
+	ts.m.Lock()
+	ts.t = from.t
+	ts.m.Unlock()
+}
+
+// Exts returns the sorted list of file extensions having a registered
+// template in ts.
+func (ts *TemplateSet) Exts() []string {
+	if ts == nil {
+		return nil
+	}
+	ts.m.RLock()
+	exts := make([]string, 0, len(ts.t))
+	for ext := range ts.t {
+		exts = append(exts, ext)
+	}
+	ts.m.RUnlock()
+	sort.Strings(exts)
+	return exts
+}
+
 // Clone returns a shallow copy of ts. It allocates a new map, however
 // if the Templates associated with ts are pointers, then the returned
 // TemplateSet will use the same pointers.
@@ -89,17 +142,6 @@ func TemplateFromExecuter(t Executer, contentType string) Template {
 // their respective default template.
 var DefaultTemplateSet = &TemplateSet{}
 
-var TemplateFuncs = map[string]interface{}{
-	"add":   add,
-	"mod":   mod,
-	"join":  strings.Join,
-	"split": strings.Split,
-	"tex":   TeXEscaper,
-}
-
-func add(x, y int) int { return x + y }
-func mod(x, y int) int { return x % y }
-
 func TeXEscapeString(s string) string {
 	// "\" replace must be the first one, "\" is used as an escape character!
 	s = strings.Replace(s, `\`, `\textbackslash`, -1)